@@ -19,9 +19,12 @@ import (
 
 	"hzchat/internal/app/chat"
 	"hzchat/internal/app/db"
+	"hzchat/internal/app/gc"
 	"hzchat/internal/app/storage"
 	"hzchat/internal/configs"
 	"hzchat/internal/handler"
+	"hzchat/internal/pkg/cdnsign"
+	"hzchat/internal/pkg/limiter"
 	"hzchat/internal/pkg/logx"
 
 	dbc "hzchat/internal/app/db/sqlc"
@@ -45,28 +48,18 @@ func main() {
 		Msg("Configuration loaded successfully")
 
 	// Initialize storage service
-	pubStorageConfig := storage.ServiceConfig{
-		BucketName:      cfg.S3PublicBucketName,
-		Endpoint:        cfg.S3Endpoint,
-		AccessKeyID:     cfg.S3AccessKeyID,
-		SecretAccessKey: cfg.S3SecretAccessKey,
-	}
+	pubStorageConfig := storageConfig(cfg, cfg.S3PublicBucketName)
+	pubStorageConfig.Public = true
 	publicStorage, err := storage.NewStorageService(pubStorageConfig)
 	if err != nil {
 		logx.Fatal(err, "Failed to initialize public storage service")
 	}
 
-	privStorageConfig := storage.ServiceConfig{
-		BucketName:      cfg.S3PrivateBucketName,
-		Endpoint:        cfg.S3Endpoint,
-		AccessKeyID:     cfg.S3AccessKeyID,
-		SecretAccessKey: cfg.S3SecretAccessKey,
-	}
-	privateStorage, err := storage.NewStorageService(privStorageConfig)
+	privateStorage, err := storage.NewStorageService(storageConfig(cfg, cfg.S3PrivateBucketName))
 	if err != nil {
 		logx.Fatal(err, "Failed to initialize private storage service")
 	}
-	logx.Info("Storage services initialized successfully")
+	logx.Info("Storage services initialized successfully", "driver", cfg.StorageDriver)
 
 	// Initialize database
 	dbPool, err := db.NewPool(cfg.DatabaseDSN)
@@ -80,8 +73,58 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	// Initialize rate limiter policies
+	rateLimitStore, err := limiter.NewStore(limiter.StoreConfig{
+		Driver:   cfg.RateLimitStore,
+		RedisURL: cfg.RedisURL,
+	})
+	if err != nil {
+		logx.Fatal(err, "Failed to initialize rate limit store")
+	}
+	rateLimiter := limiter.New(handler.RateLimitPolicies(cfg.RateLimitPolicies), rateLimitStore)
+	logx.Info("Rate limiter initialized", "store", cfg.RateLimitStore)
+
+	// Initialize attachment malware scanner
+	scanner, err := chat.NewAttachmentScanner(cfg, privateStorage)
+	if err != nil {
+		logx.Fatal(err, "Failed to initialize attachment scanner")
+	}
+	logx.Info("Attachment scanner initialized", "scanner", cfg.Scanner, "fail_open", cfg.ScanFailOpen)
+
 	// Initialize Chat Manager
-	manager := chat.NewManager(cfg)
+	manager := chat.NewManager(cfg, chat.ManagerDeps{
+		RateLimiter:    rateLimiter,
+		PrivateStorage: privateStorage,
+		Scanner:        scanner,
+	})
+
+	queries := dbc.New(dbPool)
+
+	// Start storage garbage collector
+	var collector *gc.Collector
+	if cfg.GCIntervalMinutes > 0 && !cfg.GCEnabled() {
+		logx.Warn("Storage garbage collector disabled: the Redis store implies instances that may share storage. Set GC_EXCLUSIVE_STORAGE to run it.")
+	}
+	if cfg.GCEnabled() {
+		collector = gc.New(gc.Config{
+			Interval:    time.Duration(cfg.GCIntervalMinutes) * time.Minute,
+			GracePeriod: time.Duration(cfg.GCGraceMinutes) * time.Minute,
+			DryRun:      cfg.GCDryRun,
+		}, gc.Deps{
+			PrivateStorage: privateStorage,
+			PublicStorage:  publicStorage,
+			Rooms:          manager,
+			Avatars:        queries,
+		})
+		go collector.Run(ctx)
+	}
+
+	// Initialize public asset URL signer
+	assetSigner, err := cdnsign.New(handler.AssetSignerConfig(cfg))
+	if err != nil {
+		logx.Fatal(err, "Failed to initialize asset URL signer")
+	}
+	logx.Info("Asset URL signer initialized", "mode", cfg.CDNSigning)
 
 	// Setup HTTP server and routes
 	deps := &handler.AppDeps{
@@ -89,7 +132,10 @@ func main() {
 		Config:         cfg,
 		PublicStorage:  publicStorage,
 		PrivateStorage: privateStorage,
-		DB:             dbc.New(dbPool),
+		DB:             queries,
+		RateLimiter:    rateLimiter,
+		AssetSigner:    assetSigner,
+		GC:             collector,
 	}
 	router := handler.Router(deps)
 
@@ -124,3 +170,17 @@ func main() {
 
 	logx.Info("Server gracefully stopped.")
 }
+
+// storageConfig builds the storage configuration of a bucket for the configured driver.
+func storageConfig(cfg *configs.AppConfig, bucket string) storage.ServiceConfig {
+	return storage.ServiceConfig{
+		Driver:          cfg.StorageDriver,
+		BucketName:      bucket,
+		Endpoint:        cfg.S3Endpoint,
+		AccessKeyID:     cfg.S3AccessKeyID,
+		SecretAccessKey: cfg.S3SecretAccessKey,
+		LocalDir:        cfg.LocalStorageDir,
+		LocalBaseURL:    cfg.LocalStorageBaseURL,
+		SigningKey:      []byte(cfg.LocalStorageSecret),
+	}
+}
@@ -2,40 +2,27 @@ package chat
 
 import (
 	"encoding/json"
-	"hzchat/internal/pkg/errs"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
+
+	"hzchat/internal/configs"
+	"hzchat/internal/pkg/errs"
 )
 
 const (
-	// MaxAttachmentSizeMB is the maximum allowed file size in megabytes.
+	// MaxAttachmentSizeMB is the maximum file size in megabytes of a single presigned upload.
+	// Larger files, up to the limit of the user's plan, must use a multipart upload.
 	MaxAttachmentSizeMB = 5
 
-	// MaxAttachmentSize is the maximum allowed file size in bytes.
+	// MaxAttachmentSize is the maximum file size in bytes of a single presigned upload.
 	MaxAttachmentSize = MaxAttachmentSizeMB * 1024 * 1024
 
 	// PresignedURLDuration is the fixed duration for which the upload URL is valid (5 minutes).
 	PresignedURLDuration = 5 * time.Minute
 )
 
-// AllowedMIMETypes defines the set of permitted MIME types for file attachments.
-var AllowedMIMETypes = map[string]struct{}{
-	"image/jpeg": {},
-	"image/png":  {},
-	"image/webp": {},
-	"image/gif":  {},
-}
-
-// ExtToMIME maps file extensions to their corresponding MIME types.
-var ExtToMIME = map[string]string{
-	".jpg":  "image/jpeg",
-	".jpeg": "image/jpeg",
-	".png":  "image/png",
-	".webp": "image/webp",
-	".gif":  "image/gif",
-}
-
 // Attachment represents a file attachment in a chat message.
 type Attachment struct {
 	Key      string          `json:"fileKey"`
@@ -43,42 +30,94 @@ type Attachment struct {
 	MimeType string          `json:"mimeType"`
 	Size     int64           `json:"fileSize"`
 	Meta     json.RawMessage `json:"meta,omitempty"`
+
+	// ViewOnce limits every recipient to a single download; the file is deleted once all have opened it.
+	ViewOnce bool `json:"viewOnce,omitempty"`
 }
 
-// ValidateFileSize checks if the provided file size is within acceptable limits.
+// ValidateFileSize checks if the provided file size is within the limit of a single presigned upload.
 func ValidateFileSize(fileSize int64) *errs.CustomError {
+	return ValidateFileSizeLimit(fileSize, MaxAttachmentSize)
+}
+
+// ValidateFileSizeLimit checks if the provided file size is positive and does not exceed maxSize.
+func ValidateFileSizeLimit(fileSize int64, maxSize int64) *errs.CustomError {
 	if fileSize <= 0 {
 		return errs.NewError(errs.ErrInvalidParams)
 	}
 
-	if fileSize > MaxAttachmentSize {
+	if fileSize > maxSize {
 		return errs.NewError(errs.ErrFileSizeTooLarge)
 	}
 
 	return nil
 }
 
-// ValidateFileType checks if the provided file name and MIME type are allowed.
-func ValidateFileType(fileName string, mimeType string) *errs.CustomError {
+// ValidateFileType checks that the MIME type is a configured attachment type and that the
+// extension of the file name belongs to it, and returns the settings of the type.
+func ValidateFileType(types configs.AttachmentTypes, fileName string, mimeType string) (configs.AttachmentType, *errs.CustomError) {
 	lowerMimeType := strings.ToLower(mimeType)
 
-	if _, ok := AllowedMIMETypes[lowerMimeType]; !ok {
-		return errs.NewError(errs.ErrInvalidParams)
+	t, ok := types[lowerMimeType]
+	if !ok {
+		return configs.AttachmentType{}, errs.NewError(errs.ErrInvalidParams)
 	}
 
 	ext := strings.ToLower(filepath.Ext(fileName))
 	if ext == "" || len(ext) < 2 {
-		return errs.NewError(errs.ErrInvalidParams)
+		return configs.AttachmentType{}, errs.NewError(errs.ErrInvalidParams)
 	}
 
-	expectedMIME, ok := ExtToMIME[ext]
-	if !ok {
-		return errs.NewError(errs.ErrInvalidParams)
+	if !slices.Contains(t.Extensions, ext) {
+		return configs.AttachmentType{}, errs.NewError(errs.ErrInvalidParams)
 	}
 
-	if expectedMIME != lowerMimeType {
-		return errs.NewError(errs.ErrInvalidParams)
+	return t, nil
+}
+
+// AttachmentPolicy decides which attachments a user may upload by combining the configured
+// attachment types with the upload limits of the user's plan.
+type AttachmentPolicy struct {
+	Types configs.AttachmentTypes
+	Plans configs.UploadPlans
+}
+
+// AttachmentRule is the outcome of resolving a file against the AttachmentPolicy.
+type AttachmentRule struct {
+	Type configs.AttachmentType
+
+	// MaxSize is the smaller of the type's and the plan's size limits, in bytes.
+	MaxSize int64
+}
+
+// Resolve checks the file name and MIME type against the attachment types allowed in the room
+// type for the plan, and returns the matching type with the largest size the file may have.
+func (p AttachmentPolicy) Resolve(fileName, mimeType, roomType, planType string) (AttachmentRule, *errs.CustomError) {
+	t, err := ValidateFileType(p.Types, fileName, mimeType)
+	if err != nil {
+		return AttachmentRule{}, err
 	}
 
-	return nil
+	if !t.AllowedIn(roomType, planType) {
+		return AttachmentRule{}, errs.NewError(errs.ErrAttachmentTypeNotAllowed)
+	}
+
+	return AttachmentRule{
+		Type:    t,
+		MaxSize: min(t.MaxSize(), p.Plans.Plan(planType).MaxFileSize()),
+	}, nil
+}
+
+// TypeOfKey returns the MIME type and settings of the attachment type owning the extension of
+// the storage key, or false if no configured type uses that extension.
+func (p AttachmentPolicy) TypeOfKey(key string) (string, configs.AttachmentType, bool) {
+	ext := strings.ToLower(filepath.Ext(key))
+
+	for mimeType, t := range p.Types {
+		if slices.Contains(t.Extensions, ext) {
+			return mimeType, t, true
+		}
+	}
+
+	return "", configs.AttachmentType{}, false
 }
@@ -7,6 +7,7 @@ lifecycle, message communication loops (ReadPump and WritePump), and interaction
 package chat
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,8 +18,10 @@ import (
 	"github.com/rs/zerolog"
 
 	"hzchat/internal/app/user"
+	"hzchat/internal/configs"
 	"hzchat/internal/pkg/auth/jwt"
 	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/limiter"
 	"hzchat/internal/pkg/logx"
 )
 
@@ -33,7 +36,7 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 
 	// maximum allowed size (in bytes) of a message sent by the client.
-	maxMessageSize = 8192
+	maxMessageSize = configs.MaxInboundMessageBytes
 
 	// maximum allowed size (in bytes) for text message content.
 	MaxContentBytes = 5000
@@ -41,12 +44,22 @@ const (
 	// MaxAttachmentsCount defines the maximum number of attachments allowed per message.
 	MaxAttachmentsCount = 3
 
+	// MaxSlowModeSeconds is the longest slow mode interval a host can set.
+	MaxSlowModeSeconds = 600
+
 	// WsCloseCodeSessionKicked is a custom WebSocket Close Code (4000-4999 range)
 	// used to signal the client that the session was replaced by a new connection.
 	WsCloseCodeSessionKicked = 4001
 
+	// WsCloseCodeFloodDisconnect is a custom WebSocket Close Code used to signal the client
+	// that the connection was closed because of sustained message flooding.
+	WsCloseCodeFloodDisconnect = 4002
+
 	// TokenRefreshWindow defines how much time before the token expires we should attempt to refresh it.
 	TokenRefreshWindow = 2 * time.Minute
+
+	// PolicyWSMessage is the rate limit policy applied to every inbound WebSocket message.
+	PolicyWSMessage = "ws_message"
 )
 
 // Client struct represents an active WebSocket connection and its associated user.
@@ -55,12 +68,16 @@ type Client struct {
 	conn        *websocket.Conn // underlying WebSocket connection object.
 	user        user.User       // associated client user.
 	tokenExpiry time.Time       // tokenExpiry records the expiration time of the current JWT used by the client.
+	joinedAt    time.Time       // time the connection was established, used to pick the next host.
 	send        chan []byte     // a buffered channel used to queue messages waiting to be sent to the client.
+	flood       *floodGuard     // per-connection inbound limits, only accessed from ReadPump.
+	lease       *ConnLease      // connection slot counted against the per-IP and per-user caps.
 	logger      zerolog.Logger  // structured logger with client and room context.
 }
 
 // NewClient constructs and returns a new Client instance.
-func NewClient(room *Room, wsConn *websocket.Conn, user user.User, expiry time.Time) *Client {
+// The lease is released when the client disconnects.
+func NewClient(room *Room, wsConn *websocket.Conn, user user.User, expiry time.Time, lease *ConnLease) *Client {
 	clientLogger := logx.Logger().With().
 		Str("client_id", user.ID).
 		Str("room_code", room.Code).
@@ -71,7 +88,10 @@ func NewClient(room *Room, wsConn *websocket.Conn, user user.User, expiry time.T
 		conn:        wsConn,
 		user:        user,
 		tokenExpiry: expiry,
+		joinedAt:    time.Now(),
 		send:        make(chan []byte, 256),
+		flood:       newFloodGuard(room.floodPolicy),
+		lease:       lease,
 		logger:      clientLogger,
 	}
 }
@@ -101,10 +121,33 @@ func (c *Client) ReadPump() {
 			break
 		}
 
-		c.processInboundMessage(messageBytes)
+		if !c.processInboundMessage(messageBytes) {
+			break
+		}
 	}
 }
 
+// allowInbound checks the inbound message against the room's rate limit policy, which is shared
+// by all the connections of the user to the room. It runs after the connection's flood guard,
+// so frames the guard drops never cost a store round trip.
+func (c *Client) allowInbound() bool {
+	if c.room.services.RateLimiter == nil {
+		return true
+	}
+
+	decision := c.room.services.RateLimiter.Allow(context.Background(), PolicyWSMessage, limiter.Subject{
+		UserID:   c.user.ID,
+		RoomCode: c.room.Code,
+	})
+
+	if !decision.Allowed {
+		c.logger.Warn().Dur("retry_after", decision.RetryAfter).Msg("Client message rejected: Rate limit exceeded.")
+		return false
+	}
+
+	return true
+}
+
 // WritePump handles writing messages from the Client.send channel to the WebSocket connection.
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(pingPeriod)
@@ -136,7 +179,21 @@ func (c *Client) WritePump() {
 }
 
 // processInboundMessage handles raw byte messages received from the client.
-func (c *Client) processInboundMessage(messageBytes []byte) {
+// It returns false if the connection must be closed.
+func (c *Client) processInboundMessage(messageBytes []byte) bool {
+	now := time.Now()
+
+	// every frame counts against the flood limits, including frames that cannot be parsed
+	if verdict := c.flood.check(now, len(messageBytes)); verdict != floodAllow {
+		return c.rejectFlood(now, verdict, len(messageBytes))
+	}
+
+	// a flood spread over several connections is refused by the shared limit, and escalates
+	// on each of them like a local one
+	if !c.allowInbound() {
+		return c.rejectFlood(now, c.flood.strike(now), len(messageBytes))
+	}
+
 	var inboundMsg struct {
 		Type    MessageType     `json:"type"`
 		Payload json.RawMessage `json:"payload,omitempty"`
@@ -147,7 +204,13 @@ func (c *Client) processInboundMessage(messageBytes []byte) {
 		c.logger.Warn().Err(err).
 			Bytes("message_bytes", messageBytes).
 			Msg("Client sent invalid JSON")
-		return
+		return true
+	}
+
+	if inboundMsg.Type == TypeAttachments || inboundMsg.Type == TypeVoice {
+		if verdict := c.flood.checkAttachment(now); verdict != floodAllow {
+			return c.rejectFlood(now, verdict, len(messageBytes))
+		}
 	}
 
 	switch inboundMsg.Type {
@@ -157,9 +220,42 @@ func (c *Client) processInboundMessage(messageBytes []byte) {
 	case TypeAttachments:
 		c.handleAttachments(inboundMsg.Payload, inboundMsg.TempID)
 
+	case TypeVoice:
+		c.handleVoice(inboundMsg.Payload, inboundMsg.TempID)
+
+	case TypeUpdateRoomSettings:
+		c.handleUpdateRoomSettings(inboundMsg.Payload)
+
+	case TypeGallery:
+		c.handleGallery(inboundMsg.Payload, inboundMsg.TempID)
+
 	default:
 		c.logger.Warn().Str("msg_type", string(inboundMsg.Type)).Msg("Client sent unsupported message type")
 	}
+
+	return true
+}
+
+// rejectFlood drops an inbound message refused by flood protection and answers it with a
+// TypeError message. It returns false if the client has been disconnected for sustained abuse.
+func (c *Client) rejectFlood(now time.Time, verdict floodVerdict, size int) bool {
+	switch verdict {
+	case floodLimited:
+		c.SendError(errs.NewError(errs.ErrMessageRateLimited))
+
+	case floodMuted:
+		remaining := c.flood.muteRemaining(now)
+		c.logger.Warn().Dur("mute_remaining", remaining).Msg("Client muted for flooding.")
+		c.SendErrorWithRetry(errs.NewError(errs.ErrUserMuted), remaining)
+
+	case floodDisconnect:
+		c.closeWithCode(WsCloseCodeFloodDisconnect, "Disconnected for sending too many messages.")
+		return false
+	}
+
+	// drop the message but keep the connection open
+	c.logger.Debug().Int("size", size).Msg("Inbound message dropped by flood protection.")
+	return true
 }
 
 // handleText processes incoming text messages from the client.
@@ -181,8 +277,9 @@ func (c *Client) handleText(payloadBytes json.RawMessage, tempID string) {
 		return
 	}
 
-	c.sendConfirmation(tempID, broadcastMsg)
-	c.room.broadcast <- broadcastMsg
+	if !c.room.submit(c, broadcastMsg, tempID) {
+		c.SendError(errs.NewError(errs.ErrRoomBusy))
+	}
 }
 
 // handleAttachments processes incoming attachment messages from the client.
@@ -203,32 +300,264 @@ func (c *Client) handleAttachments(payloadBytes json.RawMessage, tempID string)
 		return
 	}
 
-	expectedKeyPrefix := fmt.Sprintf("%s/", c.room.Code)
+	maxSizes := make([]int64, len(attachmentsPayload.Attachments))
 
 	for i := range attachmentsPayload.Attachments {
 		a := &attachmentsPayload.Attachments[i]
 
-		if !strings.HasPrefix(a.Key, expectedKeyPrefix) {
-			c.SendError(errs.NewError(errs.ErrAttachmentKeyInvalid))
-			return
-		}
-
-		if err := ValidateFileType(a.Name, a.MimeType); err != nil {
+		maxSize, err := c.validateAttachment(*a, "")
+		if err != nil {
 			c.SendError(err)
 			return
 		}
+		maxSizes[i] = maxSize
 
+		// Meta is computed by the server during image processing
 		a.Meta = nil
 	}
 
+	// storage lookups run off the read loop; the result is delivered through the Room
+	go c.verifyAndSubmitAttachments(attachmentsPayload, tempID, maxSizes)
+}
+
+// handleVoice processes incoming voice messages from the client.
+func (c *Client) handleVoice(payloadBytes json.RawMessage, tempID string) {
+	var voicePayload VoicePayload
+	if err := json.Unmarshal(payloadBytes, &voicePayload); err != nil {
+		c.logger.Warn().Err(err).Msg("Client sent invalid VOICE payload")
+		return
+	}
+
+	maxSize, err := c.validateAttachment(voicePayload.Attachment, configs.CategoryVoice)
+	if err != nil {
+		c.SendError(err)
+		return
+	}
+
+	if err := ValidateVoice(voicePayload); err != nil {
+		c.SendError(err)
+		return
+	}
+
+	voicePayload.Attachment.Meta = nil
+
+	// storage lookups run off the read loop; the result is delivered through the Room
+	go c.verifyAndSubmitVoice(voicePayload, tempID, maxSize)
+}
+
+// validateAttachment checks that the attachment is stored under the room's prefix and is of a
+// type of the given category allowed in the room for the client's plan, and returns its size limit.
+func (c *Client) validateAttachment(a Attachment, category string) (int64, *errs.CustomError) {
+	if !strings.HasPrefix(a.Key, fmt.Sprintf("%s/", c.room.Code)) {
+		return 0, errs.NewError(errs.ErrAttachmentKeyInvalid)
+	}
+
+	rule, err := c.room.attachments.Resolve(a.Name, a.MimeType, c.room.Type, c.user.PlanType)
+	if err != nil {
+		return 0, err
+	}
+
+	if rule.Type.Category != category {
+		return 0, errs.NewError(errs.ErrAttachmentTypeNotAllowed)
+	}
+
+	if err := ValidateFileSizeLimit(a.Size, rule.MaxSize); err != nil {
+		return 0, err
+	}
+
+	return rule.MaxSize, nil
+}
+
+// verifyAttachments confirms every attachment against the stored object. It reports the first
+// failure to the client and returns false. maxSizes holds the size limit of each attachment.
+func (c *Client) verifyAttachments(attachments []Attachment, maxSizes []int64) bool {
+	verifyCtx, cancelVerify := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancelVerify()
+
+	for i, a := range attachments {
+		if err := c.room.services.Verifier.Verify(verifyCtx, a, maxSizes[i]); err != nil {
+			c.logger.Warn().Str("file_key", a.Key).Int("code", err.Code).Msg("Attachment verification failed")
+			c.room.reject(c, err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// verifyAndSubmitVoice confirms the recording against the stored object and submits the
+// voice message to the Room, or reports the failure to the client.
+func (c *Client) verifyAndSubmitVoice(voicePayload VoicePayload, tempID string, maxSize int64) {
+	if !c.verifyAttachments([]Attachment{voicePayload.Attachment}, []int64{maxSize}) {
+		return
+	}
+
+	broadcastMsg, err := NewMessage(TypeVoice, c.room.Code, c.user, voicePayload)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("Failed to create new voice message for broadcast")
+		return
+	}
+
+	c.confirmQuota([]Attachment{voicePayload.Attachment})
+	c.submitVerified(broadcastMsg, tempID, []Attachment{voicePayload.Attachment})
+}
+
+// verifyAndSubmitAttachments confirms every attachment against the stored object, runs
+// images through the metadata-stripping pipeline, and submits the message to the Room,
+// or reports the first failure to the client. maxSizes holds the size limit of each attachment.
+func (c *Client) verifyAndSubmitAttachments(attachmentsPayload AttachmentsPayload, tempID string, maxSizes []int64) {
+	if !c.verifyAttachments(attachmentsPayload.Attachments, maxSizes) {
+		return
+	}
+
+	processCtx, cancelProcess := context.WithTimeout(context.Background(), processTimeout)
+	defer cancelProcess()
+
+	// hashes holds the content hash of each image as uploaded, before processing
+	hashes := make([]string, len(attachmentsPayload.Attachments))
+
+	for i := range attachmentsPayload.Attachments {
+		a := &attachmentsPayload.Attachments[i]
+		if !IsImage(*a) {
+			continue
+		}
+
+		// a copy of a recently sent image has already been sanitized
+		if hash, ok := c.room.services.Contents.reuseImage(processCtx, a); ok {
+			hashes[i] = hash
+			continue
+		}
+
+		hash, err := c.room.services.Images.Process(processCtx, a)
+		if err != nil {
+			c.logger.Warn().Str("file_key", a.Key).Int("code", err.Code).Msg("Image processing failed")
+			c.room.reject(c, err)
+			return
+		}
+		hashes[i] = hash
+	}
+
 	broadcastMsg, err := NewMessage(TypeAttachments, c.room.Code, c.user, attachmentsPayload)
 	if err != nil {
 		c.logger.Error().Err(err).Msg("Failed to create new attachments message for broadcast")
 		return
 	}
 
-	c.sendConfirmation(tempID, broadcastMsg)
-	c.room.broadcast <- broadcastMsg
+	c.confirmQuota(attachmentsPayload.Attachments)
+	c.submitVerified(broadcastMsg, tempID, attachmentsPayload.Attachments)
+
+	// hashing downloads whole files, so it must not delay the broadcast
+	go c.indexContent(attachmentsPayload.Attachments, hashes)
+}
+
+// submitVerified submits a message whose attachments have been verified to the Room. If the Room
+// refuses it, the sender is told with ErrRoomBusy for its tempID, so it does not wait for a confirmation.
+func (c *Client) submitVerified(message Message, tempID string, attachments []Attachment) {
+	if c.room.submitWithAttachments(c, message, tempID, attachments) {
+		return
+	}
+
+	c.logger.Warn().Str("msg_type", string(message.Type)).Msg("Verified message dropped: Room inbound queue full or room stopped.")
+	c.room.rejectBusy(c, tempID)
+}
+
+// indexContent records the verified attachments in the content index, so that the client may send
+// them again to other rooms without uploading them. View-once attachments are never reused.
+// hashes holds the content hash of each attachment if already known.
+func (c *Client) indexContent(attachments []Attachment, hashes []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	index := c.room.services.Contents
+
+	for i, a := range attachments {
+		if a.ViewOnce {
+			continue
+		}
+
+		hash := hashes[i]
+		if hash == "" {
+			var ok bool
+			if hash, ok = index.HashObject(ctx, a); !ok {
+				continue
+			}
+		}
+
+		index.Add(c.user.ID, hash, c.room.Code, a)
+	}
+}
+
+// confirmQuota charges the stored size of the verified attachments to the room's upload quotas.
+func (c *Client) confirmQuota(attachments []Attachment) {
+	for _, a := range attachments {
+		c.room.services.Quotas.Confirm(c.room.Code, c.user.ID, a.Key, a.Size)
+	}
+}
+
+// viewOnceKeys returns the keys of the view-once attachments.
+func viewOnceKeys(attachments []Attachment) []string {
+	var keys []string
+	for _, a := range attachments {
+		if a.ViewOnce {
+			keys = append(keys, a.Key)
+		}
+	}
+
+	return keys
+}
+
+// handleGallery answers a request for a page of the room's shared files. The reply carries the
+// request's tempID so the client can match it.
+func (c *Client) handleGallery(payloadBytes json.RawMessage, tempID string) {
+	var request GalleryRequestPayload
+	if len(payloadBytes) > 0 {
+		if err := json.Unmarshal(payloadBytes, &request); err != nil {
+			c.SendError(errs.NewError(errs.ErrInvalidParams))
+			return
+		}
+	}
+
+	page, customErr := c.room.Gallery().Page(request.Cursor, request.Limit)
+	if customErr != nil {
+		c.SendError(customErr)
+		return
+	}
+
+	galleryMsg, err := NewMessage(TypeGallery, c.room.Code, SystemUser, page)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("Failed to build GALLERY message.")
+		return
+	}
+	galleryMsg.TempID = tempID
+
+	if err := c.sendMessage(galleryMsg); err != nil {
+		c.logger.Error().Err(err).Msg("Failed to send GALLERY message.")
+	}
+}
+
+// handleUpdateRoomSettings validates a settings change and forwards it to the Room,
+// which checks that the sender is the host before applying it.
+func (c *Client) handleUpdateRoomSettings(payloadBytes json.RawMessage) {
+	var settings RoomSettings
+	if err := json.Unmarshal(payloadBytes, &settings); err != nil {
+		c.logger.Warn().Err(err).Msg("Client sent invalid UPDATE_ROOM_SETTINGS payload")
+		return
+	}
+
+	if settings.SlowModeSeconds < 0 || settings.SlowModeSeconds > MaxSlowModeSeconds {
+		c.SendError(errs.NewError(errs.ErrInvalidParams))
+		return
+	}
+
+	updateMsg, err := NewMessage(TypeUpdateRoomSettings, c.room.Code, c.user, settings)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("Failed to create room settings update")
+		return
+	}
+
+	if !c.room.submit(c, updateMsg, "") {
+		c.SendError(errs.NewError(errs.ErrRoomBusy))
+	}
 }
 
 // writeQueuedMessage handles messages pulled from the send channel, writing them to the WebSocket.
@@ -290,7 +619,7 @@ func (c *Client) checkAndRefreshToken() {
 		secretKey := c.room.JWTSecret
 
 		// Generate the new token
-		tokenString, err := jwt.GenerateToken(payload, secretKey, jwt.RoomAccessExpiration)
+		tokenString, err := jwt.GenerateToken(payload, secretKey, jwt.AudienceRoom)
 		if err != nil {
 			c.logger.Error().Err(err).Msg("Failed to generate new token. Aborting refresh.")
 			return
@@ -354,6 +683,18 @@ func (c *Client) sendMessage(data any) error {
 
 // SendError constructs and sends a TypeError message to the client.
 func (c *Client) SendError(err error) {
+	c.SendErrorWithRetry(err, 0)
+}
+
+// SendErrorWithRetry constructs and sends a TypeError message that also tells the client
+// how long to wait before retrying, so it can render a countdown.
+func (c *Client) SendErrorWithRetry(err error, retryAfter time.Duration) {
+	c.sendError(err, retryAfter, "")
+}
+
+// sendError constructs and sends a TypeError message. A non-empty tempID ties the error
+// to the client message it answers.
+func (c *Client) sendError(err error, retryAfter time.Duration, tempID string) {
 	var code int
 	var message string
 
@@ -367,8 +708,9 @@ func (c *Client) SendError(err error) {
 	}
 
 	errorPayload := ErrorPayload{
-		Code:    code,
-		Message: message,
+		Code:         code,
+		Message:      message,
+		RetryAfterMs: retryAfter.Milliseconds(),
 	}
 
 	errorMsg, msgErr := NewMessage(
@@ -382,6 +724,7 @@ func (c *Client) SendError(err error) {
 		logx.Fatal(msgErr, "Failed to build error message in SendError")
 		return
 	}
+	errorMsg.TempID = tempID
 
 	if err := c.sendMessage(errorMsg); err != nil {
 		c.logger.Error().Err(err).Msg("Failed to queue error message")
@@ -469,6 +812,22 @@ func (c *Client) Kick(reason string) {
 	}
 }
 
+// closeWithCode sends a WebSocket Close Frame with the given custom close code.
+// WriteControl is safe to call concurrently with WritePump; the caller is expected
+// to stop reading afterwards so that cleanupOnDisconnect closes the connection.
+func (c *Client) closeWithCode(code int, reason string) {
+	c.logger.Warn().
+		Int("close_code", code).
+		Str("reason", reason).
+		Msg("Closing client connection.")
+
+	closeMessage := websocket.FormatCloseMessage(code, reason)
+
+	if err := c.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(writeWait)); err != nil {
+		c.logger.Warn().Err(err).Int("close_code", code).Msg("Failed to send WS Close Message.")
+	}
+}
+
 // cleanupOnDisconnect handles the necessary cleanup steps when the client's ReadPump terminates.
 func (c *Client) cleanupOnDisconnect() {
 	c.logger.Info().Msg("Client connection cleanup starting.")
@@ -484,4 +843,7 @@ func (c *Client) cleanupOnDisconnect() {
 	if err := c.conn.Close(); err != nil {
 		c.logger.Error().Err(err).Msg("Client connection close error")
 	}
+
+	// free the connection slot
+	c.lease.Release()
 }
@@ -0,0 +1,85 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the connection tracker used by the Manager to cap the number of
+simultaneous WebSocket connections held by a single client IP or user account.
+*/
+package chat
+
+import (
+	"sync"
+
+	"hzchat/internal/pkg/errs"
+)
+
+// connTracker counts live WebSocket connections per client IP and per user ID.
+type connTracker struct {
+	mu      sync.Mutex
+	byIP    map[string]int
+	byUser  map[string]int
+	maxIP   int
+	maxUser int
+}
+
+// ConnLease represents one live connection counted against the per-IP and per-user caps.
+// Release must be called exactly once when the connection ends; further calls are no-ops.
+type ConnLease struct {
+	tracker *connTracker
+	ip      string
+	userID  string
+	once    sync.Once
+}
+
+// newConnTracker creates a tracker with the given caps (0 disables a cap).
+func newConnTracker(maxIP, maxUser int) *connTracker {
+	return &connTracker{
+		byIP:    make(map[string]int),
+		byUser:  make(map[string]int),
+		maxIP:   maxIP,
+		maxUser: maxUser,
+	}
+}
+
+// acquire reserves a connection slot for the IP and user, or returns ErrTooManyConnections.
+func (t *connTracker) acquire(ip, userID string) (*ConnLease, *errs.CustomError) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.maxIP > 0 && t.byIP[ip] >= t.maxIP {
+		return nil, errs.NewError(errs.ErrTooManyConnections)
+	}
+
+	if t.maxUser > 0 && t.byUser[userID] >= t.maxUser {
+		return nil, errs.NewError(errs.ErrTooManyConnections)
+	}
+
+	t.byIP[ip]++
+	t.byUser[userID]++
+
+	return &ConnLease{tracker: t, ip: ip, userID: userID}, nil
+}
+
+// release frees the slot held by the lease, removing empty entries to keep the maps small.
+func (t *connTracker) release(ip, userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.byIP[ip]--; t.byIP[ip] <= 0 {
+		delete(t.byIP, ip)
+	}
+
+	if t.byUser[userID]--; t.byUser[userID] <= 0 {
+		delete(t.byUser, userID)
+	}
+}
+
+// Release frees the connection slot. It is safe to call on a nil lease and more than once.
+func (l *ConnLease) Release() {
+	if l == nil {
+		return
+	}
+
+	l.once.Do(func() {
+		l.tracker.release(l.ip, l.userID)
+	})
+}
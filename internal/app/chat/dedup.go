@@ -0,0 +1,211 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the ContentIndex, which remembers the content hash of the attachments each user
+has recently sent, so that re-sending the same file to another room is served by a server-side
+copy instead of a new upload. Hashes are computed by the server from the uploaded content and are
+scoped to the uploading user, so clients can neither poison the index nor probe other users' files.
+Copies of images are already sanitized: when they are sent, their metadata and thumbnail are taken
+from the original instead of processing the image again.
+*/
+package chat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"hzchat/internal/app/storage"
+)
+
+const (
+	// DedupTTL is how long a sent attachment may be reused by its uploader.
+	DedupTTL = 24 * time.Hour
+
+	// dedupMaxSize bounds the attachments hashed for deduplication, as hashing downloads the
+	// whole object. Larger files are always uploaded.
+	dedupMaxSize = MaxAttachmentSize
+)
+
+// contentHashPattern matches a hex-encoded SHA-256 digest.
+var contentHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ContentRef is a stored attachment that may be copied instead of uploaded again.
+type ContentRef struct {
+	Key      string
+	RoomCode string
+	MimeType string
+	Size     int64
+
+	// Meta is the server-computed metadata of the attachment, such as an image's ImageMeta.
+	Meta json.RawMessage
+
+	expiresAt time.Time
+}
+
+// contentCopy is an object created by ContentIndex.Copy, waiting to be sent.
+type contentCopy struct {
+	hash string
+	meta json.RawMessage
+}
+
+// ContentIndex maps the content hashes of recently sent attachments to their stored objects,
+// keyed by uploader and hash.
+type ContentIndex struct {
+	storage storage.StorageService
+
+	// mu protects concurrent access to the refs and copies maps.
+	mu     sync.Mutex
+	refs   map[string]ContentRef
+	copies map[string]contentCopy
+}
+
+// NewContentIndex creates an empty index of objects in the given storage.
+func NewContentIndex(store storage.StorageService) *ContentIndex {
+	return &ContentIndex{
+		storage: store,
+		refs:    make(map[string]ContentRef),
+		copies:  make(map[string]contentCopy),
+	}
+}
+
+// IsContentHash reports whether s is a hex-encoded SHA-256 digest as sent by clients.
+func IsContentHash(s string) bool {
+	return contentHashPattern.MatchString(s)
+}
+
+// HashContent returns the hex-encoded SHA-256 digest of data.
+func HashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Add records that the user sent the attachment, whose original content has the given hash.
+func (x *ContentIndex) Add(userID, hash string, roomCode string, a Attachment) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.refs[userID+":"+hash] = ContentRef{
+		Key:       a.Key,
+		RoomCode:  roomCode,
+		MimeType:  a.MimeType,
+		Size:      a.Size,
+		Meta:      a.Meta,
+		expiresAt: time.Now().Add(DedupTTL),
+	}
+}
+
+// Copy copies the user's recent attachment with the given content hash to key in roomCode, and
+// makes the copy the source of later copies, since the most recent room is likely to outlive
+// the others.
+func (x *ContentIndex) Copy(ctx context.Context, userID, hash string, ref ContentRef, roomCode, key string) error {
+	if err := x.storage.Copy(ctx, ref.Key, key); err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	x.copies[key] = contentCopy{hash: hash, meta: ref.Meta}
+	x.mu.Unlock()
+
+	x.Add(userID, hash, roomCode, Attachment{Key: key, MimeType: ref.MimeType, Size: ref.Size, Meta: ref.Meta})
+
+	return nil
+}
+
+// reuseImage fills the Meta of an image attachment copied by Copy from the original's, and copies
+// the original's thumbnail next to it unless the attachment is view-once, so that the sanitized
+// copy is not processed again. It returns the content hash of the image, and false for other
+// attachments or if the original's thumbnail is gone.
+func (x *ContentIndex) reuseImage(ctx context.Context, a *Attachment) (string, bool) {
+	x.mu.Lock()
+	cp, ok := x.copies[a.Key]
+	x.mu.Unlock()
+
+	var meta ImageMeta
+	if !ok || json.Unmarshal(cp.meta, &meta) != nil || meta.Width == 0 {
+		return "", false
+	}
+
+	switch {
+	case a.ViewOnce:
+		meta.ThumbnailKey = ""
+	case meta.ThumbnailKey != "":
+		thumbnailKey := strings.TrimSuffix(a.Key, path.Ext(a.Key)) + ".thumb" + path.Ext(meta.ThumbnailKey)
+		if err := x.storage.Copy(ctx, meta.ThumbnailKey, thumbnailKey); err != nil {
+			return "", false
+		}
+		meta.ThumbnailKey = thumbnailKey
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return "", false
+	}
+	a.Meta = data
+
+	return cp.hash, true
+}
+
+// Lookup returns the user's recent attachment with the given content hash and MIME type.
+func (x *ContentIndex) Lookup(userID, hash, mimeType string) (ContentRef, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	ref, ok := x.refs[userID+":"+hash]
+	if !ok {
+		return ContentRef{}, false
+	}
+
+	if time.Now().After(ref.expiresAt) {
+		delete(x.refs, userID+":"+hash)
+		return ContentRef{}, false
+	}
+
+	return ref, ref.MimeType == mimeType
+}
+
+// Forget removes the user's entry for the hash, e.g. once its object turned out to be gone.
+func (x *ContentIndex) Forget(userID, hash string) {
+	x.mu.Lock()
+	delete(x.refs, userID+":"+hash)
+	x.mu.Unlock()
+}
+
+// HashObject downloads the attachment and returns the hash of its content. It returns false
+// for attachments too large to be deduplicated or that cannot be read.
+func (x *ContentIndex) HashObject(ctx context.Context, a Attachment) (string, bool) {
+	if a.Size > dedupMaxSize {
+		return "", false
+	}
+
+	data, err := x.storage.Get(ctx, a.Key, dedupMaxSize)
+	if err != nil {
+		return "", false
+	}
+
+	return HashContent(data), true
+}
+
+// RemoveRoom forgets the attachments stored in a closed room, which are purged from storage.
+func (x *ContentIndex) RemoveRoom(roomCode string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for id, ref := range x.refs {
+		if ref.RoomCode == roomCode {
+			delete(x.refs, id)
+		}
+	}
+
+	for key := range x.copies {
+		if strings.HasPrefix(key, roomCode+"/") {
+			delete(x.copies, key)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the DownloadLog, which keeps the presigned download URLs recently issued in a
+room so that repeated requests reuse them, and counts the downloads of every file for the host.
+The log is privacy-preserving: it keeps no timestamps, and downloaders are only counted through
+hashes salted with a random per-room secret that is discarded with the room.
+*/
+package chat
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DownloadURLReuse is how long a presigned download URL is handed out again to the same
+	// user for the same file. It is shorter than PresignedURLDuration, so a reused URL stays
+	// valid for the rest of the difference.
+	DownloadURLReuse = 2 * time.Minute
+
+	// downloadURLPruneSize is the number of cached URLs above which expired ones are dropped.
+	downloadURLPruneSize = 256
+)
+
+// DownloadStat reports how many times a file was downloaded, and by how many participants.
+type DownloadStat struct {
+	Key         string `json:"fileKey"`
+	Downloads   int    `json:"downloads"`
+	Downloaders int    `json:"downloaders"`
+}
+
+// cachedURL is a presigned download URL that may be reused until expiresAt.
+type cachedURL struct {
+	url       string
+	expiresAt time.Time
+}
+
+// downloadCount is the access log of a single file.
+type downloadCount struct {
+	downloads   int
+	downloaders map[string]struct{}
+}
+
+// DownloadLog holds the download URL cache and access counts of a single room.
+type DownloadLog struct {
+	salt []byte
+
+	// mu protects concurrent access to the urls and counts maps.
+	mu     sync.Mutex
+	urls   map[string]cachedURL
+	counts map[string]*downloadCount
+}
+
+// newDownloadLog creates an empty log with a fresh salt.
+func newDownloadLog() *DownloadLog {
+	salt := make([]byte, 32)
+	_, _ = rand.Read(salt)
+
+	return &DownloadLog{
+		salt:   salt,
+		urls:   make(map[string]cachedURL),
+		counts: make(map[string]*downloadCount),
+	}
+}
+
+// CachedURL returns the download URL recently issued to the user for the file under the
+// given download name, if it may still be reused.
+func (l *DownloadLog) CachedURL(userID, key, name string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cached, ok := l.urls[urlCacheKey(userID, key, name)]
+	if !ok || time.Now().After(cached.expiresAt) {
+		return "", false
+	}
+
+	return cached.url, true
+}
+
+// CacheURL remembers a download URL issued to the user, to be reused for DownloadURLReuse.
+func (l *DownloadLog) CacheURL(userID, key, name, url string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	if len(l.urls) >= downloadURLPruneSize {
+		for id, cached := range l.urls {
+			if now.After(cached.expiresAt) {
+				delete(l.urls, id)
+			}
+		}
+	}
+
+	l.urls[urlCacheKey(userID, key, name)] = cachedURL{url: url, expiresAt: now.Add(DownloadURLReuse)}
+}
+
+// Record counts a download of the file by the user.
+func (l *DownloadLog) Record(userID, key string) {
+	mac := hmac.New(sha256.New, l.salt)
+	mac.Write([]byte(userID))
+	downloader := hex.EncodeToString(mac.Sum(nil)[:16])
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count, ok := l.counts[key]
+	if !ok {
+		count = &downloadCount{downloaders: make(map[string]struct{})}
+		l.counts[key] = count
+	}
+
+	count.downloads++
+	count.downloaders[downloader] = struct{}{}
+}
+
+// Stats returns the download counts of every downloaded file, most downloaded first.
+func (l *DownloadLog) Stats() []DownloadStat {
+	l.mu.Lock()
+	stats := make([]DownloadStat, 0, len(l.counts))
+	for key, count := range l.counts {
+		stats = append(stats, DownloadStat{Key: key, Downloads: count.downloads, Downloaders: len(count.downloaders)})
+	}
+	l.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Downloads != stats[j].Downloads {
+			return stats[i].Downloads > stats[j].Downloads
+		}
+		return stats[i].Key < stats[j].Key
+	})
+
+	return stats
+}
+
+// urlCacheKey builds the cache key of a download URL; the name selects the Content-Disposition.
+func urlCacheKey(userID, key, name string) string {
+	return userID + "\x00" + key + "\x00" + name
+}
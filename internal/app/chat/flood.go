@@ -0,0 +1,116 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the floodGuard, which applies per-connection token buckets for messages,
+bytes and attachment messages, and escalates sustained abuse from rejection to a temporary
+mute and finally a disconnect.
+*/
+package chat
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"hzchat/internal/configs"
+)
+
+// floodVerdict is the outcome of a floodGuard check.
+type floodVerdict int
+
+const (
+	// floodAllow means the message may be processed.
+	floodAllow floodVerdict = iota
+
+	// floodLimited means the message exceeded a bucket and is dropped.
+	floodLimited
+
+	// floodMuted means the client is (or has just been) muted and the message is dropped.
+	floodMuted
+
+	// floodDisconnect means the client exceeded the maximum number of mutes and must be disconnected.
+	floodDisconnect
+)
+
+// floodGuard tracks the inbound traffic of a single connection. It is only used from the client's ReadPump goroutine.
+type floodGuard struct {
+	policy configs.FloodPolicy
+
+	messages    *rate.Limiter
+	bytes       *rate.Limiter
+	attachments *rate.Limiter
+
+	strikes    int
+	mutes      int
+	mutedUntil time.Time
+}
+
+// newFloodGuard creates a floodGuard configured by the room type's flood policy.
+func newFloodGuard(policy configs.FloodPolicy) *floodGuard {
+	return &floodGuard{
+		policy:      policy,
+		messages:    rate.NewLimiter(rate.Limit(policy.MessageRate), policy.MessageBurst),
+		bytes:       rate.NewLimiter(rate.Limit(policy.ByteRate), policy.ByteBurst),
+		attachments: rate.NewLimiter(rate.Limit(policy.AttachmentRate), policy.AttachmentBurst),
+	}
+}
+
+// check records an inbound message of the given size against the message and byte buckets
+// and returns the verdict. It runs on every frame, before the frame is parsed.
+// Messages sent while muted count as strikes, so continued flooding extends the mute
+// and eventually leads to a disconnect.
+func (g *floodGuard) check(now time.Time, size int) floodVerdict {
+	if now.Before(g.mutedUntil) {
+		return g.strike(now)
+	}
+
+	if !g.messages.AllowN(now, 1) || !g.bytes.AllowN(now, size) {
+		return g.strike(now)
+	}
+
+	return floodAllow
+}
+
+// checkAttachment records an attachment or voice message against the attachment bucket
+// and returns the verdict. It runs after check has allowed the message.
+func (g *floodGuard) checkAttachment(now time.Time) floodVerdict {
+	if !g.attachments.AllowN(now, 1) {
+		return g.strike(now)
+	}
+
+	return floodAllow
+}
+
+// strike registers a violation and escalates to a mute or disconnect when thresholds are reached.
+func (g *floodGuard) strike(now time.Time) floodVerdict {
+	g.strikes++
+
+	if g.strikes < g.policy.MuteAfter {
+		if now.Before(g.mutedUntil) {
+			return floodMuted
+		}
+		return floodLimited
+	}
+
+	g.strikes = 0
+	g.mutes++
+
+	if g.mutes > g.policy.DisconnectAfter {
+		return floodDisconnect
+	}
+
+	g.mutedUntil = now.Add(g.muteDuration())
+	return floodMuted
+}
+
+// muteRemaining returns how long the client stays muted.
+func (g *floodGuard) muteRemaining(now time.Time) time.Duration {
+	if now.Before(g.mutedUntil) {
+		return g.mutedUntil.Sub(now)
+	}
+	return 0
+}
+
+func (g *floodGuard) muteDuration() time.Duration {
+	return time.Duration(g.policy.MuteSeconds) * time.Second
+}
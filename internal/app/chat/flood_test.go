@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"hzchat/internal/configs"
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/limiter"
+)
+
+// testFloodPolicy allows two messages at once and never refills within a test.
+var testFloodPolicy = configs.FloodPolicy{
+	MessageRate: 0.001, MessageBurst: 2,
+	ByteRate: 0.001, ByteBurst: configs.MaxInboundMessageBytes,
+	AttachmentRate: 0.001, AttachmentBurst: 1,
+	MuteAfter: 2, MuteSeconds: 60, DisconnectAfter: 1,
+}
+
+func TestFloodGuardEscalates(t *testing.T) {
+	g := newFloodGuard(testFloodPolicy)
+	now := time.Now()
+
+	want := []floodVerdict{floodAllow, floodAllow, floodLimited, floodMuted, floodMuted, floodDisconnect}
+	for i, verdict := range want {
+		if got := g.check(now, 10); got != verdict {
+			t.Fatalf("message %d: got verdict %d, want %d", i+1, got, verdict)
+		}
+	}
+}
+
+func TestFloodGuardAttachments(t *testing.T) {
+	g := newFloodGuard(testFloodPolicy)
+	now := time.Now()
+
+	if g.check(now, 10) != floodAllow || g.checkAttachment(now) != floodAllow {
+		t.Fatalf("first attachment was not allowed")
+	}
+	if g.check(now, 10) != floodAllow {
+		t.Fatalf("second message was not allowed")
+	}
+	if got := g.checkAttachment(now); got != floodLimited {
+		t.Fatalf("second attachment: got verdict %d, want %d", got, floodLimited)
+	}
+}
+
+func TestFloodGuardAllowsMaximumSizeMessage(t *testing.T) {
+	g := newFloodGuard(testFloodPolicy)
+
+	if got := g.check(time.Now(), maxMessageSize); got != floodAllow {
+		t.Fatalf("maximum size message: got verdict %d, want %d", got, floodAllow)
+	}
+}
+
+func TestMalformedFramesCountAgainstFloodLimits(t *testing.T) {
+	room := newTestRoom(t, testFloodPolicy)
+	client := newTestClient(room, "alice")
+	garbage := bytes.Repeat([]byte("{"), 100)
+
+	// malformed frames within the limits are dropped silently
+	for i := 0; i < 2; i++ {
+		if !client.processInboundMessage(garbage) {
+			t.Fatalf("frame %d closed the connection", i+1)
+		}
+	}
+	expectNoMessage(t, client)
+
+	if !client.processInboundMessage(garbage) {
+		t.Fatalf("limited frame closed the connection")
+	}
+	if e := nextError(t, client); e.Code != errs.ErrMessageRateLimited {
+		t.Fatalf("limited frame: got code %d, want %d", e.Code, errs.ErrMessageRateLimited)
+	}
+
+	if !client.processInboundMessage(garbage) {
+		t.Fatalf("muting frame closed the connection")
+	}
+	e := nextError(t, client)
+	if e.Code != errs.ErrUserMuted || e.RetryAfterMs <= 0 || e.RetryAfterMs > 60_000 {
+		t.Fatalf("muting frame: got %+v", e)
+	}
+}
+
+func TestLimitedMessagesAreNotProcessed(t *testing.T) {
+	room := newTestRoom(t, testFloodPolicy)
+	client := newTestClient(room, "alice")
+	text := []byte(`{"type":"TEXT","payload":{"content":"hi"},"tempID":"t"}`)
+
+	for i := 0; i < 3; i++ {
+		client.processInboundMessage(text)
+	}
+
+	if queued := len(room.inbound); queued != 2 {
+		t.Fatalf("got %d messages submitted to the room, want 2", queued)
+	}
+	if e := nextError(t, client); e.Code != errs.ErrMessageRateLimited {
+		t.Fatalf("got code %d, want %d", e.Code, errs.ErrMessageRateLimited)
+	}
+}
+
+func TestFloodSpreadOverConnectionsEscalates(t *testing.T) {
+	generous := testFloodPolicy
+	generous.MessageBurst = 100
+
+	room := newTestRoom(t, generous)
+	store, err := limiter.NewStore(limiter.StoreConfig{Driver: limiter.StoreMemory})
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	room.services.RateLimiter = limiter.New([]limiter.Policy{
+		{Name: PolicyWSMessage, Rate: 0.001, Burst: 2, Keys: []limiter.KeyPart{limiter.KeyUser, limiter.KeyRoom}},
+	}, store)
+
+	// two connections of the same user, each well within its own flood limits
+	first, second := newTestClient(room, "alice"), newTestClient(room, "alice")
+	text := []byte(`{"type":"TEXT","payload":{"content":"hi"},"tempID":"t"}`)
+
+	for _, c := range []*Client{first, second} {
+		c.processInboundMessage(text)
+		expectNoMessage(t, c)
+	}
+
+	// the shared limit refuses further messages, with the flood guard's codes and escalation
+	first.processInboundMessage(text)
+	if e := nextError(t, first); e.Code != errs.ErrMessageRateLimited {
+		t.Fatalf("limited message: got code %d, want %d", e.Code, errs.ErrMessageRateLimited)
+	}
+	first.processInboundMessage(text)
+	if e := nextError(t, first); e.Code != errs.ErrUserMuted {
+		t.Fatalf("muting message: got code %d, want %d", e.Code, errs.ErrUserMuted)
+	}
+
+	if queued := len(room.inbound); queued != 2 {
+		t.Fatalf("got %d messages submitted to the room, want 2", queued)
+	}
+}
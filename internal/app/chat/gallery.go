@@ -0,0 +1,136 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the Gallery, which lists the attachments shared in a room while it lives, so
+that participants who join late can find earlier files. Only the metadata is kept; the files
+themselves are downloaded through the regular presigned download flow.
+*/
+package chat
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+
+	"hzchat/internal/app/user"
+	"hzchat/internal/pkg/errs"
+)
+
+const (
+	// DefaultGalleryPageSize is the number of files returned per page when the client sets no limit.
+	DefaultGalleryPageSize = 50
+
+	// MaxGalleryPageSize is the largest number of files returned per page.
+	MaxGalleryPageSize = 100
+
+	// galleryMaxItems bounds the files remembered per room; the oldest are dropped first.
+	galleryMaxItems = 1000
+)
+
+// GalleryItem is a file shared in the room.
+type GalleryItem struct {
+	Key       string          `json:"fileKey"`
+	Name      string          `json:"fileName"`
+	MimeType  string          `json:"mimeType"`
+	Size      int64           `json:"fileSize"`
+	Meta      json.RawMessage `json:"meta,omitempty"`
+	Sender    user.User       `json:"sender"`
+	MessageID string          `json:"messageId"`
+
+	// Timestamp is the time the file was sent (in UTC milliseconds).
+	Timestamp int64 `json:"timestamp"`
+
+	// seq orders the items and serves as the paging cursor.
+	seq int64
+}
+
+// GalleryPage is a page of the gallery, newest files first.
+type GalleryPage struct {
+	Files []GalleryItem `json:"files"`
+
+	// NextCursor requests the next, older page; it is empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// GalleryRequestPayload is the payload structure for a TypeGallery request.
+type GalleryRequestPayload struct {
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// Gallery holds the files shared in a single room.
+type Gallery struct {
+	// mu protects concurrent access to the items, which are read by HTTP handlers.
+	mu      sync.RWMutex
+	items   []GalleryItem
+	nextSeq int64
+}
+
+// add records the attachments of a broadcast message. View-once attachments are left out,
+// since each recipient may only download them once.
+func (g *Gallery) add(message Message, attachments []Attachment) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, a := range attachments {
+		if a.ViewOnce {
+			continue
+		}
+
+		g.nextSeq++
+		g.items = append(g.items, GalleryItem{
+			Key:       a.Key,
+			Name:      a.Name,
+			MimeType:  a.MimeType,
+			Size:      a.Size,
+			Meta:      a.Meta,
+			Sender:    message.Sender,
+			MessageID: message.ID,
+			Timestamp: message.Timestamp,
+			seq:       g.nextSeq,
+		})
+	}
+
+	if excess := len(g.items) - galleryMaxItems; excess > 0 {
+		g.items = append([]GalleryItem(nil), g.items[excess:]...)
+	}
+}
+
+// Page returns up to limit files older than the cursor, newest first. An empty cursor starts
+// from the newest file, and a limit of 0 selects DefaultGalleryPageSize.
+func (g *Gallery) Page(cursor string, limit int) (GalleryPage, *errs.CustomError) {
+	if limit < 0 {
+		return GalleryPage{}, errs.NewError(errs.ErrInvalidParams)
+	}
+	if limit == 0 {
+		limit = DefaultGalleryPageSize
+	}
+	limit = min(limit, MaxGalleryPageSize)
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	// end is the index of the first item at or after the cursor
+	end := len(g.items)
+	if cursor != "" {
+		before, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || before <= 0 {
+			return GalleryPage{}, errs.NewError(errs.ErrInvalidParams)
+		}
+		end = sort.Search(len(g.items), func(i int) bool { return g.items[i].seq >= before })
+	}
+
+	start := max(end-limit, 0)
+
+	page := GalleryPage{Files: make([]GalleryItem, 0, end-start)}
+	for i := end - 1; i >= start; i-- {
+		page.Files = append(page.Files, g.items[i])
+	}
+
+	if start > 0 {
+		page.NextCursor = strconv.FormatInt(g.items[start].seq, 10)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"strconv"
+	"testing"
+
+	"hzchat/internal/pkg/errs"
+)
+
+// newTestGallery returns a gallery holding n files with sequence numbers 1 to n.
+func newTestGallery(n int) *Gallery {
+	g := &Gallery{}
+	for i := 1; i <= n; i++ {
+		g.add(Message{ID: "m" + strconv.Itoa(i)}, []Attachment{{Key: "ABC123/" + strconv.Itoa(i)}})
+	}
+	return g
+}
+
+// seqs returns the sequence numbers of the files of a page.
+func seqs(page GalleryPage) []int64 {
+	out := make([]int64, len(page.Files))
+	for i, f := range page.Files {
+		out[i] = f.seq
+	}
+	return out
+}
+
+func TestGalleryPage(t *testing.T) {
+	tests := []struct {
+		name       string
+		items      int
+		cursor     string
+		limit      int
+		wantFirst  int64
+		wantCount  int
+		wantCursor string
+	}{
+		{name: "empty gallery", items: 0, wantCount: 0},
+		{name: "default limit", items: 120, wantFirst: 120, wantCount: DefaultGalleryPageSize, wantCursor: "71"},
+		{name: "limit capped", items: 150, limit: 500, wantFirst: 150, wantCount: MaxGalleryPageSize, wantCursor: "51"},
+		{name: "exact fit", items: 3, limit: 3, wantFirst: 3, wantCount: 3},
+		{name: "cursor", items: 10, cursor: "6", limit: 2, wantFirst: 5, wantCount: 2, wantCursor: "4"},
+		{name: "last page", items: 10, cursor: "3", limit: 5, wantFirst: 2, wantCount: 2},
+		{name: "cursor at oldest", items: 10, cursor: "1", limit: 5, wantCount: 0},
+		{name: "cursor past newest", items: 10, cursor: "99", limit: 4, wantFirst: 10, wantCount: 4, wantCursor: "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := newTestGallery(tt.items).Page(tt.cursor, tt.limit)
+			if err != nil {
+				t.Fatalf("page: %v", err)
+			}
+
+			got := seqs(page)
+			if len(got) != tt.wantCount || page.NextCursor != tt.wantCursor {
+				t.Fatalf("got %v with cursor %q, want %d files with cursor %q", got, page.NextCursor, tt.wantCount, tt.wantCursor)
+			}
+			for i, seq := range got {
+				if seq != tt.wantFirst-int64(i) {
+					t.Fatalf("got %v, want newest first from %d", got, tt.wantFirst)
+				}
+			}
+		})
+	}
+}
+
+func TestGalleryPageRejectsInvalidParams(t *testing.T) {
+	g := newTestGallery(5)
+
+	tests := []struct {
+		cursor string
+		limit  int
+	}{
+		{cursor: "", limit: -1},
+		{cursor: "abc", limit: 10},
+		{cursor: "0", limit: 10},
+		{cursor: "-3", limit: 10},
+		{cursor: "1.5", limit: 10},
+	}
+
+	for _, tt := range tests {
+		if _, err := g.Page(tt.cursor, tt.limit); err == nil || err.Code != errs.ErrInvalidParams {
+			t.Fatalf("cursor %q, limit %d: got %v, want ErrInvalidParams", tt.cursor, tt.limit, err)
+		}
+	}
+}
+
+func TestGalleryPagesCoverEveryFileOnce(t *testing.T) {
+	g := newTestGallery(23)
+
+	var cursor string
+	want := int64(23)
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging did not terminate")
+		}
+
+		page, err := g.Page(cursor, 5)
+		if err != nil {
+			t.Fatalf("page: %v", err)
+		}
+		for _, seq := range seqs(page) {
+			if seq != want {
+				t.Fatalf("got file %d, want %d", seq, want)
+			}
+			want--
+		}
+
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+
+	if want != 0 {
+		t.Fatalf("paging stopped before file %d", want)
+	}
+}
+
+func TestGalleryDropsOldestAndViewOnceFiles(t *testing.T) {
+	g := newTestGallery(galleryMaxItems + 10)
+	g.add(Message{ID: "secret"}, []Attachment{{Key: "ABC123/secret", ViewOnce: true}})
+
+	if len(g.items) != galleryMaxItems {
+		t.Fatalf("got %d items, want %d", len(g.items), galleryMaxItems)
+	}
+	if g.items[0].seq != 11 || g.items[len(g.items)-1].Key == "ABC123/secret" {
+		t.Fatalf("got items %d to %s", g.items[0].seq, g.items[len(g.items)-1].Key)
+	}
+
+	// a cursor into the dropped files returns an empty last page
+	page, err := g.Page("5", 10)
+	if err != nil || len(page.Files) != 0 || page.NextCursor != "" {
+		t.Fatalf("cursor into dropped files: got %v, %v", seqs(page), err)
+	}
+}
@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"hzchat/internal/app/user"
+	"hzchat/internal/configs"
+)
+
+// newTestRoom creates a group room that is not running; tests drive its handlers directly.
+func newTestRoom(t *testing.T, flood configs.FloodPolicy) *Room {
+	t.Helper()
+
+	return NewRoom(RoomConfig{
+		Code:        "ABC123",
+		Type:        RoomTypeGroup,
+		MaxClients:  GroupMaxClients,
+		FloodPolicy: flood,
+	}, make(chan RoomCleanupMsg, 1), &RoomServices{})
+}
+
+// newTestClient creates a client without a connection whose queued messages the test reads
+// with nextMessage.
+func newTestClient(room *Room, id string) *Client {
+	return NewClient(room, nil, user.User{ID: id, Nickname: id}, time.Now().Add(time.Hour), nil)
+}
+
+// nextMessage returns the next message queued for the client, failing if there is none.
+func nextMessage(t *testing.T, c *Client) Message {
+	t.Helper()
+
+	select {
+	case data := <-c.send:
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("decode queued message: %v", err)
+		}
+		return msg
+	default:
+		t.Fatalf("no message queued for %s", c.user.ID)
+		return Message{}
+	}
+}
+
+// nextError returns the payload of the next message queued for the client, which must be a TypeError.
+func nextError(t *testing.T, c *Client) ErrorPayload {
+	t.Helper()
+
+	return errorPayload(t, nextMessage(t, c))
+}
+
+// errorPayload decodes the payload of a TypeError message.
+func errorPayload(t *testing.T, msg Message) ErrorPayload {
+	t.Helper()
+
+	if msg.Type != TypeError {
+		t.Fatalf("got %s message, want %s", msg.Type, TypeError)
+	}
+
+	var payload ErrorPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		t.Fatalf("decode error payload: %v", err)
+	}
+	return payload
+}
+
+// expectNoMessage fails if a message is queued for the client.
+func expectNoMessage(t *testing.T, c *Client) {
+	t.Helper()
+
+	select {
+	case data := <-c.send:
+		t.Fatalf("unexpected message queued for %s: %s", c.user.ID, data)
+	default:
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the ImageProcessor, which strips metadata (EXIF, GPS, camera data) from
+verified image attachments, writes the sanitized original and a thumbnail back to storage,
+and fills the attachment's Meta with server-computed values.
+*/
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"hzchat/internal/app/storage"
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/imagex"
+	"hzchat/internal/pkg/logx"
+)
+
+// processTimeout bounds the download, re-encoding and upload of a single message's images.
+const processTimeout = 30 * time.Second
+
+// ImageMeta is the server-computed metadata attached to image attachments.
+type ImageMeta struct {
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	ThumbnailKey string `json:"thumbnailKey,omitempty"`
+}
+
+// ImageProcessor sanitizes uploaded images. Decoding is CPU and memory heavy,
+// so the number of images processed concurrently is bounded.
+type ImageProcessor struct {
+	storage  storage.StorageService
+	verifier *AttachmentVerifier
+	slots    chan struct{}
+}
+
+// NewImageProcessor creates an ImageProcessor writing to the given storage. Sanitized originals
+// are written through the verifier, which expects their new version.
+func NewImageProcessor(store storage.StorageService, verifier *AttachmentVerifier) *ImageProcessor {
+	return &ImageProcessor{
+		storage:  store,
+		verifier: verifier,
+		slots:    make(chan struct{}, runtime.NumCPU()),
+	}
+}
+
+// IsImage reports whether the attachment is handled by the image pipeline.
+func IsImage(a Attachment) bool {
+	return strings.HasPrefix(baseMIMEType(a.MimeType), "image/")
+}
+
+// Process replaces the stored object with a metadata-free re-encoding, uploads a thumbnail
+// next to it (except for view-once images), and updates the attachment's Size and Meta accordingly.
+// It returns the content hash of the uploaded image. The attachment must already have been verified.
+func (p *ImageProcessor) Process(ctx context.Context, a *Attachment) (string, *errs.CustomError) {
+	select {
+	case p.slots <- struct{}{}:
+		defer func() { <-p.slots }()
+	case <-ctx.Done():
+		return "", errs.NewError(errs.ErrRoomBusy)
+	}
+
+	data, err := p.storage.Get(ctx, a.Key, a.Size)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			return "", errs.NewError(errs.ErrAttachmentNotFound)
+		case errors.Is(err, storage.ErrTooLarge):
+			return "", errs.NewError(errs.ErrFileSizeTooLarge)
+		}
+		logx.Error(err, "Failed to download attachment for processing", "file_key", a.Key)
+		return "", errs.NewError(errs.ErrFileStorageFailed)
+	}
+
+	result, err := imagex.Process(data, baseMIMEType(a.MimeType))
+	if err != nil {
+		logx.Warn("Failed to process image attachment", "file_key", a.Key, "error", err.Error())
+		if errors.Is(err, imagex.ErrTooLarge) {
+			return "", errs.NewError(errs.ErrFileSizeTooLarge)
+		}
+		return "", errs.NewError(errs.ErrAttachmentContentInvalid)
+	}
+
+	// a thumbnail would outlive a view-once image and could be downloaded repeatedly
+	var thumbnailKey string
+	if !a.ViewOnce {
+		thumbnailKey = thumbnailKeyFor(a.Key, result.Thumbnail.ContentType)
+
+		if err := p.storage.Put(ctx, thumbnailKey, result.Thumbnail.Data, result.Thumbnail.ContentType); err != nil {
+			logx.Error(err, "Failed to upload thumbnail", "file_key", thumbnailKey)
+			return "", errs.NewError(errs.ErrFileStorageFailed)
+		}
+	}
+
+	if err := p.verifier.Rewrite(ctx, a.Key, result.Original.Data, result.Original.ContentType); err != nil {
+		logx.Error(err, "Failed to upload sanitized image", "file_key", a.Key)
+		return "", errs.NewError(errs.ErrFileStorageFailed)
+	}
+
+	meta, err := json.Marshal(ImageMeta{
+		Width:        result.Original.Width,
+		Height:       result.Original.Height,
+		ThumbnailKey: thumbnailKey,
+	})
+	if err != nil {
+		return "", errs.NewError(errs.ErrUnknown)
+	}
+
+	a.Size = int64(len(result.Original.Data))
+	a.Meta = meta
+
+	return HashContent(data), nil
+}
+
+// thumbnailKeyFor derives the thumbnail key from the original key, e.g.
+// "ROOM/uuid.png" becomes "ROOM/uuid.thumb.jpg" for an opaque image.
+func thumbnailKeyFor(key string, contentType string) string {
+	ext := ".jpg"
+	if contentType == "image/png" {
+		ext = ".png"
+	}
+
+	return strings.TrimSuffix(key, path.Ext(key)) + ".thumb" + ext
+}
@@ -11,11 +11,22 @@ import (
 
 	"github.com/rs/zerolog"
 
+	"hzchat/internal/app/storage"
 	"hzchat/internal/configs"
 	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/limiter"
 	"hzchat/internal/pkg/logx"
 )
 
+// ManagerDeps holds the external services the Manager and its Rooms depend on.
+type ManagerDeps struct {
+	RateLimiter    *limiter.Limiter
+	PrivateStorage storage.StorageService
+
+	// Scanner scans uploaded attachments for malware; nil disables scanning.
+	Scanner AttachmentScanner
+}
+
 // Manager struct is responsible for coordinating and managing all active chat rooms.
 type Manager struct {
 	// rooms stores a map of all Room instances, keyed by RoomCode.
@@ -24,12 +35,28 @@ type Manager struct {
 	// Config holds the application's read-only configuration settings.
 	config *configs.AppConfig
 
+	// services holds the shared services handed to every Room.
+	services *RoomServices
+
+	// purger deletes the attachments of rooms after they close.
+	purger *attachmentPurger
+
+	// uploads tracks the in-progress multipart uploads of all rooms.
+	uploads *UploadSessions
+
+	// conns counts live WebSocket connections per client IP and per user.
+	conns *connTracker
+
 	// mu protects concurrent access to the rooms map.
 	mu sync.RWMutex
 
 	// the channel used by Rooms to notify the Manager to clean up and remove them.
 	cleanup chan RoomCleanupMsg
 
+	// done is closed on shutdown to stop the cleanup loop. The cleanup channel itself is never
+	// closed, since stopping rooms may still send their (non-blocking) cleanup notification.
+	done chan struct{}
+
 	// wg is used to wait for the runCleanupLoop goroutine to finish during shutdown.
 	wg sync.WaitGroup
 
@@ -38,15 +65,34 @@ type Manager struct {
 }
 
 // NewManager constructs and returns a new Manager instance.
-func NewManager(cfg *configs.AppConfig) *Manager {
+func NewManager(cfg *configs.AppConfig, deps ManagerDeps) *Manager {
 	managerLogger := logx.Logger().With().Str("component", "Manager").Logger()
 
+	scanner := deps.Scanner
+	if scanner == nil {
+		scanner = NoopScanner{}
+	}
+
+	verifier := NewAttachmentVerifier(deps.PrivateStorage, scanner, cfg.ScanFailOpen)
+
 	m := &Manager{
 		rooms:   make(map[string]*Room),
 		cleanup: make(chan RoomCleanupMsg, 10),
+		done:    make(chan struct{}),
 		logger:  managerLogger,
 		config:  cfg,
+		services: &RoomServices{
+			RateLimiter: deps.RateLimiter,
+			Verifier:    verifier,
+			Images:      NewImageProcessor(deps.PrivateStorage, verifier),
+			ViewOnce:    NewViewOnceTracker(deps.PrivateStorage, verifier),
+			Quotas:      NewUploadQuotas(cfg.UploadPlans, int64(cfg.RoomUploadQuotaMB)*1024*1024),
+			Contents:    NewContentIndex(deps.PrivateStorage),
+		},
+		conns:   newConnTracker(cfg.MaxConnsPerIP, cfg.MaxConnsPerUser),
+		uploads: NewUploadSessions(),
 	}
+	m.purger = newAttachmentPurger(deps.PrivateStorage, m.HasRoom)
 
 	m.wg.Add(1)
 
@@ -62,26 +108,37 @@ func (m *Manager) runCleanupLoop() {
 
 	m.logger.Info().Msg("Cleanup loop started.")
 
-	for msg := range m.cleanup {
-		m.deleteRoom(msg.RoomCode)
+	for {
+		select {
+		case msg := <-m.cleanup:
+			m.deleteRoom(msg.RoomCode)
+		case <-m.done:
+			m.logger.Info().Msg("Cleanup loop stopped.")
+			return
+		}
 	}
-
-	m.logger.Info().Msg("Cleanup loop stopped.")
 }
 
-// deleteRoom removes the specified room from the Manager's rooms map.
+// deleteRoom removes the specified room from the Manager's rooms map, forgets its multipart
+// upload sessions, view-once attachments, quota charges and reusable contents, and schedules
+// the deletion of its attachments from storage.
 func (m *Manager) deleteRoom(roomCode string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if _, ok := m.rooms[roomCode]; ok {
 		delete(m.rooms, roomCode)
+		m.uploads.RemoveRoom(roomCode)
+		m.services.ViewOnce.forgetRoom(roomCode)
+		m.services.Quotas.RemoveRoom(roomCode)
+		m.services.Contents.RemoveRoom(roomCode)
+		m.purger.schedule(roomCode)
 		m.logger.Info().Str("room_code", roomCode).Msg("Room successfully removed.")
 	}
 }
 
-// CreateRoom creates a new Room instance, adds it to the managed list, and starts its Run loop.
-func (m *Manager) CreateRoom(roomCode string, maxClients int) (*Room, *errs.CustomError) {
+// CreateRoom creates a new Room instance of the given type, adds it to the managed list, and starts its Run loop.
+func (m *Manager) CreateRoom(roomCode string, roomType string, maxClients int) (*Room, *errs.CustomError) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -90,12 +147,19 @@ func (m *Manager) CreateRoom(roomCode string, maxClients int) (*Room, *errs.Cust
 		return nil, errs.NewError(errs.ErrRoomCodeExists)
 	}
 
-	newRoom := NewRoom(roomCode, maxClients, m.cleanup, m.config.JWTSecret)
+	newRoom := NewRoom(RoomConfig{
+		Code:        roomCode,
+		Type:        roomType,
+		MaxClients:  maxClients,
+		JWTSecret:   m.config.JWTSecret,
+		FloodPolicy: m.config.FloodPolicy(roomType),
+		Attachments: m.Attachments(),
+	}, m.cleanup, m.services)
 	m.rooms[roomCode] = newRoom
 
 	go newRoom.Run()
 
-	m.logger.Info().Str("room_code", roomCode).Int("max_clients", maxClients).Msg("New Room created and started.")
+	m.logger.Info().Str("room_code", roomCode).Str("room_type", roomType).Int("max_clients", maxClients).Msg("New Room created and started.")
 	return newRoom, nil
 }
 
@@ -111,8 +175,57 @@ func (m *Manager) GetRoom(roomCode string) *Room {
 	return room
 }
 
+// HasRoom reports whether a room with the given code is currently active.
+func (m *Manager) HasRoom(roomCode string) bool {
+	return m.GetRoom(roomCode) != nil
+}
+
+// Verifier returns the attachment verifier shared by all rooms.
+func (m *Manager) Verifier() *AttachmentVerifier {
+	return m.services.Verifier
+}
+
+// Attachments returns the policy deciding which attachments users may upload.
+func (m *Manager) Attachments() AttachmentPolicy {
+	return AttachmentPolicy{Types: m.config.AttachmentTypes, Plans: m.config.UploadPlans}
+}
+
+// ViewOnce returns the tracker of view-once attachment downloads.
+func (m *Manager) ViewOnce() *ViewOnceTracker {
+	return m.services.ViewOnce
+}
+
+// Quotas returns the registry of the upload quotas of all rooms.
+func (m *Manager) Quotas() *UploadQuotas {
+	return m.services.Quotas
+}
+
+// Contents returns the index of recently sent attachments that may be reused without uploading.
+func (m *Manager) Contents() *ContentIndex {
+	return m.services.Contents
+}
+
+// Uploads returns the registry of in-progress multipart uploads.
+func (m *Manager) Uploads() *UploadSessions {
+	return m.uploads
+}
+
+// AcquireConnection reserves a live connection slot for the given client IP and user ID.
+// It returns ErrTooManyConnections if either cap is reached. The returned lease must be
+// released when the connection ends (Client.cleanupOnDisconnect does this automatically).
+func (m *Manager) AcquireConnection(ip, userID string) (*ConnLease, *errs.CustomError) {
+	lease, err := m.conns.acquire(ip, userID)
+	if err != nil {
+		m.logger.Warn().Str("user_id", userID).Msg("Connection cap reached.")
+		return nil, err
+	}
+
+	return lease, nil
+}
+
 // Shutdown gracefully shuts down the Manager and all managed rooms.
-// It stops all room Run loops, closes the cleanup channel, and waits for the cleanup goroutine to exit.
+// It stops all room Run loops, stops the cleanup loop, waits for the cleanup goroutine to exit,
+// and abandons attachment purges that have not started yet.
 func (m *Manager) Shutdown() {
 	m.logger.Info().Msg("Shutting down Manager cleanup loop...")
 
@@ -125,8 +238,10 @@ func (m *Manager) Shutdown() {
 
 	m.mu.Unlock()
 
-	close(m.cleanup)
+	close(m.done)
 	m.wg.Wait()
 
+	m.purger.stop()
+
 	m.logger.Info().Msg("Manager shutdown complete.")
 }
@@ -44,6 +44,23 @@ const (
 
 	// TypeAttachments represents a message containing file attachments.
 	TypeAttachments MessageType = "ATTACHMENTS"
+
+	// TypeVoice represents a voice message: a single audio recording with its duration and waveform.
+	TypeVoice MessageType = "VOICE"
+
+	// TypeViewOnceConsumed represents a notification event for a view-once attachment that has been
+	// opened by every recipient or has expired, and was deleted.
+	TypeViewOnceConsumed MessageType = "VIEW_ONCE_CONSUMED"
+
+	// TypeUpdateRoomSettings represents a host request to change the room settings.
+	TypeUpdateRoomSettings MessageType = "UPDATE_ROOM_SETTINGS"
+
+	// TypeRoomSettingsUpdated represents a notification event for changed room settings or host.
+	TypeRoomSettingsUpdated MessageType = "ROOM_SETTINGS_UPDATED"
+
+	// TypeGallery represents a client request for a page of the files shared in the room,
+	// and the server's reply carrying the page.
+	TypeGallery MessageType = "GALLERY"
 )
 
 // InitDataPayload is the payload structure for a TypeInitData message.
@@ -56,6 +73,27 @@ type InitDataPayload struct {
 
 	// MaxUsers is the maximum number of users allowed in this chat room.
 	MaxUsers int `json:"maxUsers"`
+
+	// HostID is the ID of the participant allowed to change the room settings.
+	HostID string `json:"hostId"`
+
+	// Settings is the current room settings.
+	Settings RoomSettings `json:"settings"`
+
+	// Quota is the remaining upload quota of the current user in this chat room.
+	Quota QuotaStatus `json:"quota"`
+}
+
+// RoomSettings holds the host-adjustable settings of a chat room.
+type RoomSettings struct {
+	// SlowModeSeconds is the minimum interval between two messages of the same participant (0 disables slow mode).
+	SlowModeSeconds int `json:"slowModeSeconds"`
+}
+
+// RoomSettingsPayload is the payload structure for a TypeRoomSettingsUpdated message.
+type RoomSettingsPayload struct {
+	HostID   string       `json:"hostId"`
+	Settings RoomSettings `json:"settings"`
 }
 
 // UserEventPayload is the payload structure for TypeUserJoined and TypeUserLeft messages.
@@ -77,6 +115,9 @@ type ErrorPayload struct {
 
 	// Message is the user-friendly error description.
 	Message string `json:"message"`
+
+	// RetryAfterMs optionally tells the client how long to wait (in milliseconds) before retrying.
+	RetryAfterMs int64 `json:"retryAfterMs,omitempty"`
 }
 
 // RoomCleanupMsg is an internal message used for communication between goroutines
@@ -96,6 +137,26 @@ type AttachmentsPayload struct {
 	Attachments []Attachment `json:"attachments"`
 }
 
+// VoicePayload is the payload structure for a TypeVoice message.
+type VoicePayload struct {
+	// Attachment is the uploaded recording, which must be of the voice category.
+	Attachment Attachment `json:"attachment"`
+
+	// DurationMs is the length of the recording in milliseconds.
+	DurationMs int64 `json:"durationMs"`
+
+	// Waveform is a coarse amplitude envelope of the recording, one value (0-255) per bucket.
+	Waveform []int `json:"waveform,omitempty"`
+}
+
+// ViewOnceConsumedPayload is the payload structure for a TypeViewOnceConsumed message.
+type ViewOnceConsumedPayload struct {
+	FileKey string `json:"fileKey"`
+
+	// Reason is ViewOnceReasonOpened or ViewOnceReasonExpired.
+	Reason string `json:"reason"`
+}
+
 // Message represents the standard message structure transmitted between the
 // server and clients over WebSocket.
 type Message struct {
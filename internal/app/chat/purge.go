@@ -0,0 +1,169 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the attachmentPurger, which aborts the unfinished multipart uploads and deletes
+every object stored under a room's prefix once the room has been closed, retrying transient
+storage failures. If a new room has been created with the same code in the meantime, only the
+uploads and objects that predate the closing are removed.
+*/
+package chat
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"hzchat/internal/app/storage"
+	"hzchat/internal/pkg/logx"
+)
+
+const (
+	// purgeDelay is how long after a room closes its attachments are deleted. It leaves time
+	// for in-flight verification and image processing of the room's last messages to finish.
+	purgeDelay = time.Minute
+
+	// purgeAttempts is the maximum number of attempts made to purge a room's attachments.
+	purgeAttempts = 5
+
+	// purgeBackoff is the wait before the second attempt; it doubles after every failure.
+	purgeBackoff = 5 * time.Second
+
+	// purgeTimeout bounds a single purge attempt.
+	purgeTimeout = time.Minute
+)
+
+// attachmentPurger schedules the deletion of closed rooms' attachments.
+type attachmentPurger struct {
+	storage storage.StorageService
+
+	// active reports whether a room with the given code is open again.
+	active func(roomCode string) bool
+
+	// ctx is cancelled on shutdown to abandon pending purges.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	logger zerolog.Logger
+}
+
+func newAttachmentPurger(store storage.StorageService, active func(roomCode string) bool) *attachmentPurger {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &attachmentPurger{
+		storage: store,
+		active:  active,
+		ctx:     ctx,
+		cancel:  cancel,
+		logger:  logx.Logger().With().Str("component", "AttachmentPurger").Logger(),
+	}
+}
+
+// schedule starts a background purge of the room's prefix after purgeDelay.
+func (p *attachmentPurger) schedule(roomCode string) {
+	closedAt := time.Now()
+
+	p.wg.Add(1)
+
+	go func() {
+		defer p.wg.Done()
+
+		if !p.sleep(purgeDelay) {
+			p.logger.Warn().Str("room_code", roomCode).Msg("Attachment purge abandoned on shutdown.")
+			return
+		}
+
+		backoff := purgeBackoff
+
+		for attempt := 1; attempt <= purgeAttempts; attempt++ {
+			deleted, err := p.purge(roomCode, closedAt)
+			if err == nil {
+				p.logger.Info().Str("room_code", roomCode).Int("deleted", deleted).Msg("Room attachments purged.")
+				return
+			}
+
+			p.logger.Warn().Err(err).Str("room_code", roomCode).Int("attempt", attempt).Msg("Room attachment purge failed.")
+
+			if attempt == purgeAttempts || !p.sleep(backoff) {
+				break
+			}
+			backoff *= 2
+		}
+
+		p.logger.Error().Str("room_code", roomCode).Msg("Giving up purging room attachments; files left in storage.")
+	}()
+}
+
+// purge aborts the multipart uploads and deletes every object under the room's prefix,
+// and returns the number of keys deleted. If the room code is in use again, the uploads and
+// objects of the new room, started or written since closedAt, are kept.
+func (p *attachmentPurger) purge(roomCode string, closedAt time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(p.ctx, purgeTimeout)
+	defer cancel()
+
+	// storage timestamps may have a one-second resolution, so anything from the second of
+	// the closing is kept rather than risking the new room's files
+	cutoff := closedAt.Truncate(time.Second)
+	reopened := p.active(roomCode)
+	if reopened {
+		p.logger.Info().Str("room_code", roomCode).Msg("Room code in use again; purging only the closed room's files.")
+	}
+
+	uploads, err := p.storage.ListMultipartUploads(ctx, roomCode+"/")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, upload := range uploads {
+		if reopened && !upload.Initiated.Before(cutoff) {
+			continue
+		}
+		if err := p.storage.AbortMultipartUpload(ctx, upload.Key, upload.UploadID); err != nil {
+			return 0, err
+		}
+	}
+
+	objects, err := p.storage.List(ctx, roomCode+"/")
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		if reopened && !obj.LastModified.Before(cutoff) {
+			continue
+		}
+		keys = append(keys, obj.Key)
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	if err := p.storage.DeleteMany(ctx, keys); err != nil {
+		return 0, err
+	}
+
+	return len(keys), nil
+}
+
+// sleep waits for d and reports false if the purger was stopped in the meantime.
+func (p *attachmentPurger) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// stop abandons pending purges and waits for running ones to return.
+func (p *attachmentPurger) stop() {
+	p.cancel()
+	p.wg.Wait()
+}
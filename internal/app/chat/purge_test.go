@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"hzchat/internal/app/storage"
+)
+
+func TestPurgeKeepsFilesOfAReopenedRoom(t *testing.T) {
+	tests := []struct {
+		name        string
+		reopened    bool
+		wantObjects []string
+		wantUploads []string
+	}{
+		{
+			name:        "closed room",
+			wantObjects: []string{"XYZ789/old.txt"},
+		},
+		{
+			name:        "room code in use again",
+			reopened:    true,
+			wantObjects: []string{"ABC123/new.txt", "XYZ789/old.txt"},
+			wantUploads: []string{"ABC123/new.bin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			closedAt := time.Now().Add(-time.Minute)
+
+			store := storage.NewMemoryStore("private")
+			for _, key := range []string{"ABC123/old.txt", "ABC123/new.txt", "XYZ789/old.txt"} {
+				if err := store.Put(ctx, key, []byte("data"), "text/plain"); err != nil {
+					t.Fatalf("put: %v", err)
+				}
+			}
+			for _, key := range []string{"ABC123/old.bin", "ABC123/new.bin"} {
+				if _, err := store.CreateMultipartUpload(ctx, key, "video/mp4"); err != nil {
+					t.Fatalf("create upload: %v", err)
+				}
+			}
+			for _, key := range []string{"ABC123/old.txt", "ABC123/old.bin", "XYZ789/old.txt"} {
+				store.Touch(key, closedAt.Add(-time.Hour))
+			}
+
+			purger := newAttachmentPurger(store, func(roomCode string) bool { return tt.reopened && roomCode == "ABC123" })
+			defer purger.stop()
+
+			deleted, err := purger.purge("ABC123", closedAt)
+			if err != nil {
+				t.Fatalf("purge: %v", err)
+			}
+			if want := 3 - len(tt.wantObjects); deleted != want {
+				t.Fatalf("deleted %d objects, want %d", deleted, want)
+			}
+
+			objects, _ := store.List(ctx, "")
+			var keys []string
+			for _, obj := range objects {
+				keys = append(keys, obj.Key)
+			}
+			if !slices.Equal(keys, tt.wantObjects) {
+				t.Fatalf("objects left: got %v, want %v", keys, tt.wantObjects)
+			}
+
+			uploads, _ := store.ListMultipartUploads(ctx, "")
+			keys = nil
+			for _, upload := range uploads {
+				keys = append(keys, upload.Key)
+			}
+			if !slices.Equal(keys, tt.wantUploads) {
+				t.Fatalf("uploads left: got %v, want %v", keys, tt.wantUploads)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the UploadQuotas registry, which bounds the total size of the attachments
+uploaded to a room, overall and by each participant according to their plan. Presigned uploads
+are charged when the URL is issued and replaced by the stored size once the attachment is sent.
+*/
+package chat
+
+import (
+	"sync"
+	"time"
+
+	"hzchat/internal/configs"
+	"hzchat/internal/pkg/errs"
+)
+
+// QuotaStatus reports the remaining upload quotas of a participant in bytes.
+// A nil value means that the quota is disabled.
+type QuotaStatus struct {
+	UserRemaining *int64 `json:"userRemaining"`
+	RoomRemaining *int64 `json:"roomRemaining"`
+}
+
+// quotaCharge is the size charged for one attachment to the participant who uploaded it.
+// Presigned uploads that are never sent are released once expiresAt has passed;
+// the charges of sent attachments have a zero expiresAt and last as long as the room.
+type quotaCharge struct {
+	userID    string
+	size      int64
+	expiresAt time.Time
+}
+
+// UploadQuotas tracks the attachment bytes charged in every room, keyed by room code and file key.
+type UploadQuotas struct {
+	plans     configs.UploadPlans
+	roomQuota int64
+
+	// mu protects concurrent access to the rooms map.
+	mu    sync.Mutex
+	rooms map[string]map[string]quotaCharge
+}
+
+// NewUploadQuotas creates a registry enforcing the per-user quotas of the plans and the given
+// per-room quota in bytes (0 disables it).
+func NewUploadQuotas(plans configs.UploadPlans, roomQuota int64) *UploadQuotas {
+	return &UploadQuotas{
+		plans:     plans,
+		roomQuota: roomQuota,
+		rooms:     make(map[string]map[string]quotaCharge),
+	}
+}
+
+// Reserve charges an upload of size bytes under key to the user, to be released after ttl unless
+// the attachment is sent. It returns ErrUploadQuotaExceeded if the upload exceeds the user's or
+// the room's remaining quota, and otherwise the quotas remaining after the upload.
+func (q *UploadQuotas) Reserve(roomCode, userID, planType, key string, size int64, ttl time.Duration) (QuotaStatus, *errs.CustomError) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	userQuota := q.plans.Plan(planType).Quota()
+	userUsed, roomUsed := q.usage(roomCode, userID)
+
+	if (userQuota > 0 && userUsed+size > userQuota) || (q.roomQuota > 0 && roomUsed+size > q.roomQuota) {
+		return QuotaStatus{}, errs.NewError(errs.ErrUploadQuotaExceeded)
+	}
+
+	charges, ok := q.rooms[roomCode]
+	if !ok {
+		charges = make(map[string]quotaCharge)
+		q.rooms[roomCode] = charges
+	}
+	charges[key] = quotaCharge{userID: userID, size: size, expiresAt: time.Now().Add(ttl)}
+
+	return q.status(userQuota, userUsed+size, roomUsed+size), nil
+}
+
+// Confirm charges the stored size of a sent attachment for as long as the room exists, to the
+// participant who reserved its upload or else to the sender. Sending a key again is free.
+func (q *UploadQuotas) Confirm(roomCode, userID, key string, size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	charges, ok := q.rooms[roomCode]
+	if !ok {
+		charges = make(map[string]quotaCharge)
+		q.rooms[roomCode] = charges
+	}
+
+	if charge, ok := charges[key]; ok {
+		if charge.expiresAt.IsZero() {
+			return
+		}
+		userID = charge.userID
+	}
+
+	charges[key] = quotaCharge{userID: userID, size: size}
+}
+
+// Release removes the charge of an upload that was abandoned, e.g. an aborted multipart upload.
+func (q *UploadQuotas) Release(roomCode, key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if charges, ok := q.rooms[roomCode]; ok {
+		delete(charges, key)
+	}
+}
+
+// Status returns the remaining quotas of the user in the room.
+func (q *UploadQuotas) Status(roomCode, userID, planType string) QuotaStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	userUsed, roomUsed := q.usage(roomCode, userID)
+
+	return q.status(q.plans.Plan(planType).Quota(), userUsed, roomUsed)
+}
+
+// RemoveRoom forgets the charges of a closed room, whose attachments are purged from storage.
+func (q *UploadQuotas) RemoveRoom(roomCode string) {
+	q.mu.Lock()
+	delete(q.rooms, roomCode)
+	q.mu.Unlock()
+}
+
+// usage returns the bytes charged to the user and to the whole room, dropping expired reservations.
+// The caller must hold q.mu.
+func (q *UploadQuotas) usage(roomCode, userID string) (int64, int64) {
+	var userUsed, roomUsed int64
+	now := time.Now()
+
+	charges := q.rooms[roomCode]
+	for key, charge := range charges {
+		if !charge.expiresAt.IsZero() && now.After(charge.expiresAt) {
+			delete(charges, key)
+			continue
+		}
+
+		roomUsed += charge.size
+		if charge.userID == userID {
+			userUsed += charge.size
+		}
+	}
+
+	return userUsed, roomUsed
+}
+
+// status builds the QuotaStatus for the given usage, omitting disabled quotas.
+func (q *UploadQuotas) status(userQuota, userUsed, roomUsed int64) QuotaStatus {
+	var s QuotaStatus
+
+	if userQuota > 0 {
+		remaining := max(userQuota-userUsed, 0)
+		s.UserRemaining = &remaining
+	}
+
+	if q.roomQuota > 0 {
+		remaining := max(q.roomQuota-roomUsed, 0)
+		s.RoomRemaining = &remaining
+	}
+
+	return s
+}
@@ -0,0 +1,113 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"hzchat/internal/configs"
+	"hzchat/internal/pkg/errs"
+)
+
+const mb = 1024 * 1024
+
+// newTestQuotas allows guests 2 MB each and the room 3 MB.
+func newTestQuotas() *UploadQuotas {
+	return NewUploadQuotas(configs.UploadPlans{configs.GuestPlan: {MaxFileSizeMB: 2, QuotaMB: 2}}, 3*mb)
+}
+
+func TestUploadQuotasExpireUnsentReservations(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		settle  func(q *UploadQuotas)
+		blocked bool
+	}{
+		{name: "pending reservation", ttl: time.Hour, blocked: true},
+		{name: "expired reservation", ttl: -time.Second, blocked: false},
+		{
+			name:    "sent attachment",
+			ttl:     time.Hour,
+			settle:  func(q *UploadQuotas) { q.Confirm("ABC123", "u1", "ABC123/a", 2*mb) },
+			blocked: true,
+		},
+		{
+			name:    "sent after its reservation expired",
+			ttl:     -time.Second,
+			settle:  func(q *UploadQuotas) { q.Confirm("ABC123", "u1", "ABC123/a", 2*mb) },
+			blocked: true,
+		},
+		{
+			name:    "released upload",
+			ttl:     time.Hour,
+			settle:  func(q *UploadQuotas) { q.Release("ABC123", "ABC123/a") },
+			blocked: false,
+		},
+		{
+			name:    "closed room",
+			ttl:     time.Hour,
+			settle:  func(q *UploadQuotas) { q.RemoveRoom("ABC123") },
+			blocked: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQuotas()
+
+			if _, err := q.Reserve("ABC123", "u1", configs.GuestPlan, "ABC123/a", 2*mb, tt.ttl); err != nil {
+				t.Fatalf("first reservation: %v", err)
+			}
+			if tt.settle != nil {
+				tt.settle(q)
+			}
+
+			_, err := q.Reserve("ABC123", "u1", configs.GuestPlan, "ABC123/b", 1, time.Hour)
+			if blocked := err != nil && err.Code == errs.ErrUploadQuotaExceeded; blocked != tt.blocked {
+				t.Fatalf("second reservation: got %v, want blocked %v", err, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestUploadQuotasStatus(t *testing.T) {
+	q := newTestQuotas()
+
+	status, err := q.Reserve("ABC123", "u1", configs.GuestPlan, "ABC123/a", mb, time.Hour)
+	if err != nil || *status.UserRemaining != mb || *status.RoomRemaining != 2*mb {
+		t.Fatalf("reservation: got %+v, %v", status, err)
+	}
+
+	// u2 has their own user quota but shares the room quota
+	if _, err := q.Reserve("ABC123", "u2", configs.GuestPlan, "ABC123/b", 2*mb, time.Hour); err != nil {
+		t.Fatalf("reservation by u2: %v", err)
+	}
+	if _, err := q.Reserve("ABC123", "u1", configs.GuestPlan, "ABC123/c", 1, time.Hour); err == nil {
+		t.Fatal("reservation over the room quota was accepted")
+	}
+
+	// sending u1's file again, here by u2, is neither charged twice nor moved to u2
+	q.Confirm("ABC123", "u1", "ABC123/a", mb)
+	q.Confirm("ABC123", "u2", "ABC123/a", mb)
+
+	tests := []struct {
+		roomCode, userID string
+		user, room       int64
+	}{
+		{roomCode: "ABC123", userID: "u1", user: mb, room: 0},
+		{roomCode: "ABC123", userID: "u2", user: 0, room: 0},
+		{roomCode: "ABC123", userID: "u3", user: 2 * mb, room: 0},
+		{roomCode: "XYZ789", userID: "u1", user: 2 * mb, room: 3 * mb},
+	}
+	for _, tt := range tests {
+		got := q.Status(tt.roomCode, tt.userID, configs.GuestPlan)
+		if *got.UserRemaining != tt.user || *got.RoomRemaining != tt.room {
+			t.Fatalf("%s in %s: got %d/%d remaining, want %d/%d",
+				tt.userID, tt.roomCode, *got.UserRemaining, *got.RoomRemaining, tt.user, tt.room)
+		}
+	}
+
+	disabled := NewUploadQuotas(configs.UploadPlans{configs.GuestPlan: {MaxFileSizeMB: 2}}, 0)
+	if got := disabled.Status("ABC123", "u1", configs.GuestPlan); got.UserRemaining != nil || got.RoomRemaining != nil {
+		t.Fatalf("disabled quotas: got %+v", got)
+	}
+}
@@ -3,7 +3,7 @@ Package chat contains the core logic for handling real-time chat rooms, user con
 
 This file defines the Room struct, which is the central hub for a single chat session.
 It manages client lifecycles (register/unregister), message broadcasting to all participants,
-and automatic shutdown based on inactivity.
+host-controlled room settings such as slow mode, and automatic shutdown based on inactivity.
 */
 package chat
 
@@ -14,6 +14,9 @@ import (
 	"time"
 
 	"hzchat/internal/app/user"
+	"hzchat/internal/configs"
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/limiter"
 	"hzchat/internal/pkg/logx"
 
 	"github.com/rs/zerolog"
@@ -22,6 +25,12 @@ import (
 const broadcastChannelBuffer = 1024
 
 const (
+	// RoomTypePrivate is the room type for one-to-one chats.
+	RoomTypePrivate = "private"
+
+	// RoomTypeGroup is the room type for group chats.
+	RoomTypeGroup = "group"
+
 	// PrivateMaxClients defines the capacity limit for private chat rooms.
 	PrivateMaxClients = 2
 
@@ -32,17 +41,58 @@ const (
 	RoomInactivityTimeout = 5 * time.Minute
 )
 
+// RoomServices bundles the shared services the Manager hands to every Room.
+type RoomServices struct {
+	RateLimiter *limiter.Limiter
+	Verifier    *AttachmentVerifier
+	Images      *ImageProcessor
+	ViewOnce    *ViewOnceTracker
+	Quotas      *UploadQuotas
+	Contents    *ContentIndex
+}
+
+// RoomConfig holds the settings a Room is created with.
+type RoomConfig struct {
+	Code        string
+	Type        string
+	MaxClients  int
+	JWTSecret   string
+	FloodPolicy configs.FloodPolicy
+	Attachments AttachmentPolicy
+}
+
+// clientMessage is a message submitted by a client to the Room's event loop.
+// When err is set, the message was rejected by asynchronous validation and
+// the Room only reports the error back to the (still connected) client.
+// A clientMessage without client is a server event broadcast to every participant.
+type clientMessage struct {
+	client  *Client
+	message Message
+	tempID  string
+	err     *errs.CustomError
+
+	// attachments lists the verified attachments carried by the message.
+	attachments []Attachment
+}
+
 // Room struct represents a single, active chat room session.
 type Room struct {
 	Code       string
+	Type       string
 	MaxClients int
 	JWTSecret  string
 
 	// Core state
-	clients map[string]*Client
+	clients    map[string]*Client
+	hostID     string
+	settings   RoomSettings
+	lastPostAt map[string]time.Time
+	gallery    *Gallery
+	downloads  *DownloadLog
 
 	// Channels for concurrency
 	broadcast  chan Message
+	inbound    chan clientMessage
 	register   chan *Client
 	unregister chan *Client
 
@@ -53,26 +103,37 @@ type Room struct {
 	mu            sync.RWMutex
 
 	// Context
-	logger zerolog.Logger
+	floodPolicy configs.FloodPolicy
+	attachments AttachmentPolicy
+	services    *RoomServices
+	logger      zerolog.Logger
 }
 
 // NewRoom creates and initializes a new Room instance.
-func NewRoom(roomCode string, maxClients int, cleanupChan chan<- RoomCleanupMsg, jwtSecret string) *Room {
+func NewRoom(cfg RoomConfig, cleanupChan chan<- RoomCleanupMsg, services *RoomServices) *Room {
 	roomLogger := logx.Logger().With().
-		Str("room_code", roomCode).
+		Str("room_code", cfg.Code).
 		Logger()
 
 	return &Room{
-		Code:          roomCode,
-		MaxClients:    maxClients,
-		JWTSecret:     jwtSecret,
+		Code:          cfg.Code,
+		Type:          cfg.Type,
+		MaxClients:    cfg.MaxClients,
+		JWTSecret:     cfg.JWTSecret,
 		clients:       make(map[string]*Client),
+		lastPostAt:    make(map[string]time.Time),
+		gallery:       &Gallery{},
+		downloads:     newDownloadLog(),
 		broadcast:     make(chan Message, broadcastChannelBuffer),
+		inbound:       make(chan clientMessage, broadcastChannelBuffer),
 		register:      make(chan *Client),
 		unregister:    make(chan *Client),
 		cleanupChan:   cleanupChan,
 		stopChan:      make(chan struct{}),
 		shutdownTimer: time.NewTimer(RoomInactivityTimeout),
+		floodPolicy:   cfg.FloodPolicy,
+		attachments:   cfg.Attachments,
+		services:      services,
 		logger:        roomLogger,
 	}
 }
@@ -95,6 +156,9 @@ func (r *Room) Run() {
 		case message := <-r.broadcast:
 			r.handleBroadcast(message)
 
+		case in := <-r.inbound:
+			r.handleInbound(in)
+
 		case <-timerChan:
 			r.logger.Info().Msgf("Room inactivity timeout (%s) reached. Shutting down loop.", RoomInactivityTimeout)
 			return
@@ -166,6 +230,11 @@ func (r *Room) handleRegister(client *Client) {
 		Int("total_users", len(r.clients)).
 		Msg("Client joined room.")
 
+	// The first participant becomes host; if the host is offline, the joining client takes over.
+	if _, online := r.clients[r.hostID]; !online {
+		r.hostID = client.user.ID
+	}
+
 	// Prepare initial data
 	onlineUsers := make([]user.User, 0, len(r.clients))
 	for _, c := range r.clients {
@@ -176,6 +245,9 @@ func (r *Room) handleRegister(client *Client) {
 		CurrentUser: client.user,
 		OnlineUsers: onlineUsers,
 		MaxUsers:    r.MaxClients,
+		HostID:      r.hostID,
+		Settings:    r.settings,
+		Quota:       r.services.Quotas.Status(r.Code, client.user.ID, client.user.PlanType),
 	}
 
 	r.mu.Unlock()
@@ -238,6 +310,14 @@ func (r *Room) handleUnregister(client *Client) {
 			}
 		}
 
+		// the leaver's entry is kept while its cooldown runs, so that reconnecting does not skip it
+		r.pruneLastPostAt(time.Now())
+
+		// Hand the host role over to the longest-connected remaining participant
+		if client.user.ID == r.hostID && len(r.clients) > 0 {
+			r.transferHostLocked()
+		}
+
 		// 4. Inactivity timer logic
 		if len(r.clients) == 0 {
 			r.logger.Info().Msg("Room is empty. Restarting shutdown timer.")
@@ -266,6 +346,147 @@ func (r *Room) handleUnregister(client *Client) {
 	}
 }
 
+// transferHostLocked makes the longest-connected online participant the host and announces the change.
+// The caller must hold r.mu.
+func (r *Room) transferHostLocked() {
+	var next *Client
+	for _, c := range r.clients {
+		if next == nil || c.joinedAt.Before(next.joinedAt) {
+			next = c
+		}
+	}
+
+	r.hostID = next.user.ID
+	r.logger.Info().Str("host_id", r.hostID).Msg("Room host transferred.")
+
+	r.announceSettingsLocked()
+}
+
+// announceSettingsLocked queues a TypeRoomSettingsUpdated event with the current host and settings.
+// The caller must hold r.mu.
+func (r *Room) announceSettingsLocked() {
+	msg, err := NewMessage(TypeRoomSettingsUpdated, r.Code, SystemUser, RoomSettingsPayload{
+		HostID:   r.hostID,
+		Settings: r.settings,
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("Failed to build ROOM_SETTINGS_UPDATED message.")
+		return
+	}
+
+	select {
+	case r.broadcast <- msg:
+	default:
+		r.logger.Warn().Msg("Broadcast channel full during ROOM_SETTINGS_UPDATED.")
+	}
+}
+
+// handleInbound processes a message submitted by a client.
+// Messages from connections that have already been replaced or removed are dropped.
+func (r *Room) handleInbound(in clientMessage) {
+	if in.client == nil {
+		r.handleBroadcast(in.message)
+		return
+	}
+
+	if current, ok := r.clients[in.client.user.ID]; !ok || current != in.client {
+		r.logger.Debug().Str("client_id", in.client.user.ID).Msg("Dropping message from stale connection.")
+		return
+	}
+
+	if in.err != nil {
+		in.client.SendError(in.err)
+		return
+	}
+
+	switch in.message.Type {
+	case TypeUpdateRoomSettings:
+		r.handleSettingsUpdate(in)
+	default:
+		r.handleChatMessage(in)
+	}
+}
+
+// handleChatMessage enforces slow mode, acknowledges the message to its sender, broadcasts it
+// and adds its attachments to the gallery.
+func (r *Room) handleChatMessage(in clientMessage) {
+	senderID := in.client.user.ID
+	now := time.Now()
+
+	if r.settings.SlowModeSeconds > 0 {
+		cooldown := time.Duration(r.settings.SlowModeSeconds) * time.Second
+
+		if last, ok := r.lastPostAt[senderID]; ok {
+			if remaining := last.Add(cooldown).Sub(now); remaining > 0 {
+				in.client.SendErrorWithRetry(errs.NewError(errs.ErrSlowModeActive), remaining)
+				return
+			}
+		}
+	}
+
+	r.lastPostAt[senderID] = now
+
+	// tracked before the broadcast, so recipients can claim their download as soon as they see the message
+	if keys := viewOnceKeys(in.attachments); len(keys) > 0 {
+		r.services.ViewOnce.track(r, keys, r.recipientsOf(senderID))
+	}
+
+	in.client.sendConfirmation(in.tempID, in.message)
+	r.handleBroadcast(in.message)
+
+	r.gallery.add(in.message, in.attachments)
+}
+
+// pruneLastPostAt drops the post times whose slow mode cooldown has elapsed under the current
+// settings, or all of them while slow mode is off.
+func (r *Room) pruneLastPostAt(now time.Time) {
+	cooldown := time.Duration(r.settings.SlowModeSeconds) * time.Second
+
+	for id, last := range r.lastPostAt {
+		if !now.Before(last.Add(cooldown)) {
+			delete(r.lastPostAt, id)
+		}
+	}
+}
+
+// recipientsOf returns the IDs of the online participants other than the sender.
+func (r *Room) recipientsOf(senderID string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	recipients := make([]string, 0, len(r.clients))
+	for _, client := range r.clients {
+		if client.user.ID != senderID {
+			recipients = append(recipients, client.user.ID)
+		}
+	}
+
+	return recipients
+}
+
+// handleSettingsUpdate applies a settings change requested by the host and announces it to all participants.
+func (r *Room) handleSettingsUpdate(in clientMessage) {
+	if in.client.user.ID != r.hostID {
+		in.client.SendError(errs.NewError(errs.ErrNotRoomHost))
+		return
+	}
+
+	var settings RoomSettings
+	if err := json.Unmarshal(in.message.Payload, &settings); err != nil {
+		r.logger.Error().Err(err).Msg("Failed to decode room settings update.")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.settings = settings
+	r.pruneLastPostAt(time.Now())
+	r.logger.Info().Int("slow_mode_seconds", settings.SlowModeSeconds).Msg("Room settings updated by host.")
+
+	r.announceSettingsLocked()
+}
+
 // handleBroadcast manages the entire logic for marshaling and distributing a message
 // to all other clients in the room.
 func (r *Room) handleBroadcast(message Message) {
@@ -355,26 +576,103 @@ func (r *Room) cleanupOnExit() {
 	default:
 		close(r.broadcast)
 	}
+
+	// r.register, r.unregister and r.inbound are intentionally left open: connections that
+	// are still shutting down (and asynchronous attachment checks) may send to them after the
+	// loop exits. All such sends are non-blocking, so the channels are simply discarded.
+}
+
+// RegisterClient safely adds a client to the registration queue.
+func (r *Room) RegisterClient(client *Client) {
 	select {
-	case <-r.register:
+	case r.register <- client:
 	default:
-		close(r.register)
+		r.logger.Warn().Msg("Room register channel blocked.")
+		client.SendError(fmt.Errorf("room is busy, register channel blocked"))
 	}
+}
+
+// submit queues a client message for the Room's event loop without blocking the caller.
+// The Room acknowledges the message with tempID once it has been accepted.
+// It returns false if the inbound queue is full.
+func (r *Room) submit(client *Client, message Message, tempID string) bool {
+	return r.submitInbound(clientMessage{client: client, message: message, tempID: tempID})
+}
+
+// submitWithAttachments is submit for a message carrying verified attachments. Once the message is
+// accepted, the Room hands its view-once attachments and the recipients to the ViewOnceTracker and
+// adds the others to the gallery.
+func (r *Room) submitWithAttachments(client *Client, message Message, tempID string, attachments []Attachment) bool {
+	return r.submitInbound(clientMessage{client: client, message: message, tempID: tempID, attachments: attachments})
+}
+
+// announce queues a server event for broadcast to every participant without blocking.
+// Unlike the broadcast channel, the inbound queue is never closed, so it is safe to call at any time.
+func (r *Room) announce(message Message) bool {
+	return r.submitInbound(clientMessage{message: message})
+}
+
+// reject reports an asynchronous validation error to the client through the Room's event loop,
+// which only delivers it if the connection is still registered.
+func (r *Room) reject(client *Client, err *errs.CustomError) {
+	r.submitInbound(clientMessage{client: client, err: err})
+}
+
+// rejectBusy tells the client that the message identified by tempID was refused because the
+// inbound queue is full or the Room has stopped. It cannot go through the queue, so it writes to
+// the client directly, under the lock the Room holds when closing send channels, and only while
+// the connection is still registered in a running Room.
+func (r *Room) rejectBusy(client *Client, tempID string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	select {
-	case <-r.unregister:
+	case <-r.stopChan:
+		return
 	default:
-		close(r.unregister)
 	}
+
+	if current, ok := r.clients[client.user.ID]; !ok || current != client {
+		return
+	}
+
+	client.sendError(errs.NewError(errs.ErrRoomBusy), 0, tempID)
 }
 
-// RegisterClient safely adds a client to the registration queue.
-func (r *Room) RegisterClient(client *Client) {
+func (r *Room) submitInbound(in clientMessage) bool {
 	select {
-	case r.register <- client:
+	case <-r.stopChan:
+		return false
 	default:
-		r.logger.Warn().Msg("Room register channel blocked.")
-		client.SendError(fmt.Errorf("room is busy, register channel blocked"))
 	}
+
+	select {
+	case r.inbound <- in:
+		return true
+	default:
+		if in.client != nil {
+			r.logger.Warn().Str("client_id", in.client.user.ID).Msg("Inbound channel full, rejecting client message.")
+		}
+		return false
+	}
+}
+
+// Gallery returns the files shared in the room.
+func (r *Room) Gallery() *Gallery {
+	return r.gallery
+}
+
+// Downloads returns the download URL cache and access counts of the room.
+func (r *Room) Downloads() *DownloadLog {
+	return r.downloads
+}
+
+// IsHost reports whether the user is the room host.
+func (r *Room) IsHost(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.hostID == userID
 }
 
 // IsFull checks if the room has reached its maximum client capacity.
@@ -411,5 +709,8 @@ func (r *Room) GetInitDataPayload(currentUser user.User) InitDataPayload {
 		CurrentUser: currentUser,
 		OnlineUsers: onlineUsers,
 		MaxUsers:    r.MaxClients,
+		HostID:      r.hostID,
+		Settings:    r.settings,
+		Quota:       r.services.Quotas.Status(r.Code, currentUser.ID, currentUser.PlanType),
 	}
 }
@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"hzchat/internal/configs"
+	"hzchat/internal/pkg/errs"
+)
+
+// joinTestRoom adds clients to the room as if they had registered, the first one as host.
+func joinTestRoom(room *Room, clients ...*Client) {
+	for _, c := range clients {
+		room.clients[c.user.ID] = c
+	}
+	room.hostID = clients[0].user.ID
+}
+
+// sendText submits a text message from the client to the room's handlers.
+func sendText(t *testing.T, room *Room, c *Client, tempID string) {
+	t.Helper()
+
+	msg, err := NewMessage(TypeText, room.Code, c.user, TextPayload{Content: "hello"})
+	if err != nil {
+		t.Fatalf("new message: %v", err)
+	}
+	room.handleInbound(clientMessage{client: c, message: msg, tempID: tempID})
+}
+
+// updateSettings submits a settings change from the client to the room's handlers.
+func updateSettings(t *testing.T, room *Room, c *Client, settings RoomSettings) {
+	t.Helper()
+
+	msg, err := NewMessage(TypeUpdateRoomSettings, room.Code, c.user, settings)
+	if err != nil {
+		t.Fatalf("new message: %v", err)
+	}
+	room.handleInbound(clientMessage{client: c, message: msg})
+}
+
+func TestSlowModeIsSetByTheHost(t *testing.T) {
+	room := newTestRoom(t, configs.DefaultFloodPolicies[RoomTypeGroup])
+	host, guest := newTestClient(room, "host"), newTestClient(room, "guest")
+	joinTestRoom(room, host, guest)
+
+	updateSettings(t, room, guest, RoomSettings{SlowModeSeconds: 30})
+	if e := nextError(t, guest); e.Code != errs.ErrNotRoomHost {
+		t.Fatalf("guest update: got code %d, want %d", e.Code, errs.ErrNotRoomHost)
+	}
+	if room.settings.SlowModeSeconds != 0 {
+		t.Fatalf("guest update was applied: %+v", room.settings)
+	}
+
+	updateSettings(t, room, host, RoomSettings{SlowModeSeconds: 30})
+	if room.settings.SlowModeSeconds != 30 {
+		t.Fatalf("host update was not applied: %+v", room.settings)
+	}
+
+	// the change is announced to every participant
+	if len(room.broadcast) != 1 {
+		t.Fatalf("got %d queued broadcasts, want the settings announcement", len(room.broadcast))
+	}
+	if msg := <-room.broadcast; msg.Type != TypeRoomSettingsUpdated {
+		t.Fatalf("got %s broadcast, want %s", msg.Type, TypeRoomSettingsUpdated)
+	}
+}
+
+func TestSlowModeCooldown(t *testing.T) {
+	room := newTestRoom(t, configs.DefaultFloodPolicies[RoomTypeGroup])
+	host, guest := newTestClient(room, "host"), newTestClient(room, "guest")
+	joinTestRoom(room, host, guest)
+	room.settings = RoomSettings{SlowModeSeconds: 30}
+
+	sendText(t, room, guest, "first")
+	if msg := nextMessage(t, guest); msg.Type != TypeConfirm {
+		t.Fatalf("first message: got %s, want %s", msg.Type, TypeConfirm)
+	}
+	if msg := nextMessage(t, host); msg.Type != TypeText {
+		t.Fatalf("host received %s, want %s", msg.Type, TypeText)
+	}
+
+	sendText(t, room, guest, "second")
+	e := nextError(t, guest)
+	if e.Code != errs.ErrSlowModeActive {
+		t.Fatalf("second message: got code %d, want %d", e.Code, errs.ErrSlowModeActive)
+	}
+	if e.RetryAfterMs <= 29_000 || e.RetryAfterMs > 30_000 {
+		t.Fatalf("second message: retry after %dms, want the remaining cooldown", e.RetryAfterMs)
+	}
+	expectNoMessage(t, host)
+
+	// the cooldown is per participant
+	sendText(t, room, host, "host")
+	if msg := nextMessage(t, host); msg.Type != TypeConfirm {
+		t.Fatalf("host message: got %s, want %s", msg.Type, TypeConfirm)
+	}
+	nextMessage(t, guest)
+
+	// the remaining cooldown shrinks as time passes
+	room.lastPostAt[guest.user.ID] = time.Now().Add(-20 * time.Second)
+	sendText(t, room, guest, "third")
+	if e := nextError(t, guest); e.RetryAfterMs <= 9_000 || e.RetryAfterMs > 10_000 {
+		t.Fatalf("third message: retry after %dms, want about 10s", e.RetryAfterMs)
+	}
+
+	room.lastPostAt[guest.user.ID] = time.Now().Add(-30 * time.Second)
+	sendText(t, room, guest, "fourth")
+	if msg := nextMessage(t, guest); msg.Type != TypeConfirm {
+		t.Fatalf("message after the cooldown: got %s, want %s", msg.Type, TypeConfirm)
+	}
+}
+
+func TestSlowModePostTimesArePruned(t *testing.T) {
+	room := newTestRoom(t, configs.DefaultFloodPolicies[RoomTypeGroup])
+	host, guest, other := newTestClient(room, "host"), newTestClient(room, "guest"), newTestClient(room, "other")
+	joinTestRoom(room, host, guest, other)
+	room.settings = RoomSettings{SlowModeSeconds: 30}
+
+	room.lastPostAt[guest.user.ID] = time.Now()
+	room.lastPostAt[other.user.ID] = time.Now().Add(-40 * time.Second)
+
+	// leaving drops elapsed cooldowns, but keeps a running one so that reconnecting does not skip it
+	room.handleUnregister(other)
+	room.handleUnregister(guest)
+	if _, ok := room.lastPostAt[other.user.ID]; ok {
+		t.Fatal("elapsed cooldown was kept")
+	}
+	if _, ok := room.lastPostAt[guest.user.ID]; !ok {
+		t.Fatal("running cooldown was dropped on leave")
+	}
+
+	updateSettings(t, room, host, RoomSettings{})
+	if len(room.lastPostAt) != 0 {
+		t.Fatalf("post times kept with slow mode off: %v", room.lastPostAt)
+	}
+}
+
+func TestSlowModeOff(t *testing.T) {
+	room := newTestRoom(t, configs.DefaultFloodPolicies[RoomTypeGroup])
+	guest := newTestClient(room, "guest")
+	joinTestRoom(room, guest)
+
+	for _, tempID := range []string{"a", "b", "c"} {
+		sendText(t, room, guest, tempID)
+		if msg := nextMessage(t, guest); msg.Type != TypeConfirm {
+			t.Fatalf("message %s: got %s, want %s", tempID, msg.Type, TypeConfirm)
+		}
+	}
+}
+
+func TestRefusedVerifiedMessageIsReportedToTheSender(t *testing.T) {
+	room := newTestRoom(t, configs.DefaultFloodPolicies[RoomTypeGroup])
+	alice, bob := newTestClient(room, "alice"), newTestClient(room, "bob")
+	joinTestRoom(room, alice)
+
+	msg, err := NewMessage(TypeVoice, room.Code, alice.user, VoicePayload{})
+	if err != nil {
+		t.Fatalf("new message: %v", err)
+	}
+
+	for len(room.inbound) < cap(room.inbound) {
+		room.inbound <- clientMessage{}
+	}
+
+	alice.submitVerified(msg, "voice-1", nil)
+
+	m := nextMessage(t, alice)
+	if e := errorPayload(t, m); e.Code != errs.ErrRoomBusy || m.TempID != "voice-1" {
+		t.Fatalf("got code %d for %q, want %d for voice-1", e.Code, m.TempID, errs.ErrRoomBusy)
+	}
+
+	// connections that are gone are not written to
+	close(bob.send)
+	bob.submitVerified(msg, "voice-2", nil)
+
+	room.Stop()
+	alice.submitVerified(msg, "voice-3", nil)
+	expectNoMessage(t, alice)
+}
@@ -0,0 +1,88 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file implements magic-byte content sniffing, used to detect uploads whose real
+content (e.g. an HTML or SVG document) does not match their declared MIME type.
+*/
+package chat
+
+import "net/http"
+
+// sniffLength is the number of leading bytes fetched from storage to detect the real content type.
+const sniffLength = 512
+
+// sniffAliases lists, for declared MIME types that http.DetectContentType cannot identify
+// exactly, the detected types that are also accepted as a match.
+var sniffAliases = map[string][]string{
+	// voice recordings: the containers are sniffed as their video or generic variants
+	"audio/webm": {"video/webm"},
+	"audio/ogg":  {"application/ogg"},
+	"audio/mp4":  {"video/mp4"},
+}
+
+// frameSniffers lists, for declared MIME types of raw streams that http.DetectContentType does not
+// identify, a check of the leading frame header. Such content is sniffed as unknown binary, or as
+// text when its first bytes happen to contain no control characters, so the header alone decides.
+var frameSniffers = map[string]func(head []byte) bool{
+	// MP3 files without an ID3 tag start directly with a frame header
+	"audio/mpeg": isMPEGAudioFrame,
+
+	// raw AAC voice recordings are ADTS streams
+	"audio/aac": isADTSFrame,
+}
+
+// SniffContentType detects the content type of the given leading bytes.
+func SniffContentType(head []byte) string {
+	return baseMIMEType(http.DetectContentType(head))
+}
+
+// contentMatches reports whether the content type sniffed from the leading bytes head is
+// consistent with the declared MIME type.
+func contentMatches(declared string, sniffed string, head []byte) bool {
+	declared = baseMIMEType(declared)
+
+	if sniffed == declared {
+		return true
+	}
+
+	if sniffer, ok := frameSniffers[declared]; ok && sniffer(head) {
+		return true
+	}
+
+	for _, alias := range sniffAliases[declared] {
+		if alias == sniffed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isMPEGAudioFrame reports whether head starts with an MPEG audio frame header: the 11-bit sync
+// word followed by a defined version and layer, a bitrate other than free or invalid, and a defined
+// sampling rate.
+func isMPEGAudioFrame(head []byte) bool {
+	if len(head) < 4 || head[0] != 0xFF || head[1]&0xE0 != 0xE0 {
+		return false
+	}
+
+	version := head[1] >> 3 & 0x03
+	layer := head[1] >> 1 & 0x03
+	bitrate := head[2] >> 4
+	sampleRate := head[2] >> 2 & 0x03
+
+	return version != 0x01 && layer != 0x00 && bitrate != 0x00 && bitrate != 0x0F && sampleRate != 0x03
+}
+
+// isADTSFrame reports whether head starts with an ADTS frame header: the 12-bit sync word and
+// layer 0, followed by a defined sampling frequency and a frame length covering at least the header.
+func isADTSFrame(head []byte) bool {
+	if len(head) < 7 || head[0] != 0xFF || head[1]&0xF6 != 0xF0 {
+		return false
+	}
+
+	sampleRate := head[2] >> 2 & 0x0F
+	frameLength := int(head[3]&0x03)<<11 | int(head[4])<<3 | int(head[5]>>5)
+
+	return sampleRate < 13 && frameLength >= 7
+}
@@ -0,0 +1,51 @@
+package chat
+
+import "testing"
+
+func TestContentMatchesMPEGFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{name: "ID3 tag", head: []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), want: true},
+		{name: "MPEG-1 layer III frame", head: []byte{0xFF, 0xFB, 0x90, 0x64, 0x00}, want: true},
+		{name: "MPEG-2 layer III frame", head: []byte{0xFF, 0xF3, 0x64, 0xC4, 0x00}, want: true},
+		{name: "reserved version", head: []byte{0xFF, 0xEB, 0x90, 0x64}},
+		{name: "reserved layer", head: []byte{0xFF, 0xF9, 0x90, 0x64}},
+		{name: "free bitrate", head: []byte{0xFF, 0xFB, 0x00, 0x64}},
+		{name: "invalid bitrate", head: []byte{0xFF, 0xFB, 0xF0, 0x64}},
+		{name: "reserved sampling rate", head: []byte{0xFF, 0xFB, 0x9C, 0x64}},
+		{name: "truncated header", head: []byte{0xFF, 0xFB, 0x90}},
+		{name: "unknown binary", head: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}},
+		{name: "executable", head: []byte("MZ\x90\x00\x03\x00\x00\x00")},
+	}
+
+	for _, tt := range tests {
+		if got := contentMatches("audio/mpeg", SniffContentType(tt.head), tt.head); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContentMatchesADTSFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{name: "AAC-LC frame", head: []byte{0xFF, 0xF1, 0x50, 0x80, 0x2E, 0x7F, 0xFC, 0x21}, want: true},
+		{name: "MPEG-2 frame with CRC", head: []byte{0xFF, 0xF8, 0x50, 0x80, 0x2E, 0x7F, 0xFC}, want: true},
+		{name: "MP3 frame", head: []byte{0xFF, 0xFB, 0x90, 0x64, 0x00, 0x00, 0x00}},
+		{name: "reserved sampling frequency", head: []byte{0xFF, 0xF1, 0x74, 0x80, 0x2E, 0x7F, 0xFC}},
+		{name: "frame shorter than its header", head: []byte{0xFF, 0xF1, 0x50, 0x80, 0x00, 0x1F, 0xFC}},
+		{name: "truncated header", head: []byte{0xFF, 0xF1, 0x50, 0x80, 0x2E}},
+		{name: "unknown binary", head: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}},
+	}
+
+	for _, tt := range tests {
+		if got := contentMatches("audio/aac", SniffContentType(tt.head), tt.head); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the UploadSessions registry, which remembers the multipart uploads started by
+room members so that part URLs and completion are only granted to the member who initiated the
+upload, with the total size and part layout fixed at initiation.
+*/
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// UploadSessionTTL is how long a multipart upload may stay in progress before it is refused.
+const UploadSessionTTL = time.Hour
+
+// UploadSession describes a multipart upload initiated by a room member.
+type UploadSession struct {
+	Key       string
+	UploadID  string
+	RoomCode  string
+	UserID    string
+	MimeType  string
+	Size      int64
+	PartSize  int64
+	PartCount int32
+	ExpiresAt time.Time
+}
+
+// PartLength returns the size of the given part: every part is PartSize bytes except the last,
+// which holds the remainder.
+func (s UploadSession) PartLength(partNumber int32) int64 {
+	if partNumber < s.PartCount {
+		return s.PartSize
+	}
+	return s.Size - int64(s.PartCount-1)*s.PartSize
+}
+
+// UploadSessions tracks the in-progress multipart uploads of all rooms, keyed by upload ID.
+type UploadSessions struct {
+	// mu protects concurrent access to the sessions map.
+	mu       sync.Mutex
+	sessions map[string]UploadSession
+}
+
+// NewUploadSessions creates an empty registry.
+func NewUploadSessions() *UploadSessions {
+	return &UploadSessions{sessions: make(map[string]UploadSession)}
+}
+
+// Add registers a new session, setting its expiry.
+func (u *UploadSessions) Add(s UploadSession) {
+	s.ExpiresAt = time.Now().Add(UploadSessionTTL)
+
+	u.mu.Lock()
+	u.sessions[s.UploadID] = s
+	u.mu.Unlock()
+}
+
+// Get returns the session of the upload if it is still valid and was started by the given
+// user in the given room for the given key.
+func (u *UploadSessions) Get(uploadID, key, roomCode, userID string) (UploadSession, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	s, ok := u.sessions[uploadID]
+	if !ok {
+		return UploadSession{}, false
+	}
+
+	if time.Now().After(s.ExpiresAt) {
+		delete(u.sessions, uploadID)
+		return UploadSession{}, false
+	}
+
+	if s.Key != key || s.RoomCode != roomCode || s.UserID != userID {
+		return UploadSession{}, false
+	}
+
+	return s, true
+}
+
+// Remove forgets the session, e.g. once the upload has been completed or aborted.
+func (u *UploadSessions) Remove(uploadID string) {
+	u.mu.Lock()
+	delete(u.sessions, uploadID)
+	u.mu.Unlock()
+}
+
+// RemoveRoom forgets every session of the room. The uploads themselves are aborted in storage
+// by the attachment purger.
+func (u *UploadSessions) RemoveRoom(roomCode string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for id, s := range u.sessions {
+		if s.RoomCode == roomCode {
+			delete(u.sessions, id)
+		}
+	}
+}
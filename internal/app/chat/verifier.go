@@ -0,0 +1,321 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the AttachmentVerifier, which confirms that every attachment key sent by a
+client refers to an uploaded object whose size and content type match what the client declared,
+and quarantines objects whose leading bytes reveal a different real content type or that the
+malware scanner flags. The verdict is tied to the object's ETag: an object rewritten after its
+verification, e.g. through a presigned upload URL that is still valid, is quarantined as well.
+*/
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hzchat/internal/app/storage"
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/logx"
+)
+
+const (
+	// verifyTimeout bounds the storage lookups and malware scans performed for a single message.
+	verifyTimeout = time.Minute
+
+	// verifyCacheTTL is how long the metadata of an uploaded object is cached per key. It must
+	// exceed PresignedURLDuration, so that a rewrite through the upload URL is always detected.
+	verifyCacheTTL = 10 * time.Minute
+)
+
+// objectInfo is the cached server-side view of an uploaded object.
+type objectInfo struct {
+	size        int64
+	contentType string
+	etag        string
+	sniffedType string
+	quarantined bool
+	infected    bool
+	expiresAt   time.Time
+}
+
+// errScanUnavailable is returned by lookup when the object could not be scanned
+// and the verifier fails closed.
+var errScanUnavailable = errors.New("attachment scan unavailable")
+
+// AttachmentVerifier checks attachments against the metadata of the stored objects.
+// Metadata is cached per key so repeated references to the same upload cost a single lookup.
+type AttachmentVerifier struct {
+	storage storage.StorageService
+	scanner AttachmentScanner
+
+	// scanFailOpen accepts objects unscanned while the scanner fails, instead of refusing them.
+	scanFailOpen bool
+
+	// mu protects concurrent access to the cache and rewriting maps.
+	mu    sync.Mutex
+	cache map[string]objectInfo
+
+	// rewriting counts the server-side rewrites in progress per key, whose new ETag is expected.
+	rewriting map[string]int
+}
+
+// NewAttachmentVerifier creates a verifier backed by the given storage and malware scanner, and
+// starts a background goroutine to periodically evict expired cache entries. If scanFailOpen is
+// set, objects are accepted unscanned while the scanner fails; otherwise they are refused.
+func NewAttachmentVerifier(store storage.StorageService, scanner AttachmentScanner, scanFailOpen bool) *AttachmentVerifier {
+	v := &AttachmentVerifier{
+		storage:      store,
+		scanner:      scanner,
+		scanFailOpen: scanFailOpen,
+		cache:        make(map[string]objectInfo),
+		rewriting:    make(map[string]int),
+	}
+
+	go v.cleanUpCache()
+
+	return v
+}
+
+// Verify confirms that the attachment's object exists, that its Content-Length equals the
+// declared size and does not exceed maxSize, and that its Content-Type matches the declared MIME type.
+func (v *AttachmentVerifier) Verify(ctx context.Context, a Attachment, maxSize int64) *errs.CustomError {
+	info, err := v.lookup(ctx, a.Key)
+	if err != nil {
+		return lookupError(err, a.Key)
+	}
+
+	if info.size != a.Size {
+		return errs.NewError(errs.ErrAttachmentMismatch)
+	}
+
+	if err := ValidateFileSizeLimit(info.size, maxSize); err != nil {
+		return err
+	}
+
+	if !sameMIMEType(info.contentType, a.MimeType) {
+		return errs.NewError(errs.ErrAttachmentMismatch)
+	}
+
+	return quarantineError(info)
+}
+
+// CheckDownload confirms that the object exists, has not been quarantined and has not been
+// rewritten since its verification, so that a presigned download is never issued for content
+// that failed sniffing or scanning, or that was never checked.
+func (v *AttachmentVerifier) CheckDownload(ctx context.Context, key string) *errs.CustomError {
+	info, err := v.lookup(ctx, key)
+	if err != nil {
+		return lookupError(err, key)
+	}
+
+	return quarantineError(info)
+}
+
+// Forget drops the cached metadata of the key, e.g. after the object has been deleted.
+func (v *AttachmentVerifier) Forget(key string) {
+	v.mu.Lock()
+	delete(v.cache, key)
+	v.mu.Unlock()
+}
+
+// Rewrite replaces the object stored under key with server-produced content, such as a sanitized
+// image. The new version is verified again on its next lookup instead of being quarantined
+// as an unexpected rewrite.
+func (v *AttachmentVerifier) Rewrite(ctx context.Context, key string, data []byte, contentType string) error {
+	v.mu.Lock()
+	v.rewriting[key]++
+	v.mu.Unlock()
+
+	defer func() {
+		v.mu.Lock()
+		if v.rewriting[key]--; v.rewriting[key] <= 0 {
+			delete(v.rewriting, key)
+		}
+		delete(v.cache, key)
+		v.mu.Unlock()
+	}()
+
+	return v.storage.Put(ctx, key, data, contentType)
+}
+
+// lookup returns the object metadata for the key. The cached verdict is reused while the stored
+// ETag is unchanged; on a miss the first bytes of the object are also sniffed and the object is
+// scanned for malware. Objects whose real content does not match their stored Content-Type, that
+// the scanner flags, or that were rewritten after their verification by anyone but the server
+// are quarantined: refused from then on and removed from storage. Missing objects and objects that
+// could not be scanned are not cached, since the upload may still be in progress or the scanner may
+// recover.
+func (v *AttachmentVerifier) lookup(ctx context.Context, key string) (objectInfo, error) {
+	now := time.Now()
+
+	v.mu.Lock()
+	cached, ok := v.cache[key]
+	v.mu.Unlock()
+
+	ok = ok && now.Before(cached.expiresAt)
+	if ok && cached.quarantined {
+		return cached, nil
+	}
+
+	meta, err := v.storage.GetObjectMetadata(ctx, key)
+	if err != nil {
+		return objectInfo{}, err
+	}
+
+	if ok {
+		if meta[storage.MetaETag] == cached.etag {
+			return cached, nil
+		}
+		return v.rewritten(key, cached), nil
+	}
+
+	size, err := strconv.ParseInt(meta[storage.MetaContentLength], 10, 64)
+	if err != nil {
+		size = -1
+	}
+
+	info := objectInfo{
+		size:        size,
+		contentType: meta[storage.MetaContentType],
+		etag:        meta[storage.MetaETag],
+		expiresAt:   now.Add(verifyCacheTTL),
+	}
+
+	var head []byte
+	if size > 0 {
+		head, err = v.storage.ReadRange(ctx, key, 0, sniffLength)
+		if err != nil {
+			return objectInfo{}, err
+		}
+		info.sniffedType = SniffContentType(head)
+	}
+
+	if info.sniffedType == "" || !contentMatches(info.contentType, info.sniffedType, head) {
+		logx.Warn("Attachment quarantined: content does not match declared type.",
+			"file_key", key,
+			"declared_type", info.contentType,
+			"sniffed_type", info.sniffedType,
+		)
+
+		info.quarantined = true
+		v.quarantine(key)
+	} else {
+		threat, err := v.scanner.Scan(ctx, key, size)
+		switch {
+		case err != nil && !v.scanFailOpen:
+			return objectInfo{}, fmt.Errorf("%w: %w", errScanUnavailable, err)
+		case err != nil:
+			logx.Error(err, "Failed to scan attachment, accepting it unscanned", "file_key", key)
+		case threat != "":
+			logx.Warn("Attachment quarantined: malware detected.", "file_key", key, "threat", threat)
+
+			info.quarantined = true
+			info.infected = true
+			v.quarantine(key)
+		}
+	}
+
+	// a verdict on the version being replaced by the server would quarantine the new one
+	v.mu.Lock()
+	if v.rewriting[key] == 0 {
+		v.cache[key] = info
+	}
+	v.mu.Unlock()
+
+	return info, nil
+}
+
+// rewritten handles an object whose ETag changed after its verification. While the server
+// rewrites it, the previous verdict stands; otherwise the object was replaced through a
+// presigned upload URL with content that was never checked, and is quarantined.
+func (v *AttachmentVerifier) rewritten(key string, cached objectInfo) objectInfo {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.rewriting[key] > 0 {
+		return cached
+	}
+
+	logx.Warn("Attachment quarantined: object rewritten after verification.", "file_key", key)
+
+	cached.quarantined = true
+	v.cache[key] = cached
+	v.quarantine(key)
+
+	return cached
+}
+
+// quarantine removes an object whose content failed sniffing or scanning from storage.
+// The cache entry keeps refusing the key until it expires, after which the object is gone.
+func (v *AttachmentVerifier) quarantine(key string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+		defer cancel()
+
+		if err := v.storage.Delete(ctx, key); err != nil {
+			logx.Error(err, "Failed to delete quarantined attachment", "file_key", key)
+		}
+	}()
+}
+
+// cleanUpCache periodically removes expired cache entries.
+func (v *AttachmentVerifier) cleanUpCache() {
+	ticker := time.NewTicker(verifyCacheTTL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+
+		v.mu.Lock()
+		for key, info := range v.cache {
+			if now.After(info.expiresAt) {
+				delete(v.cache, key)
+			}
+		}
+		v.mu.Unlock()
+	}
+}
+
+// lookupError maps a failed lookup to the error reported to the client.
+func lookupError(err error, key string) *errs.CustomError {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return errs.NewError(errs.ErrAttachmentNotFound)
+	case errors.Is(err, errScanUnavailable):
+		logx.Error(err, "Failed to scan attachment", "file_key", key)
+		return errs.NewError(errs.ErrAttachmentScanUnavailable)
+	default:
+		logx.Error(err, "Failed to fetch attachment metadata", "file_key", key)
+		return errs.NewError(errs.ErrFileStorageFailed)
+	}
+}
+
+// quarantineError returns the error reported for a quarantined object, or nil.
+func quarantineError(info objectInfo) *errs.CustomError {
+	switch {
+	case info.infected:
+		return errs.NewError(errs.ErrAttachmentInfected)
+	case info.quarantined:
+		return errs.NewError(errs.ErrAttachmentContentInvalid)
+	default:
+		return nil
+	}
+}
+
+// sameMIMEType compares two MIME types, ignoring case and parameters such as charset.
+func sameMIMEType(a, b string) bool {
+	return baseMIMEType(a) == baseMIMEType(b)
+}
+
+func baseMIMEType(t string) string {
+	if mediaType, _, err := mime.ParseMediaType(t); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(t))
+}
@@ -0,0 +1,188 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the ViewOnceTracker, which grants every recipient of a view-once attachment a
+single download, and deletes the object once all recipients have opened it or it has expired.
+*/
+package chat
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"hzchat/internal/app/storage"
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/logx"
+)
+
+const (
+	// ViewOnceTimeout is how long a view-once attachment stays available to the recipients
+	// who have not opened it yet.
+	ViewOnceTimeout = time.Hour
+
+	// ViewOnceURLDuration is the validity of the single download URL issued to each recipient.
+	// The object is kept this long after the last recipient opened it, so the download can finish.
+	ViewOnceURLDuration = time.Minute
+)
+
+// Reasons reported in a ViewOnceConsumedPayload.
+const (
+	ViewOnceReasonOpened  = "opened"
+	ViewOnceReasonExpired = "expired"
+)
+
+// viewOnceEntry tracks the recipients of a view-once attachment who have not opened it yet.
+type viewOnceEntry struct {
+	room    *Room
+	pending map[string]struct{}
+	timer   *time.Timer
+}
+
+// ViewOnceTracker tracks the per-recipient consumption of view-once attachments, keyed by object key.
+type ViewOnceTracker struct {
+	storage  storage.StorageService
+	verifier *AttachmentVerifier
+
+	// timeout and urlDuration are ViewOnceTimeout and ViewOnceURLDuration, shortened by tests.
+	timeout     time.Duration
+	urlDuration time.Duration
+
+	// mu protects concurrent access to the entries map.
+	mu      sync.Mutex
+	entries map[string]*viewOnceEntry
+
+	logger zerolog.Logger
+}
+
+// NewViewOnceTracker creates a tracker deleting consumed objects from the given storage.
+func NewViewOnceTracker(store storage.StorageService, verifier *AttachmentVerifier) *ViewOnceTracker {
+	return &ViewOnceTracker{
+		storage:     store,
+		verifier:    verifier,
+		timeout:     ViewOnceTimeout,
+		urlDuration: ViewOnceURLDuration,
+		entries:     make(map[string]*viewOnceEntry),
+		logger:      logx.Logger().With().Str("component", "ViewOnceTracker").Logger(),
+	}
+}
+
+// Check reports whether the key is a tracked view-once attachment, like Claim, without
+// recording the claim, so that callers may prepare the download before claiming it.
+func (t *ViewOnceTracker) Check(key string, userID string) (bool, *errs.CustomError) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok, err := t.pending(key, userID)
+	return ok, err
+}
+
+// Claim records that the user opens the view-once attachment stored under key. It returns false
+// if the key is not a tracked view-once attachment, and ErrViewOnceUnavailable if the user is not
+// a recipient or has already opened it. After the last recipient's claim the object is deleted
+// once their download URL has expired.
+func (t *ViewOnceTracker) Claim(key string, userID string) (bool, *errs.CustomError) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok, err := t.pending(key, userID)
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	delete(entry.pending, userID)
+
+	if len(entry.pending) == 0 {
+		entry.timer.Stop()
+		entry.timer = time.AfterFunc(t.urlDuration, func() { t.finish(key, entry, ViewOnceReasonOpened) })
+	}
+
+	return true, nil
+}
+
+// pending returns the entry of a tracked view-once attachment the user has yet to open.
+// The caller must hold t.mu.
+func (t *ViewOnceTracker) pending(key string, userID string) (*viewOnceEntry, bool, *errs.CustomError) {
+	entry, ok := t.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if _, pending := entry.pending[userID]; !pending {
+		return nil, true, errs.NewError(errs.ErrViewOnceUnavailable)
+	}
+
+	return entry, true, nil
+}
+
+// track starts tracking the view-once attachments of a message broadcast in the room to the given recipients.
+func (t *ViewOnceTracker) track(room *Room, keys []string, recipients []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		entry := &viewOnceEntry{
+			room:    room,
+			pending: make(map[string]struct{}, len(recipients)),
+		}
+		for _, id := range recipients {
+			entry.pending[id] = struct{}{}
+		}
+
+		timeout := t.timeout
+		if len(recipients) == 0 {
+			timeout = t.urlDuration
+		}
+
+		entry.timer = time.AfterFunc(timeout, func() { t.finish(key, entry, ViewOnceReasonExpired) })
+		t.entries[key] = entry
+	}
+}
+
+// finish deletes a consumed or expired view-once attachment and announces it to the room.
+func (t *ViewOnceTracker) finish(key string, entry *viewOnceEntry, reason string) {
+	t.mu.Lock()
+	if t.entries[key] != entry {
+		// the room was closed, or the entry was replaced in the meantime
+		t.mu.Unlock()
+		return
+	}
+	delete(t.entries, key)
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	if err := t.storage.Delete(ctx, key); err != nil {
+		t.logger.Error().Err(err).Str("file_key", key).Msg("Failed to delete view-once attachment.")
+	}
+	t.verifier.Forget(key)
+
+	msg, err := NewMessage(TypeViewOnceConsumed, entry.room.Code, SystemUser, ViewOnceConsumedPayload{
+		FileKey: key,
+		Reason:  reason,
+	})
+	if err != nil {
+		t.logger.Error().Err(err).Msg("Failed to build VIEW_ONCE_CONSUMED message.")
+		return
+	}
+
+	if !entry.room.announce(msg) {
+		t.logger.Warn().Str("file_key", key).Msg("VIEW_ONCE_CONSUMED dropped: Room inbound queue full or room stopped.")
+	}
+}
+
+// forgetRoom stops tracking the attachments of a closed room, which are purged with its other files.
+func (t *ViewOnceTracker) forgetRoom(roomCode string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, entry := range t.entries {
+		if entry.room.Code == roomCode {
+			entry.timer.Stop()
+			delete(t.entries, key)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"hzchat/internal/app/storage"
+	"hzchat/internal/configs"
+	"hzchat/internal/pkg/errs"
+)
+
+// newTestViewOnce returns a tracker with shortened timeouts and a stored view-once object.
+func newTestViewOnce(t *testing.T, timeout time.Duration) (*ViewOnceTracker, *storage.MemoryStore) {
+	t.Helper()
+
+	store := storage.NewMemoryStore("private")
+	if err := store.Put(context.Background(), "ABC123/secret.jpg", []byte("secret"), "image/jpeg"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	tracker := NewViewOnceTracker(store, &AttachmentVerifier{cache: make(map[string]objectInfo)})
+	tracker.timeout = timeout
+	tracker.urlDuration = 10 * time.Millisecond
+
+	return tracker, store
+}
+
+// nextConsumed waits for the VIEW_ONCE_CONSUMED announcement submitted to the room.
+func nextConsumed(t *testing.T, room *Room) ViewOnceConsumedPayload {
+	t.Helper()
+
+	select {
+	case in := <-room.inbound:
+		if in.message.Type != TypeViewOnceConsumed {
+			t.Fatalf("got %s message, want %s", in.message.Type, TypeViewOnceConsumed)
+		}
+
+		var payload ViewOnceConsumedPayload
+		if err := json.Unmarshal(in.message.Payload, &payload); err != nil {
+			t.Fatalf("decode payload: %v", err)
+		}
+		return payload
+	case <-time.After(time.Second):
+		t.Fatal("no VIEW_ONCE_CONSUMED announcement")
+		return ViewOnceConsumedPayload{}
+	}
+}
+
+func TestViewOnceTrackerFinishes(t *testing.T) {
+	tests := []struct {
+		name       string
+		recipients []string
+		claims     []string
+		wantReason string
+	}{
+		{name: "unopened", recipients: []string{"u1", "u2"}, wantReason: ViewOnceReasonExpired},
+		{name: "partly opened", recipients: []string{"u1", "u2"}, claims: []string{"u1"}, wantReason: ViewOnceReasonExpired},
+		{name: "opened by all", recipients: []string{"u1", "u2"}, claims: []string{"u1", "u2"}, wantReason: ViewOnceReasonOpened},
+		{name: "no recipients", wantReason: ViewOnceReasonExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, store := newTestViewOnce(t, 50*time.Millisecond)
+			room := newTestRoom(t, configs.FloodPolicy{})
+
+			tracker.track(room, []string{"ABC123/secret.jpg"}, tt.recipients)
+			for _, id := range tt.claims {
+				if tracked, err := tracker.Claim("ABC123/secret.jpg", id); !tracked || err != nil {
+					t.Fatalf("claim by %s: got %v, %v", id, tracked, err)
+				}
+			}
+
+			if got := nextConsumed(t, room); got.FileKey != "ABC123/secret.jpg" || got.Reason != tt.wantReason {
+				t.Fatalf("got %+v, want reason %q", got, tt.wantReason)
+			}
+			if store.Has("ABC123/secret.jpg") {
+				t.Fatal("finished view-once object was not deleted")
+			}
+			if tracked, _ := tracker.Claim("ABC123/secret.jpg", "u2"); tracked {
+				t.Fatal("finished view-once object is still tracked")
+			}
+		})
+	}
+}
+
+func TestViewOnceTrackerClaim(t *testing.T) {
+	tracker, store := newTestViewOnce(t, time.Hour)
+	room := newTestRoom(t, configs.FloodPolicy{})
+	tracker.track(room, []string{"ABC123/secret.jpg"}, []string{"u1", "u2"})
+
+	// checking does not use up the view
+	for range 2 {
+		if tracked, err := tracker.Check("ABC123/secret.jpg", "u1"); !tracked || err != nil {
+			t.Fatalf("check: got %v, %v", tracked, err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		key, userID string
+		wantTracked bool
+		wantErr     bool
+	}{
+		{name: "recipient", key: "ABC123/secret.jpg", userID: "u1", wantTracked: true},
+		{name: "second claim", key: "ABC123/secret.jpg", userID: "u1", wantTracked: true, wantErr: true},
+		{name: "not a recipient", key: "ABC123/secret.jpg", userID: "u3", wantTracked: true, wantErr: true},
+		{name: "regular attachment", key: "ABC123/other.jpg", userID: "u1"},
+	}
+
+	for _, tt := range tests {
+		tracked, err := tracker.Claim(tt.key, tt.userID)
+		if tracked != tt.wantTracked || (err != nil) != tt.wantErr {
+			t.Fatalf("%s: got %v, %v", tt.name, tracked, err)
+		}
+		if err != nil && err.Code != errs.ErrViewOnceUnavailable {
+			t.Fatalf("%s: got code %d, want %d", tt.name, err.Code, errs.ErrViewOnceUnavailable)
+		}
+	}
+
+	// closing the room stops the timers; its files are purged with the others
+	tracker.forgetRoom(room.Code)
+	if tracked, _ := tracker.Claim("ABC123/secret.jpg", "u2"); tracked {
+		t.Fatal("attachment of a closed room is still tracked")
+	}
+	if !store.Has("ABC123/secret.jpg") {
+		t.Fatal("forgetting the room deleted the object")
+	}
+}
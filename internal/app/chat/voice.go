@@ -0,0 +1,56 @@
+/*
+Package chat contains the core logic for handling real-time chat rooms, user connections, and message broadcasting.
+
+This file defines the validation of voice messages, whose declared duration must be plausible
+for the size of the recording given the bitrates used by voice codecs.
+*/
+package chat
+
+import (
+	"hzchat/internal/pkg/errs"
+)
+
+const (
+	// MaxVoiceDurationMs is the maximum length of a voice message (10 minutes).
+	MaxVoiceDurationMs = 10 * 60 * 1000
+
+	// MaxWaveformBuckets is the maximum number of values in a voice message waveform.
+	MaxWaveformBuckets = 100
+
+	// voiceMinBitrate and voiceMaxBitrate (bits per second) bound the audio bitrate of a
+	// recording. Opus with discontinuous transmission goes as low as ~1 kbps on silence,
+	// and neither Opus nor AAC exceed 512 kbps.
+	voiceMinBitrate = 1000
+	voiceMaxBitrate = 512000
+
+	// voiceContainerOverhead is the allowance in bytes for container headers and metadata,
+	// which dominate the size of very short recordings.
+	voiceContainerOverhead = 16 * 1024
+)
+
+// ValidateVoice checks the duration and waveform of a voice message, and that the duration is
+// consistent with the size of the recording.
+func ValidateVoice(p VoicePayload) *errs.CustomError {
+	if p.DurationMs <= 0 || p.DurationMs > MaxVoiceDurationMs {
+		return errs.NewError(errs.ErrVoiceInvalid)
+	}
+
+	if len(p.Waveform) > MaxWaveformBuckets {
+		return errs.NewError(errs.ErrVoiceInvalid)
+	}
+
+	for _, v := range p.Waveform {
+		if v < 0 || v > 255 {
+			return errs.NewError(errs.ErrVoiceInvalid)
+		}
+	}
+
+	minSize := p.DurationMs * voiceMinBitrate / 8 / 1000
+	maxSize := p.DurationMs*voiceMaxBitrate/8/1000 + voiceContainerOverhead
+
+	if p.Attachment.Size < minSize || p.Attachment.Size > maxSize {
+		return errs.NewError(errs.ErrVoiceInvalid)
+	}
+
+	return nil
+}
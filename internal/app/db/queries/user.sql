@@ -62,4 +62,12 @@ SET
   password_hash = $2,
   updated_at = NOW()
 WHERE id = $1 
+  AND deleted_at IS NULL;
+
+-- name: ListAvatarKeys :many
+-- Lists the avatar keys referenced by active users, used by the storage garbage collector.
+SELECT avatar_url
+FROM users
+WHERE avatar_url IS NOT NULL
+  AND avatar_url <> ''
   AND deleted_at IS NULL;
\ No newline at end of file
@@ -18,6 +18,8 @@ type Querier interface {
 	// Retrieves an active user by their username for authentication purposes.
 	// Only returns users who have not been soft-deleted.
 	GetUserByUsername(ctx context.Context, username string) (GetUserByUsernameRow, error)
+	// Lists the avatar keys referenced by active users, used by the storage garbage collector.
+	ListAvatarKeys(ctx context.Context) ([]pgtype.Text, error)
 	// Updates the last login timestamp for a specific user.
 	UpdateLastLogin(ctx context.Context, id pgtype.UUID) error
 	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
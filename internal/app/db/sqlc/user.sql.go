@@ -127,6 +127,35 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (GetUs
 	return i, err
 }
 
+const listAvatarKeys = `-- name: ListAvatarKeys :many
+SELECT avatar_url
+FROM users
+WHERE avatar_url IS NOT NULL
+  AND avatar_url <> ''
+  AND deleted_at IS NULL
+`
+
+// Lists the avatar keys referenced by active users, used by the storage garbage collector.
+func (q *Queries) ListAvatarKeys(ctx context.Context) ([]pgtype.Text, error) {
+	rows, err := q.db.Query(ctx, listAvatarKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.Text
+	for rows.Next() {
+		var avatar_url pgtype.Text
+		if err := rows.Scan(&avatar_url); err != nil {
+			return nil, err
+		}
+		items = append(items, avatar_url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateLastLogin = `-- name: UpdateLastLogin :exec
 UPDATE users 
 SET last_login_at = NOW()
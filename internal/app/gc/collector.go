@@ -0,0 +1,294 @@
+/*
+Package gc implements the storage garbage collector, which removes objects that are no longer
+referenced by the application.
+
+It covers the cases the room purge cannot: uploads that were never sent in a message, rooms
+lost to a server restart, and previous avatars whose deletion failed when a profile changed.
+Room objects are kept only while the RoomDirectory knows their room, so the directory must
+cover every instance that stores attachments in the same bucket.
+*/
+package gc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog"
+
+	"hzchat/internal/app/storage"
+	"hzchat/internal/app/user"
+	"hzchat/internal/pkg/logx"
+	"hzchat/internal/pkg/randx"
+)
+
+const (
+	// runTimeout bounds a single collection run.
+	runTimeout = 10 * time.Minute
+)
+
+// Reasons recorded in the report for each removed object.
+const (
+	ReasonInactiveRoom       = "inactive_room"
+	ReasonUnreferencedAvatar = "unreferenced_avatar"
+)
+
+// RoomDirectory reports whether a room is currently active.
+type RoomDirectory interface {
+	HasRoom(roomCode string) bool
+}
+
+// AvatarDirectory lists the avatar keys referenced by users.
+type AvatarDirectory interface {
+	ListAvatarKeys(ctx context.Context) ([]pgtype.Text, error)
+}
+
+// Config controls how often the collector runs and what it removes.
+type Config struct {
+	// Interval between collection runs.
+	Interval time.Duration
+
+	// GracePeriod is the minimum age of an object before it may be removed,
+	// protecting uploads whose message or profile update is still in flight.
+	GracePeriod time.Duration
+
+	// DryRun reports what would be removed without deleting anything.
+	DryRun bool
+}
+
+// Deps holds the stores and directories the collector inspects.
+type Deps struct {
+	PrivateStorage storage.StorageService
+	PublicStorage  storage.StorageService
+	Rooms          RoomDirectory
+	Avatars        AvatarDirectory
+}
+
+// RemovedObject is a single entry of a collection report.
+type RemovedObject struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	Reason       string    `json:"reason"`
+}
+
+// Report summarizes a collection run.
+type Report struct {
+	StartedAt    time.Time       `json:"startedAt"`
+	FinishedAt   time.Time       `json:"finishedAt"`
+	DryRun       bool            `json:"dryRun"`
+	Scanned      int             `json:"scanned"`
+	Removed      []RemovedObject `json:"removed"`
+	RemovedBytes int64           `json:"removedBytes"`
+	Errors       []string        `json:"errors,omitempty"`
+}
+
+// Collector periodically removes orphaned objects from the storage buckets.
+type Collector struct {
+	cfg  Config
+	deps Deps
+
+	// mu protects lastReport.
+	mu         sync.Mutex
+	lastReport *Report
+
+	logger zerolog.Logger
+}
+
+// New creates a Collector. Call Run to start it.
+func New(cfg Config, deps Deps) *Collector {
+	return &Collector{
+		cfg:    cfg,
+		deps:   deps,
+		logger: logx.Logger().With().Str("component", "StorageGC").Logger(),
+	}
+}
+
+// Run collects garbage every Interval until ctx is cancelled.
+func (c *Collector) Run(ctx context.Context) {
+	c.logger.Info().
+		Dur("interval", c.cfg.Interval).
+		Dur("grace_period", c.cfg.GracePeriod).
+		Bool("dry_run", c.cfg.DryRun).
+		Msg("Storage garbage collector started.")
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Info().Msg("Storage garbage collector stopped.")
+			return
+		case <-ticker.C:
+			c.RunOnce(ctx)
+		}
+	}
+}
+
+// RunOnce performs a single collection run and returns its report.
+func (c *Collector) RunOnce(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+
+	report := &Report{
+		StartedAt: time.Now(),
+		DryRun:    c.cfg.DryRun,
+	}
+
+	c.collectRoomObjects(ctx, report)
+	c.collectAvatars(ctx, report)
+
+	report.FinishedAt = time.Now()
+
+	c.mu.Lock()
+	c.lastReport = report
+	c.mu.Unlock()
+
+	c.logger.Info().
+		Bool("dry_run", report.DryRun).
+		Int("scanned", report.Scanned).
+		Int("removed", len(report.Removed)).
+		Int64("removed_bytes", report.RemovedBytes).
+		Int("errors", len(report.Errors)).
+		Dur("took", report.FinishedAt.Sub(report.StartedAt)).
+		Msg("Storage garbage collection finished.")
+
+	return report
+}
+
+// LastReport returns the report of the most recent run, or nil if none has completed.
+func (c *Collector) LastReport() *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastReport
+}
+
+// collectRoomObjects removes private objects stored under the prefix of a room that is no longer active.
+func (c *Collector) collectRoomObjects(ctx context.Context, report *Report) {
+	objects, err := c.deps.PrivateStorage.List(ctx, "")
+	if err != nil {
+		c.fail(report, "list private bucket", err)
+		return
+	}
+
+	var garbage []storage.Object
+	for _, obj := range objects {
+		report.Scanned++
+
+		roomCode, _, ok := strings.Cut(obj.Key, "/")
+		if !ok || !randx.IsValidRoomCode(roomCode) {
+			// not an attachment key; leave it alone
+			continue
+		}
+
+		if c.deps.Rooms.HasRoom(roomCode) || !c.expired(obj) {
+			continue
+		}
+
+		garbage = append(garbage, obj)
+	}
+
+	c.remove(ctx, report, "private", c.deps.PrivateStorage, garbage, ReasonInactiveRoom)
+}
+
+// collectAvatars removes avatars under avatars/<userID>/ that no user references, including
+// uploads whose variants failed to replace them.
+func (c *Collector) collectAvatars(ctx context.Context, report *Report) {
+	referenced, err := c.deps.Avatars.ListAvatarKeys(ctx)
+	if err != nil {
+		c.fail(report, "list avatar references", err)
+		return
+	}
+
+	// a profile references one variant of its avatar; the other sizes are in use as well
+	inUse := make(map[string]struct{}, len(referenced)*len(user.AvatarSizes))
+	for _, ref := range referenced {
+		for _, key := range user.AvatarKeys(strings.TrimLeft(ref.String, "/")) {
+			inUse[key] = struct{}{}
+		}
+	}
+
+	objects, err := c.deps.PublicStorage.List(ctx, user.AvatarPrefix)
+	if err != nil {
+		c.fail(report, "list public bucket", err)
+		return
+	}
+
+	var garbage []storage.Object
+	for _, obj := range objects {
+		report.Scanned++
+
+		if _, ok := inUse[obj.Key]; ok || !c.expired(obj) {
+			continue
+		}
+
+		garbage = append(garbage, obj)
+	}
+
+	c.remove(ctx, report, "public", c.deps.PublicStorage, garbage, ReasonUnreferencedAvatar)
+}
+
+// remove deletes the objects (unless in dry-run mode) and records them in the report.
+func (c *Collector) remove(
+	ctx context.Context,
+	report *Report,
+	bucket string,
+	store storage.StorageService,
+	objects []storage.Object,
+	reason string,
+) {
+	if len(objects) == 0 {
+		return
+	}
+
+	if !c.cfg.DryRun {
+		keys := make([]string, 0, len(objects))
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+		}
+
+		if err := store.DeleteMany(ctx, keys); err != nil {
+			c.fail(report, "delete from "+bucket+" bucket", err)
+			return
+		}
+	}
+
+	message := "Orphaned object removed."
+	if c.cfg.DryRun {
+		message = "Orphaned object would be removed (dry run)."
+	}
+
+	for _, obj := range objects {
+		report.Removed = append(report.Removed, RemovedObject{
+			Bucket:       bucket,
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			Reason:       reason,
+		})
+		report.RemovedBytes += obj.Size
+
+		c.logger.Info().
+			Bool("dry_run", c.cfg.DryRun).
+			Str("bucket", bucket).
+			Str("file_key", obj.Key).
+			Int64("size", obj.Size).
+			Str("reason", reason).
+			Msg(message)
+	}
+}
+
+// expired reports whether the object is older than the grace period.
+func (c *Collector) expired(obj storage.Object) bool {
+	return !obj.LastModified.IsZero() && time.Since(obj.LastModified) > c.cfg.GracePeriod
+}
+
+func (c *Collector) fail(report *Report, step string, err error) {
+	c.logger.Error().Err(err).Str("step", step).Msg("Storage garbage collection step failed.")
+	report.Errors = append(report.Errors, step+": "+err.Error())
+}
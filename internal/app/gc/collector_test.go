@@ -0,0 +1,166 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"hzchat/internal/app/storage"
+)
+
+type fakeRooms map[string]bool
+
+func (f fakeRooms) HasRoom(roomCode string) bool { return f[roomCode] }
+
+type fakeAvatars []string
+
+func (f fakeAvatars) ListAvatarKeys(ctx context.Context) ([]pgtype.Text, error) {
+	keys := make([]pgtype.Text, 0, len(f))
+	for _, key := range f {
+		keys = append(keys, pgtype.Text{String: key, Valid: true})
+	}
+	return keys, nil
+}
+
+// fixture holds stores seeded with live objects and orphans.
+type fixture struct {
+	private *storage.MemoryStore
+	public  *storage.MemoryStore
+	deps    Deps
+
+	// survivors must never be removed; orphans are removed with the given reason.
+	survivors []string
+	orphans   map[string]string
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	f := &fixture{
+		private: storage.NewMemoryStore("private"),
+		public:  storage.NewMemoryStore("public"),
+		orphans: make(map[string]string),
+	}
+	f.deps = Deps{
+		PrivateStorage: f.private,
+		PublicStorage:  f.public,
+		Rooms:          fakeRooms{"LIVE01": true},
+		Avatars:        fakeAvatars{"/avatars/alice/100_256"},
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	put := func(store *storage.MemoryStore, key string, lastModified time.Time) {
+		if err := store.Put(context.Background(), key, []byte(key), "application/octet-stream"); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+		store.Touch(key, lastModified)
+	}
+
+	for key, reason := range map[string]string{
+		"GONE01/report.pdf":      ReasonInactiveRoom,
+		"GONE01/thumb_photo.jpg": ReasonInactiveRoom,
+	} {
+		put(f.private, key, old)
+		f.orphans[key] = reason
+	}
+	for _, key := range []string{"avatars/alice/90.webp", "avatars/alice/90_256", "avatars/bob/50_64"} {
+		put(f.public, key, old)
+		f.orphans[key] = ReasonUnreferencedAvatar
+	}
+
+	// an active room, an upload still in its grace period, a key outside any room,
+	// and every variant of the referenced avatar
+	put(f.private, "LIVE01/notes.txt", old)
+	put(f.private, "GONE02/just-uploaded.txt", time.Now())
+	put(f.private, "backups/dump.sql", old)
+	put(f.public, "avatars/alice/100_64", old)
+	put(f.public, "avatars/alice/100_128", old)
+	put(f.public, "avatars/alice/100_256", old)
+	put(f.public, "avatars/carol/300.webp", time.Now())
+	f.survivors = []string{
+		"LIVE01/notes.txt", "GONE02/just-uploaded.txt", "backups/dump.sql",
+		"avatars/alice/100_64", "avatars/alice/100_128", "avatars/alice/100_256", "avatars/carol/300.webp",
+	}
+
+	return f
+}
+
+// has reports whether the key is still stored in either bucket.
+func (f *fixture) has(key string) bool {
+	return f.private.Has(key) || f.public.Has(key)
+}
+
+func TestDryRunReportsOrphansWithoutDeleting(t *testing.T) {
+	f := newFixture(t)
+	c := New(Config{Interval: time.Hour, GracePeriod: time.Hour, DryRun: true}, f.deps)
+
+	if c.LastReport() != nil {
+		t.Fatalf("got a report before the first run")
+	}
+
+	report := c.RunOnce(context.Background())
+
+	if !report.DryRun || len(report.Errors) > 0 {
+		t.Fatalf("got report %+v", report)
+	}
+	if report.Scanned != len(f.orphans)+len(f.survivors) {
+		t.Fatalf("scanned %d objects, want %d", report.Scanned, len(f.orphans)+len(f.survivors))
+	}
+
+	var reported []string
+	var bytes int64
+	for _, removed := range report.Removed {
+		if reason, ok := f.orphans[removed.Key]; !ok || removed.Reason != reason {
+			t.Fatalf("reported %s (%s), want only orphans with their reason", removed.Key, removed.Reason)
+		}
+		reported = append(reported, removed.Key)
+		bytes += removed.Size
+	}
+	if len(reported) != len(f.orphans) {
+		t.Fatalf("reported %v, want every orphan", reported)
+	}
+	if report.RemovedBytes != bytes {
+		t.Fatalf("got %d removed bytes, want %d", report.RemovedBytes, bytes)
+	}
+
+	for key := range f.orphans {
+		if !f.has(key) {
+			t.Fatalf("dry run deleted %s", key)
+		}
+	}
+	if deletes := append(f.private.Deletes(), f.public.Deletes()...); len(deletes) > 0 {
+		t.Fatalf("dry run deleted %v", deletes)
+	}
+
+	if c.LastReport() != report {
+		t.Fatalf("last report is not the report of the run")
+	}
+}
+
+func TestRunRemovesOnlyOrphans(t *testing.T) {
+	f := newFixture(t)
+	c := New(Config{Interval: time.Hour, GracePeriod: time.Hour}, f.deps)
+
+	report := c.RunOnce(context.Background())
+	if report.DryRun || len(report.Removed) != len(f.orphans) || len(report.Errors) > 0 {
+		t.Fatalf("got report %+v", report)
+	}
+
+	for key := range f.orphans {
+		if f.has(key) {
+			t.Fatalf("orphan %s was not removed", key)
+		}
+	}
+	for _, key := range f.survivors {
+		if !f.has(key) {
+			t.Fatalf("%s was removed", key)
+		}
+	}
+
+	// a second run finds nothing left to remove
+	if again := c.RunOnce(context.Background()); len(again.Removed) > 0 {
+		t.Fatalf("second run removed %v", again.Removed)
+	}
+}
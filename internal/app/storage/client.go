@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -13,6 +17,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 // s3Client implements the StorageService interface, handling interactions with S3-compatible storage.
@@ -83,7 +88,8 @@ func (c *s3Client) PresignUpload(
 }
 
 // PresignDownload generates a presigned URL for downloading the specified file key.
-func (c *s3Client) PresignDownload(ctx context.Context, key string, duration time.Duration) (string, error) {
+// Header overrides are passed as the signed response-content-* query parameters.
+func (c *s3Client) PresignDownload(ctx context.Context, key string, duration time.Duration, opts DownloadOptions) (string, error) {
 	presignClient := s3.NewPresignClient(c.s3Client)
 
 	presignInput := &s3.GetObjectInput{
@@ -91,6 +97,13 @@ func (c *s3Client) PresignDownload(ctx context.Context, key string, duration tim
 		Key:    &key,
 	}
 
+	if opts.ContentType != "" {
+		presignInput.ResponseContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		presignInput.ResponseContentDisposition = aws.String(opts.ContentDisposition)
+	}
+
 	resp, err := presignClient.PresignGetObject(ctx, presignInput, s3.WithPresignExpires(duration))
 	if err != nil {
 		log.Printf("Failed to generate presigned URL for key %s: %v", key, err)
@@ -115,6 +128,80 @@ func (c *s3Client) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// deleteBatchSize is the maximum number of keys accepted by a single DeleteObjects request.
+const deleteBatchSize = 1000
+
+// List pages through ListObjectsV2 and returns every object under the prefix.
+func (c *s3Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+
+	paginator := s3.NewListObjectsV2Paginator(c.s3Client, &s3.ListObjectsV2Input{
+		Bucket: &c.cfg.BucketName,
+		Prefix: &prefix,
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("S3 list failed for prefix %s: %v", prefix, err)
+			return nil, errors.New("failed to list files in S3")
+		}
+
+		for _, obj := range page.Contents {
+			if obj.Key == nil {
+				continue
+			}
+
+			objects = append(objects, Object{
+				Key:          *obj.Key,
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+// DeleteMany removes the keys in batches of up to deleteBatchSize using DeleteObjects.
+// It returns an error if any batch fails or any individual key could not be deleted.
+func (c *s3Client) DeleteMany(ctx context.Context, keys []string) error {
+	failed := 0
+
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(keys))
+
+		objects := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		resp, err := c.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: &c.cfg.BucketName,
+			Delete: &types.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+
+		if err != nil {
+			log.Printf("S3 batch delete failed: %v", err)
+			return errors.New("failed to delete files from S3")
+		}
+
+		for _, e := range resp.Errors {
+			log.Printf("S3 batch delete failed for key %s: %s", aws.ToString(e.Key), aws.ToString(e.Message))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d files from S3", failed)
+	}
+
+	return nil
+}
+
 // GetObjectMetadata retrieves the metadata of an object.
 func (c *s3Client) GetObjectMetadata(ctx context.Context, key string) (map[string]string, error) {
 	resp, err := c.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
@@ -125,7 +212,7 @@ func (c *s3Client) GetObjectMetadata(ctx context.Context, key string) (map[strin
 	if err != nil {
 		var nf *types.NotFound
 		if errors.As(err, &nf) {
-			return nil, errors.New("file not found")
+			return nil, ErrNotFound
 		}
 		log.Printf("Failed to get S3 object metadata for key %s: %v", key, err)
 		return nil, errors.New("failed to fetch S3 metadata")
@@ -133,11 +220,249 @@ func (c *s3Client) GetObjectMetadata(ctx context.Context, key string) (map[strin
 
 	metadata := make(map[string]string)
 	if resp.ContentType != nil {
-		metadata["Content-Type"] = *resp.ContentType
+		metadata[MetaContentType] = *resp.ContentType
 	}
 	if resp.ContentLength != nil {
-		metadata["Content-Length"] = strconv.FormatInt(*resp.ContentLength, 10)
+		metadata[MetaContentLength] = strconv.FormatInt(*resp.ContentLength, 10)
+	}
+	if resp.ETag != nil {
+		metadata[MetaETag] = *resp.ETag
 	}
 
 	return metadata, nil
 }
+
+// ReadRange reads up to length bytes of the object starting at offset using an HTTP Range request.
+func (c *s3Client) ReadRange(ctx context.Context, key string, offset int64, length int64) ([]byte, error) {
+	resp, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &c.cfg.BucketName,
+		Key:    &key,
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+
+	if err != nil {
+		var nsk *types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, ErrNotFound
+		}
+		log.Printf("Failed to read S3 object range for key %s: %v", key, err)
+		return nil, errors.New("failed to read S3 object")
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, length))
+	if err != nil {
+		log.Printf("Failed to read S3 object body for key %s: %v", key, err)
+		return nil, errors.New("failed to read S3 object")
+	}
+
+	return data, nil
+}
+
+// Get downloads the whole object into memory, refusing objects larger than maxSize.
+func (c *s3Client) Get(ctx context.Context, key string, maxSize int64) ([]byte, error) {
+	resp, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &c.cfg.BucketName,
+		Key:    &key,
+	})
+
+	if err != nil {
+		var nsk *types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, ErrNotFound
+		}
+		log.Printf("Failed to get S3 object for key %s: %v", key, err)
+		return nil, errors.New("failed to get S3 object")
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength != nil && *resp.ContentLength > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		log.Printf("Failed to read S3 object body for key %s: %v", key, err)
+		return nil, errors.New("failed to get S3 object")
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
+
+// Put uploads data to the given key with the specified content type.
+func (c *s3Client) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := c.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:        &c.cfg.BucketName,
+		Key:           &key,
+		Body:          bytes.NewReader(data),
+		ContentType:   &contentType,
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+
+	if err != nil {
+		log.Printf("Failed to put S3 object for key %s: %v", key, err)
+		return errors.New("failed to put S3 object")
+	}
+
+	return nil
+}
+
+// Copy copies the object within the bucket using a server-side CopyObject request.
+func (c *s3Client) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	_, err := c.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     &c.cfg.BucketName,
+		Key:        &dstKey,
+		CopySource: aws.String(url.PathEscape(c.cfg.BucketName + "/" + srcKey)),
+	})
+
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NoSuchKey" || apiErr.ErrorCode() == "NotFound") {
+			return ErrNotFound
+		}
+		log.Printf("Failed to copy S3 object %s to %s: %v", srcKey, dstKey, err)
+		return errors.New("failed to copy S3 object")
+	}
+
+	return nil
+}
+
+// CreateMultipartUpload starts a multipart upload with the given content type.
+func (c *s3Client) CreateMultipartUpload(ctx context.Context, key string, mimeType string) (string, error) {
+	resp, err := c.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      &c.cfg.BucketName,
+		Key:         &key,
+		ContentType: &mimeType,
+	})
+
+	if err != nil {
+		log.Printf("Failed to create multipart upload for key %s: %v", key, err)
+		return "", errors.New("failed to create multipart upload")
+	}
+
+	return aws.ToString(resp.UploadId), nil
+}
+
+// PresignUploadPart generates a presigned URL for one part, bound to its exact size.
+func (c *s3Client) PresignUploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int32,
+	partSize int64,
+	duration time.Duration,
+) (string, error) {
+	presignClient := s3.NewPresignClient(c.s3Client)
+
+	resp, err := presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        &c.cfg.BucketName,
+		Key:           &key,
+		UploadId:      &uploadID,
+		PartNumber:    aws.Int32(partNumber),
+		ContentLength: aws.Int64(partSize),
+	}, s3.WithPresignExpires(duration))
+
+	if err != nil {
+		log.Printf("Failed to presign part %d of upload %s for key %s: %v", partNumber, uploadID, key, err)
+		return "", errors.New("failed to generate presigned part URL")
+	}
+
+	return resp.URL, nil
+}
+
+// CompleteMultipartUpload assembles the parts into the final object.
+func (c *s3Client) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []CompletedPart) error {
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, types.CompletedPart{
+			PartNumber: aws.Int32(p.PartNumber),
+			ETag:       aws.String(p.ETag),
+		})
+	}
+
+	_, err := c.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &c.cfg.BucketName,
+		Key:             &key,
+		UploadId:        &uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+
+	if err != nil {
+		var nsu *types.NoSuchUpload
+		if errors.As(err, &nsu) {
+			return ErrNotFound
+		}
+
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			switch apiErr.ErrorCode() {
+			case "InvalidPart", "InvalidPartOrder", "EntityTooSmall":
+				return ErrInvalidParts
+			}
+		}
+
+		log.Printf("Failed to complete multipart upload %s for key %s: %v", uploadID, key, err)
+		return errors.New("failed to complete multipart upload")
+	}
+
+	return nil
+}
+
+// AbortMultipartUpload aborts the upload. Uploads that no longer exist are not an error.
+func (c *s3Client) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	_, err := c.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &c.cfg.BucketName,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+
+	if err != nil {
+		var nsu *types.NoSuchUpload
+		if errors.As(err, &nsu) {
+			return nil
+		}
+		log.Printf("Failed to abort multipart upload %s for key %s: %v", uploadID, key, err)
+		return errors.New("failed to abort multipart upload")
+	}
+
+	return nil
+}
+
+// ListMultipartUploads pages through ListMultipartUploads and returns every upload under the prefix.
+func (c *s3Client) ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	var uploads []MultipartUpload
+
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: &c.cfg.BucketName,
+		Prefix: &prefix,
+	}
+
+	for {
+		resp, err := c.s3Client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			log.Printf("Failed to list multipart uploads for prefix %s: %v", prefix, err)
+			return nil, errors.New("failed to list multipart uploads")
+		}
+
+		for _, u := range resp.Uploads {
+			uploads = append(uploads, MultipartUpload{
+				Key:       aws.ToString(u.Key),
+				UploadID:  aws.ToString(u.UploadId),
+				Initiated: aws.ToTime(u.Initiated),
+			})
+		}
+
+		if !aws.ToBool(resp.IsTruncated) {
+			break
+		}
+
+		input.KeyMarker = resp.NextKeyMarker
+		input.UploadIdMarker = resp.NextUploadIdMarker
+	}
+
+	return uploads, nil
+}
@@ -0,0 +1,748 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// LocalRoutePrefix is the URL path under which local buckets are served, followed by the bucket name.
+	LocalRoutePrefix = "/storage/"
+
+	// objectsDir and metaDir hold the object data and the JSON sidecar metadata of each key,
+	// uploadsDir holds one directory of parts per in-progress multipart upload.
+	objectsDir = "objects"
+	metaDir    = "meta"
+	uploadsDir = "uploads"
+
+	// uploadInfoFile describes a multipart upload inside its directory.
+	uploadInfoFile = "upload.json"
+)
+
+// Query parameters of a signed local storage URL.
+const (
+	paramExpires       = "exp"
+	paramContentType   = "ct"
+	paramContentLength = "len"
+	paramSignature     = "sig"
+	paramUploadID      = "upload"
+	paramPartNumber    = "part"
+
+	// response header overrides of downloads, named like their S3 equivalents
+	paramResponseContentType        = "response-content-type"
+	paramResponseContentDisposition = "response-content-disposition"
+)
+
+// errInvalidKey is returned for keys that would escape the bucket directory.
+var errInvalidKey = errors.New("invalid object key")
+
+// HTTPServer is implemented by storage backends that serve their own signed URLs.
+// The router mounts such backends under RoutePrefix.
+type HTTPServer interface {
+	http.Handler
+	RoutePrefix() string
+}
+
+// localMeta is the sidecar metadata stored next to every object.
+type localMeta struct {
+	ContentType string `json:"contentType"`
+
+	// ETag is the quoted MD5 of the object, like S3 for single-part uploads.
+	ETag string `json:"etag,omitempty"`
+}
+
+// localUpload is the description of an in-progress multipart upload.
+type localUpload struct {
+	Key         string    `json:"key"`
+	ContentType string    `json:"contentType"`
+	Initiated   time.Time `json:"initiated"`
+}
+
+// localStore implements StorageService on the local filesystem. Presigned URLs point back at
+// this server and are authenticated with an HMAC signature and an expiry, like S3 presigned URLs.
+type localStore struct {
+	cfg  ServiceConfig
+	root string
+}
+
+// newLocalStore creates the bucket directories under cfg.LocalDir.
+func newLocalStore(cfg ServiceConfig) (*localStore, error) {
+	if cfg.LocalDir == "" || cfg.BucketName == "" {
+		return nil, errors.New("local storage requires a directory and a bucket name")
+	}
+
+	if len(cfg.SigningKey) == 0 {
+		return nil, errors.New("local storage requires a signing key")
+	}
+
+	root := filepath.Join(cfg.LocalDir, cfg.BucketName)
+	for _, dir := range []string{objectsDir, metaDir, uploadsDir} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+		}
+	}
+
+	return &localStore{cfg: cfg, root: root}, nil
+}
+
+// RoutePrefix returns the URL path prefix served by this bucket.
+func (s *localStore) RoutePrefix() string {
+	return LocalRoutePrefix + s.cfg.BucketName
+}
+
+// PresignUpload returns a signed PUT URL bound to the key, content type and size.
+func (s *localStore) PresignUpload(
+	ctx context.Context,
+	key string,
+	mimeType string,
+	fileSize int64,
+	duration time.Duration,
+) (string, error) {
+	if _, err := s.objectPath(key); err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set(paramContentType, mimeType)
+	query.Set(paramContentLength, strconv.FormatInt(fileSize, 10))
+
+	return s.signedURL(http.MethodPut, key, query, duration), nil
+}
+
+// PresignDownload returns a signed GET URL for the key.
+func (s *localStore) PresignDownload(ctx context.Context, key string, duration time.Duration, opts DownloadOptions) (string, error) {
+	if _, err := s.objectPath(key); err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	if opts.ContentType != "" {
+		query.Set(paramResponseContentType, opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		query.Set(paramResponseContentDisposition, opts.ContentDisposition)
+	}
+
+	return s.signedURL(http.MethodGet, key, query, duration), nil
+}
+
+// Delete removes the object and its metadata. Missing objects are not an error.
+func (s *localStore) Delete(ctx context.Context, key string) error {
+	objPath, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(objPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Local delete failed for key %s: %v", key, err)
+		return errors.New("failed to delete file from local storage")
+	}
+
+	_ = os.Remove(s.metaPath(key))
+
+	return nil
+}
+
+// GetObjectMetadata returns the stored content type and ETag and the file size.
+func (s *localStore) GetObjectMetadata(ctx context.Context, key string) (map[string]string, error) {
+	info, meta, err := s.stat(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		MetaContentType:   meta.ContentType,
+		MetaContentLength: strconv.FormatInt(info.Size(), 10),
+		MetaETag:          meta.ETag,
+	}, nil
+}
+
+// ReadRange reads up to length bytes of the object starting at offset.
+func (s *localStore) ReadRange(ctx context.Context, key string, offset int64, length int64) ([]byte, error) {
+	f, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, length))
+	if err != nil {
+		log.Printf("Failed to read local object range for key %s: %v", key, err)
+		return nil, errors.New("failed to read local object")
+	}
+
+	return data, nil
+}
+
+// Get reads the whole object, refusing objects larger than maxSize.
+func (s *localStore) Get(ctx context.Context, key string, maxSize int64) ([]byte, error) {
+	f, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		log.Printf("Failed to read local object for key %s: %v", key, err)
+		return nil, errors.New("failed to read local object")
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
+
+// Put writes the object atomically through a temporary file and records its content type.
+func (s *localStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	return s.write(key, bytes.NewReader(data), contentType)
+}
+
+// Copy writes a copy of the object and its content type under dstKey.
+func (s *localStore) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	_, meta, err := s.stat(srcKey)
+	if err != nil {
+		return err
+	}
+
+	f, err := s.open(srcKey)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return s.write(dstKey, f, meta.ContentType)
+}
+
+// List walks the bucket directory and returns every object under the prefix.
+func (s *localStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	base := filepath.Join(s.root, objectsDir)
+
+	var objects []Object
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, Object{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Local list failed for prefix %s: %v", prefix, err)
+		return nil, errors.New("failed to list files in local storage")
+	}
+
+	return objects, nil
+}
+
+// DeleteMany removes every key, continuing past failures.
+func (s *localStore) DeleteMany(ctx context.Context, keys []string) error {
+	failed := 0
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d files from local storage", failed)
+	}
+
+	return nil
+}
+
+// ServeHTTP serves signed uploads (PUT) and downloads (GET) for this bucket.
+// Downloads from a public bucket do not require a signature.
+func (s *localStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, s.RoutePrefix()+"/")
+	if _, err := s.objectPath(key); err != nil {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.serveUpload(w, r, key)
+	case http.MethodGet, http.MethodHead:
+		s.serveDownload(w, r, key)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *localStore) serveUpload(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+	contentType := query.Get(paramContentType)
+
+	length, err := strconv.ParseInt(query.Get(paramContentLength), 10, 64)
+	if err != nil || !s.verify(http.MethodPut, key, query) {
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return
+	}
+
+	if r.ContentLength != length {
+		http.Error(w, "content length does not match the signed request", http.StatusForbidden)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, length)
+
+	if uploadID := query.Get(paramUploadID); uploadID != "" {
+		partNumber, _ := strconv.Atoi(query.Get(paramPartNumber))
+
+		etag, err := s.writePart(key, uploadID, partNumber, body)
+		if errors.Is(err, ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "upload failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != contentType {
+		http.Error(w, "content type does not match the signed request", http.StatusForbidden)
+		return
+	}
+
+	if err := s.write(key, body, contentType); err != nil {
+		http.Error(w, "upload failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *localStore) serveDownload(w http.ResponseWriter, r *http.Request, key string) {
+	if !s.cfg.Public && !s.verify(http.MethodGet, key, r.URL.Query()) {
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return
+	}
+
+	info, meta, err := s.stat(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := s.open(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	if meta.ContentType != "" {
+		w.Header().Set("Content-Type", meta.ContentType)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// overrides are only honoured when covered by a signature, i.e. never on public buckets
+	if !s.cfg.Public {
+		query := r.URL.Query()
+		if contentType := query.Get(paramResponseContentType); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		if disposition := query.Get(paramResponseContentDisposition); disposition != "" {
+			w.Header().Set("Content-Disposition", disposition)
+		}
+	}
+
+	http.ServeContent(w, r, path.Base(key), info.ModTime(), f)
+}
+
+// signedURL builds an absolute URL for the key whose signature covers the method, key,
+// expiry and the signed parameters already in query (content type, length, upload part).
+func (s *localStore) signedURL(method, key string, query url.Values, duration time.Duration) string {
+	query.Set(paramExpires, strconv.FormatInt(time.Now().Add(duration).Unix(), 10))
+	query.Set(paramSignature, s.sign(method, key, query))
+
+	return s.objectURL(key) + "?" + query.Encode()
+}
+
+// objectURL returns the unsigned URL of the key.
+func (s *localStore) objectURL(key string) string {
+	escaped := make([]string, 0, strings.Count(key, "/")+1)
+	for _, segment := range strings.Split(key, "/") {
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+
+	return strings.TrimRight(s.cfg.LocalBaseURL, "/") + s.RoutePrefix() + "/" + strings.Join(escaped, "/")
+}
+
+func (s *localStore) sign(method, key string, query url.Values) string {
+	mac := hmac.New(sha256.New, s.cfg.SigningKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s",
+		method,
+		s.cfg.BucketName,
+		key,
+		query.Get(paramExpires),
+		query.Get(paramContentType),
+		query.Get(paramContentLength),
+		query.Get(paramUploadID),
+		query.Get(paramPartNumber),
+		query.Get(paramResponseContentType),
+		query.Get(paramResponseContentDisposition),
+	)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the signature and expiry of a signed request.
+func (s *localStore) verify(method, key string, query url.Values) bool {
+	expires, err := strconv.ParseInt(query.Get(paramExpires), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	expected := s.sign(method, key, query)
+	return hmac.Equal([]byte(expected), []byte(query.Get(paramSignature)))
+}
+
+func (s *localStore) write(key string, body io.Reader, contentType string) error {
+	objPath, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(objPath), 0o750); err != nil {
+		log.Printf("Failed to create local storage directory for key %s: %v", key, err)
+		return errors.New("failed to write local object")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(objPath), ".tmp-*")
+	if err != nil {
+		log.Printf("Failed to create temporary file for key %s: %v", key, err)
+		return errors.New("failed to write local object")
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		tmp.Close()
+		log.Printf("Failed to write local object for key %s: %v", key, err)
+		return errors.New("failed to write local object")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.New("failed to write local object")
+	}
+
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+	if err := s.writeMeta(key, localMeta{ContentType: contentType, ETag: etag}); err != nil {
+		log.Printf("Failed to write local metadata for key %s: %v", key, err)
+		return errors.New("failed to write local object")
+	}
+
+	if err := os.Rename(tmp.Name(), objPath); err != nil {
+		log.Printf("Failed to store local object for key %s: %v", key, err)
+		return errors.New("failed to write local object")
+	}
+
+	return nil
+}
+
+func (s *localStore) writeMeta(key string, meta localMeta) error {
+	metaPath := s.metaPath(key)
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0o750); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(metaPath, data, 0o640)
+}
+
+func (s *localStore) open(key string) (*os.File, error) {
+	objPath, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(objPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		log.Printf("Failed to open local object for key %s: %v", key, err)
+		return nil, errors.New("failed to open local object")
+	}
+
+	return f, nil
+}
+
+// stat returns the file info and sidecar metadata of the key. When the sidecar is missing,
+// the content type is guessed from the extension and the ETag derived from the modification time.
+func (s *localStore) stat(key string) (os.FileInfo, localMeta, error) {
+	objPath, err := s.objectPath(key)
+	if err != nil {
+		return nil, localMeta{}, err
+	}
+
+	info, err := os.Stat(objPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, localMeta{}, ErrNotFound
+		}
+		log.Printf("Failed to stat local object for key %s: %v", key, err)
+		return nil, localMeta{}, errors.New("failed to stat local object")
+	}
+
+	if info.IsDir() {
+		return nil, localMeta{}, ErrNotFound
+	}
+
+	var meta localMeta
+	if data, err := os.ReadFile(s.metaPath(key)); err == nil {
+		_ = json.Unmarshal(data, &meta)
+	}
+	if meta.ContentType == "" {
+		meta.ContentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if meta.ETag == "" {
+		meta.ETag = fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+	}
+
+	return info, meta, nil
+}
+
+// objectPath maps a key to its file, rejecting keys that are not clean relative paths.
+func (s *localStore) objectPath(key string) (string, error) {
+	if key == "" || strings.Contains(key, "\\") || path.IsAbs(key) || path.Clean(key) != key ||
+		key == ".." || strings.HasPrefix(key, "../") || strings.HasPrefix(path.Base(key), ".tmp-") {
+		return "", errInvalidKey
+	}
+
+	return filepath.Join(s.root, objectsDir, filepath.FromSlash(key)), nil
+}
+
+func (s *localStore) metaPath(key string) string {
+	return filepath.Join(s.root, metaDir, filepath.FromSlash(key)+".json")
+}
+
+// CreateMultipartUpload creates a directory for the parts of a new upload.
+func (s *localStore) CreateMultipartUpload(ctx context.Context, key string, mimeType string) (string, error) {
+	if _, err := s.objectPath(key); err != nil {
+		return "", err
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", errors.New("failed to create multipart upload")
+	}
+	uploadID := hex.EncodeToString(idBytes)
+
+	dir := filepath.Join(s.root, uploadsDir, uploadID)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		log.Printf("Failed to create multipart upload directory for key %s: %v", key, err)
+		return "", errors.New("failed to create multipart upload")
+	}
+
+	info, err := json.Marshal(localUpload{Key: key, ContentType: mimeType, Initiated: time.Now()})
+	if err != nil {
+		return "", errors.New("failed to create multipart upload")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, uploadInfoFile), info, 0o640); err != nil {
+		log.Printf("Failed to write multipart upload info for key %s: %v", key, err)
+		return "", errors.New("failed to create multipart upload")
+	}
+
+	return uploadID, nil
+}
+
+// PresignUploadPart returns a signed PUT URL for one part of the upload.
+func (s *localStore) PresignUploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int32,
+	partSize int64,
+	duration time.Duration,
+) (string, error) {
+	if _, err := s.upload(key, uploadID); err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set(paramContentLength, strconv.FormatInt(partSize, 10))
+	query.Set(paramUploadID, uploadID)
+	query.Set(paramPartNumber, strconv.Itoa(int(partNumber)))
+
+	return s.signedURL(http.MethodPut, key, query, duration), nil
+}
+
+// CompleteMultipartUpload concatenates the parts into the object after checking their ETags.
+func (s *localStore) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []CompletedPart) error {
+	info, err := s.upload(key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(s.root, uploadsDir, uploadID)
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, p := range parts {
+		data, err := os.ReadFile(filepath.Join(dir, partFileName(int(p.PartNumber))))
+		if err != nil || partETag(data) != p.ETag {
+			return ErrInvalidParts
+		}
+
+		readers = append(readers, bytes.NewReader(data))
+	}
+
+	if err := s.write(key, io.MultiReader(readers...), info.ContentType); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// AbortMultipartUpload removes the upload directory and its parts.
+func (s *localStore) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	if _, err := s.upload(key, uploadID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err := os.RemoveAll(filepath.Join(s.root, uploadsDir, uploadID)); err != nil {
+		log.Printf("Failed to abort multipart upload %s for key %s: %v", uploadID, key, err)
+		return errors.New("failed to abort multipart upload")
+	}
+
+	return nil
+}
+
+// ListMultipartUploads reads the description of every upload directory.
+func (s *localStore) ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, uploadsDir))
+	if err != nil {
+		log.Printf("Failed to list multipart uploads: %v", err)
+		return nil, errors.New("failed to list multipart uploads")
+	}
+
+	var uploads []MultipartUpload
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.root, uploadsDir, entry.Name(), uploadInfoFile))
+		if err != nil {
+			continue
+		}
+
+		var info localUpload
+		if json.Unmarshal(data, &info) != nil || !strings.HasPrefix(info.Key, prefix) {
+			continue
+		}
+
+		uploads = append(uploads, MultipartUpload{Key: info.Key, UploadID: entry.Name(), Initiated: info.Initiated})
+	}
+
+	return uploads, nil
+}
+
+// writePart stores one part of an upload and returns its ETag.
+func (s *localStore) writePart(key, uploadID string, partNumber int, body io.Reader) (string, error) {
+	if partNumber < 1 {
+		return "", errInvalidKey
+	}
+
+	if _, err := s.upload(key, uploadID); err != nil {
+		return "", err
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	partPath := filepath.Join(s.root, uploadsDir, uploadID, partFileName(partNumber))
+	if err := os.WriteFile(partPath, data, 0o640); err != nil {
+		log.Printf("Failed to write part %d of upload %s: %v", partNumber, uploadID, err)
+		return "", errors.New("failed to write upload part")
+	}
+
+	return partETag(data), nil
+}
+
+// upload loads the description of an upload, checking that it belongs to the key.
+func (s *localStore) upload(key, uploadID string) (localUpload, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return localUpload{}, ErrNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.root, uploadsDir, uploadID, uploadInfoFile))
+	if err != nil {
+		return localUpload{}, ErrNotFound
+	}
+
+	var info localUpload
+	if err := json.Unmarshal(data, &info); err != nil || info.Key != key {
+		return localUpload{}, ErrNotFound
+	}
+
+	return info, nil
+}
+
+func partFileName(partNumber int) string {
+	return fmt.Sprintf("part-%05d", partNumber)
+}
+
+// partETag returns the quoted MD5 of a part, like S3.
+func partETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLocalStore creates a local bucket in a temporary directory, served by a test server.
+func newTestLocalStore(t *testing.T, public bool) *localStore {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	store, err := newLocalStore(ServiceConfig{
+		Driver:       "local",
+		BucketName:   "private",
+		LocalDir:     t.TempDir(),
+		LocalBaseURL: server.URL,
+		SigningKey:   []byte("test-signing-key"),
+		Public:       public,
+	})
+	if err != nil {
+		t.Fatalf("new local store: %v", err)
+	}
+	mux.Handle(store.RoutePrefix()+"/", store)
+
+	return store
+}
+
+// do sends a request to a URL of the store and returns the response status and body.
+func do(t *testing.T, method, rawURL, contentType string, body []byte) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, rawURL, err)
+	}
+	defer res.Body.Close()
+
+	data, _ := io.ReadAll(res.Body)
+	return res, data
+}
+
+// withQuery returns rawURL with the query parameter set to value.
+func withQuery(t *testing.T, rawURL, param, value string) string {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parse url: %v", err)
+	}
+	query := u.Query()
+	query.Set(param, value)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func TestLocalObjectPathRejectsEscapes(t *testing.T) {
+	store := newTestLocalStore(t, false)
+
+	valid := []string{"ABC123/report.pdf", "ABC123/a b.txt", "avatars/u1/1700000000.webp", "ABC123/..hidden"}
+	for _, key := range valid {
+		if _, err := store.objectPath(key); err != nil {
+			t.Fatalf("valid key %q: %v", key, err)
+		}
+	}
+
+	invalid := []string{
+		"", "..", "../secret", "ABC123/../../secret", "/etc/passwd", "ABC123\\..\\secret",
+		"./ABC123/a", "ABC123//a", "ABC123/", "ABC123/.tmp-123",
+	}
+	for _, key := range invalid {
+		if _, err := store.objectPath(key); !errors.Is(err, errInvalidKey) {
+			t.Fatalf("key %q: got %v, want errInvalidKey", key, err)
+		}
+		if _, err := store.PresignUpload(context.Background(), key, "text/plain", 1, time.Minute); err == nil {
+			t.Fatalf("key %q: presigned an upload", key)
+		}
+		if err := store.Put(context.Background(), key, []byte("x"), "text/plain"); err == nil {
+			t.Fatalf("key %q: stored an object", key)
+		}
+	}
+
+	// encoded traversal in a request path
+	rec := httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, store.RoutePrefix()+"/ABC123/%2e%2e/%2e%2e/%2e%2e/etc/passwd", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("traversal request: got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLocalPresignedRoundTrip(t *testing.T) {
+	store := newTestLocalStore(t, false)
+	ctx := context.Background()
+	data := []byte("quarterly report")
+
+	uploadURL, err := store.PresignUpload(ctx, "ABC123/report.txt", "text/plain", int64(len(data)), time.Minute)
+	if err != nil {
+		t.Fatalf("presign upload: %v", err)
+	}
+	if res, body := do(t, http.MethodPut, uploadURL, "text/plain", data); res.StatusCode != http.StatusOK {
+		t.Fatalf("upload: got status %d (%s)", res.StatusCode, body)
+	}
+
+	meta, err := store.GetObjectMetadata(ctx, "ABC123/report.txt")
+	if err != nil || meta[MetaContentType] != "text/plain" || meta[MetaContentLength] != "16" {
+		t.Fatalf("metadata: got %v, %v", meta, err)
+	}
+	if want := partETag(data); meta[MetaETag] != want {
+		t.Fatalf("metadata: got ETag %q, want %q", meta[MetaETag], want)
+	}
+
+	downloadURL, err := store.PresignDownload(ctx, "ABC123/report.txt", time.Minute, DownloadOptions{
+		ContentType:        "text/plain; charset=utf-8",
+		ContentDisposition: `attachment; filename="report.txt"`,
+	})
+	if err != nil {
+		t.Fatalf("presign download: %v", err)
+	}
+
+	res, body := do(t, http.MethodGet, downloadURL, "", nil)
+	if res.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("download: got status %d, body %q", res.StatusCode, body)
+	}
+	if got := res.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Fatalf("download: Content-Type %q", got)
+	}
+	if got := res.Header.Get("Content-Disposition"); got != `attachment; filename="report.txt"` {
+		t.Fatalf("download: Content-Disposition %q", got)
+	}
+	if got := res.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Fatalf("download: X-Content-Type-Options %q", got)
+	}
+}
+
+func TestLocalRejectsTamperedAndExpiredSignatures(t *testing.T) {
+	store := newTestLocalStore(t, false)
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "ABC123/report.txt", []byte("secret"), "text/plain"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := store.Put(ctx, "XYZ789/other.txt", []byte("other"), "text/plain"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	uploadURL, _ := store.PresignUpload(ctx, "ABC123/new.txt", "text/plain", 5, time.Minute)
+	downloadURL, _ := store.PresignDownload(ctx, "ABC123/report.txt", time.Minute, DownloadOptions{})
+	expiredURL, _ := store.PresignDownload(ctx, "ABC123/report.txt", -time.Second, DownloadOptions{})
+
+	signature := func(rawURL string) string {
+		u, _ := url.Parse(rawURL)
+		return u.Query().Get(paramSignature)
+	}
+	flipped := []byte(signature(downloadURL))
+	flipped[0] ^= 1
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        []byte
+	}{
+		{name: "unsigned download", method: http.MethodGet, url: store.objectURL("ABC123/report.txt")},
+		{name: "expired download", method: http.MethodGet, url: expiredURL},
+		{name: "tampered signature", method: http.MethodGet, url: withQuery(t, downloadURL, paramSignature, string(flipped))},
+		{name: "extended expiry", method: http.MethodGet, url: withQuery(t, downloadURL, paramExpires, "9999999999")},
+		{
+			name:   "signature of another key",
+			method: http.MethodGet,
+			url:    strings.Replace(downloadURL, "ABC123/report.txt", "XYZ789/other.txt", 1),
+		},
+		{
+			name:   "added header override",
+			method: http.MethodGet,
+			url:    withQuery(t, downloadURL, paramResponseContentType, "text/html"),
+		},
+		{
+			name:        "download signature used to upload",
+			method:      http.MethodPut,
+			url:         downloadURL,
+			contentType: "text/plain",
+			body:        []byte("owned"),
+		},
+		{
+			name:        "raised upload size",
+			method:      http.MethodPut,
+			url:         withQuery(t, uploadURL, paramContentLength, "500"),
+			contentType: "text/plain",
+			body:        bytes.Repeat([]byte("x"), 500),
+		},
+		{
+			name:        "body larger than signed",
+			method:      http.MethodPut,
+			url:         uploadURL,
+			contentType: "text/plain",
+			body:        []byte("too long"),
+		},
+		{
+			name:        "other content type",
+			method:      http.MethodPut,
+			url:         uploadURL,
+			contentType: "text/html",
+			body:        []byte("<b>x"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res, body := do(t, tt.method, tt.url, tt.contentType, tt.body); res.StatusCode != http.StatusForbidden {
+				t.Fatalf("got status %d (%s), want %d", res.StatusCode, body, http.StatusForbidden)
+			}
+		})
+	}
+
+	if _, err := store.GetObjectMetadata(ctx, "ABC123/new.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("a rejected upload was stored: %v", err)
+	}
+	if data, _ := store.Get(ctx, "XYZ789/other.txt", 100); string(data) != "other" {
+		t.Fatalf("a rejected upload overwrote another object: %q", data)
+	}
+}
+
+func TestLocalPublicBucketIgnoresOverrides(t *testing.T) {
+	store := newTestLocalStore(t, true)
+
+	if err := store.Put(context.Background(), "avatars/u1/1_64", []byte("webp"), "image/webp"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	// unsigned and with a header override an attacker could add
+	rawURL := withQuery(t, store.objectURL("avatars/u1/1_64"), paramResponseContentType, "text/html")
+	res, body := do(t, http.MethodGet, rawURL, "", nil)
+	if res.StatusCode != http.StatusOK || string(body) != "webp" {
+		t.Fatalf("public download: got status %d, body %q", res.StatusCode, body)
+	}
+	if got := res.Header.Get("Content-Type"); got != "image/webp" {
+		t.Fatalf("public download: Content-Type %q, want the stored type", got)
+	}
+}
+
+func TestLocalMultipartUpload(t *testing.T) {
+	store := newTestLocalStore(t, false)
+	ctx := context.Background()
+	key := "ABC123/video.mp4"
+
+	uploadID, err := store.CreateMultipartUpload(ctx, key, "video/mp4")
+	if err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	parts := [][]byte{[]byte("first part, "), []byte("second part")}
+	completed := make([]CompletedPart, 0, len(parts))
+	for i, data := range parts {
+		partURL, err := store.PresignUploadPart(ctx, key, uploadID, int32(i+1), int64(len(data)), time.Minute)
+		if err != nil {
+			t.Fatalf("presign part %d: %v", i+1, err)
+		}
+
+		res, body := do(t, http.MethodPut, partURL, "", data)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("upload part %d: got status %d (%s)", i+1, res.StatusCode, body)
+		}
+		completed = append(completed, CompletedPart{PartNumber: int32(i + 1), ETag: res.Header.Get("ETag")})
+	}
+
+	if uploads, err := store.ListMultipartUploads(ctx, "ABC123/"); err != nil || len(uploads) != 1 || uploads[0].UploadID != uploadID {
+		t.Fatalf("list uploads: got %v, %v", uploads, err)
+	}
+
+	// upload IDs are bound to their key and never name a path
+	for _, id := range []string{"../../objects", "not-hex", ""} {
+		if _, err := store.PresignUploadPart(ctx, key, id, 1, 1, time.Minute); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("upload id %q: got %v, want ErrNotFound", id, err)
+		}
+	}
+	if _, err := store.PresignUploadPart(ctx, "XYZ789/video.mp4", uploadID, 1, 1, time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("upload of another key: got %v, want ErrNotFound", err)
+	}
+
+	wrong := []CompletedPart{completed[0], {PartNumber: 2, ETag: `"0000"`}}
+	if err := store.CompleteMultipartUpload(ctx, key, uploadID, wrong); !errors.Is(err, ErrInvalidParts) {
+		t.Fatalf("complete with a wrong etag: got %v, want ErrInvalidParts", err)
+	}
+
+	if err := store.CompleteMultipartUpload(ctx, key, uploadID, completed); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	data, err := store.Get(ctx, key, 1024)
+	if err != nil || string(data) != "first part, second part" {
+		t.Fatalf("completed object: got %q, %v", data, err)
+	}
+	if meta, _ := store.GetObjectMetadata(ctx, key); meta[MetaContentType] != "video/mp4" {
+		t.Fatalf("completed object: got metadata %v", meta)
+	}
+	if uploads, _ := store.ListMultipartUploads(ctx, ""); len(uploads) != 0 {
+		t.Fatalf("upload still listed after completion: %v", uploads)
+	}
+}
+
+func TestLocalListSkipsTemporaryFiles(t *testing.T) {
+	store := newTestLocalStore(t, false)
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "ABC123/a.txt", []byte("a"), "text/plain"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	// an upload interrupted before its rename
+	tmp := filepath.Join(store.root, objectsDir, "ABC123", ".tmp-123")
+	if err := os.WriteFile(tmp, []byte("partial"), 0o640); err != nil {
+		t.Fatalf("write temporary file: %v", err)
+	}
+
+	objects, err := store.List(ctx, "ABC123/")
+	if err != nil || len(objects) != 1 || objects[0].Key != "ABC123/a.txt" || objects[0].Size != 1 {
+		t.Fatalf("list: got %v, %v", objects, err)
+	}
+
+	if err := store.Delete(ctx, "ABC123/a.txt"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := os.Stat(store.metaPath("ABC123/a.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("metadata left behind after delete: %v", err)
+	}
+	if err := store.Delete(ctx, "ABC123/a.txt"); err != nil {
+		t.Fatalf("delete of a missing object: %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Presign operations recorded by MemoryStore.
+const (
+	PresignOpUpload     = "upload"
+	PresignOpUploadPart = "upload-part"
+	PresignOpDownload   = "download"
+)
+
+// PresignRecord describes a presigned URL issued by MemoryStore.
+type PresignRecord struct {
+	Op       string
+	Key      string
+	MimeType string
+	Size     int64
+	Duration time.Duration
+	Download DownloadOptions
+}
+
+// memoryObject is a single object held by MemoryStore.
+type memoryObject struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+}
+
+// memoryUpload is an in-progress multipart upload held by MemoryStore.
+type memoryUpload struct {
+	key         string
+	contentType string
+	initiated   time.Time
+	parts       map[int32][]byte
+}
+
+// MemoryStore is an in-memory StorageService intended for tests and local experiments.
+// It records every presign and delete so that callers can assert on them, and exposes
+// helpers to simulate client uploads.
+type MemoryStore struct {
+	bucket string
+
+	// mu protects all fields below.
+	mu       sync.Mutex
+	objects  map[string]memoryObject
+	presigns []PresignRecord
+	deletes  []string
+	uploads  map[string]*memoryUpload
+	nextID   int
+
+	// presignErr, if set, fails download presigns.
+	presignErr error
+}
+
+// NewMemoryStore creates an empty in-memory store. The bucket name only appears in presigned URLs.
+func NewMemoryStore(bucket string) *MemoryStore {
+	return &MemoryStore{
+		bucket:  bucket,
+		objects: make(map[string]memoryObject),
+		uploads: make(map[string]*memoryUpload),
+	}
+}
+
+// PresignUpload records the request and returns a memory:// URL for the key.
+func (m *MemoryStore) PresignUpload(
+	ctx context.Context,
+	key string,
+	mimeType string,
+	fileSize int64,
+	duration time.Duration,
+) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.presigns = append(m.presigns, PresignRecord{
+		Op:       PresignOpUpload,
+		Key:      key,
+		MimeType: mimeType,
+		Size:     fileSize,
+		Duration: duration,
+	})
+
+	return m.url(key, PresignOpUpload), nil
+}
+
+// PresignDownload records the request and returns a memory:// URL for the key.
+func (m *MemoryStore) PresignDownload(ctx context.Context, key string, duration time.Duration, opts DownloadOptions) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.presignErr != nil {
+		return "", m.presignErr
+	}
+
+	m.presigns = append(m.presigns, PresignRecord{
+		Op:       PresignOpDownload,
+		Key:      key,
+		Duration: duration,
+		Download: opts,
+	})
+
+	return m.url(key, PresignOpDownload), nil
+}
+
+// Delete removes the key and records the deletion.
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, key)
+	m.deletes = append(m.deletes, key)
+
+	return nil
+}
+
+// GetObjectMetadata returns the content type, size and ETag of the key.
+func (m *MemoryStore) GetObjectMetadata(ctx context.Context, key string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return map[string]string{
+		MetaContentType:   obj.contentType,
+		MetaContentLength: strconv.Itoa(len(obj.data)),
+		MetaETag:          memoryETag(obj.data),
+	}, nil
+}
+
+// ReadRange returns up to length bytes of the object starting at offset.
+func (m *MemoryStore) ReadRange(ctx context.Context, key string, offset int64, length int64) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	size := int64(len(obj.data))
+	if offset >= size {
+		return []byte{}, nil
+	}
+
+	end := min(offset+length, size)
+	return append([]byte(nil), obj.data[offset:end]...), nil
+}
+
+// Get returns a copy of the object, refusing objects larger than maxSize.
+func (m *MemoryStore) Get(ctx context.Context, key string, maxSize int64) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if int64(len(obj.data)) > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	return append([]byte(nil), obj.data...), nil
+}
+
+// Put stores a copy of data under the key.
+func (m *MemoryStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = memoryObject{
+		data:         append([]byte(nil), data...),
+		contentType:  contentType,
+		lastModified: time.Now(),
+	}
+
+	return nil
+}
+
+// Copy stores a copy of the object under dstKey.
+func (m *MemoryStore) Copy(ctx context.Context, srcKey string, dstKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[srcKey]
+	if !ok {
+		return ErrNotFound
+	}
+
+	m.objects[dstKey] = memoryObject{
+		data:         obj.data,
+		contentType:  obj.contentType,
+		lastModified: time.Now(),
+	}
+
+	return nil
+}
+
+// List returns the objects under the prefix, sorted by key.
+func (m *MemoryStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var objects []Object
+	for key, obj := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, Object{Key: key, Size: int64(len(obj.data)), LastModified: obj.lastModified})
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	return objects, nil
+}
+
+// DeleteMany removes every key and records the deletions.
+func (m *MemoryStore) DeleteMany(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		_ = m.Delete(ctx, key)
+	}
+
+	return nil
+}
+
+// CreateMultipartUpload starts an upload with a sequential upload ID.
+func (m *MemoryStore) CreateMultipartUpload(ctx context.Context, key string, mimeType string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	uploadID := "upload-" + strconv.Itoa(m.nextID)
+	m.uploads[uploadID] = &memoryUpload{
+		key:         key,
+		contentType: mimeType,
+		initiated:   time.Now(),
+		parts:       make(map[int32][]byte),
+	}
+
+	return uploadID, nil
+}
+
+// PresignUploadPart records the request and returns a memory:// URL for the part.
+func (m *MemoryStore) PresignUploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int32,
+	partSize int64,
+	duration time.Duration,
+) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if upload, ok := m.uploads[uploadID]; !ok || upload.key != key {
+		return "", ErrNotFound
+	}
+
+	m.presigns = append(m.presigns, PresignRecord{
+		Op:       PresignOpUploadPart,
+		Key:      key,
+		Size:     partSize,
+		Duration: duration,
+	})
+
+	return m.url(key, PresignOpUploadPart) + "&part=" + strconv.Itoa(int(partNumber)), nil
+}
+
+// CompleteMultipartUpload concatenates the parts into the object after checking their ETags.
+func (m *MemoryStore) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []CompletedPart) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[uploadID]
+	if !ok || upload.key != key {
+		return ErrNotFound
+	}
+
+	var data []byte
+	for _, p := range parts {
+		part, ok := upload.parts[p.PartNumber]
+		if !ok || memoryETag(part) != p.ETag {
+			return ErrInvalidParts
+		}
+		data = append(data, part...)
+	}
+
+	m.objects[key] = memoryObject{data: data, contentType: upload.contentType, lastModified: time.Now()}
+	delete(m.uploads, uploadID)
+
+	return nil
+}
+
+// AbortMultipartUpload discards the upload and its parts.
+func (m *MemoryStore) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if upload, ok := m.uploads[uploadID]; ok && upload.key == key {
+		delete(m.uploads, uploadID)
+	}
+
+	return nil
+}
+
+// ListMultipartUploads returns the in-progress uploads under the prefix, sorted by key.
+func (m *MemoryStore) ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var uploads []MultipartUpload
+	for id, upload := range m.uploads {
+		if strings.HasPrefix(upload.key, prefix) {
+			uploads = append(uploads, MultipartUpload{Key: upload.key, UploadID: id, Initiated: upload.initiated})
+		}
+	}
+
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].Key < uploads[j].Key })
+
+	return uploads, nil
+}
+
+// UploadPart simulates a client uploading one part through a presigned URL and returns its ETag.
+func (m *MemoryStore) UploadPart(key, uploadID string, partNumber int32, data []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[uploadID]
+	if !ok || upload.key != key {
+		return "", ErrNotFound
+	}
+
+	upload.parts[partNumber] = append([]byte(nil), data...)
+
+	return memoryETag(data), nil
+}
+
+// Presigns returns a copy of the presigned URLs issued so far.
+func (m *MemoryStore) Presigns() []PresignRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]PresignRecord(nil), m.presigns...)
+}
+
+// Deletes returns the keys deleted so far, in order.
+func (m *MemoryStore) Deletes() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.deletes...)
+}
+
+// FailPresigns makes download presigns fail with err until it is called again with nil,
+// e.g. to simulate a storage outage.
+func (m *MemoryStore) FailPresigns(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.presignErr = err
+}
+
+// Has reports whether the key currently exists.
+func (m *MemoryStore) Has(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.objects[key]
+	return ok
+}
+
+// Touch sets the last modification time of the key and the initiation time of its multipart
+// uploads, e.g. to age objects in garbage collection tests.
+func (m *MemoryStore) Touch(key string, lastModified time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if obj, ok := m.objects[key]; ok {
+		obj.lastModified = lastModified
+		m.objects[key] = obj
+	}
+
+	for _, upload := range m.uploads {
+		if upload.key == key {
+			upload.initiated = lastModified
+		}
+	}
+}
+
+func memoryETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (m *MemoryStore) url(key, op string) string {
+	return "memory://" + m.bucket + "/" + key + "?op=" + url.QueryEscape(op)
+}
@@ -2,15 +2,53 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 )
 
+// ErrNotFound is returned when the requested object does not exist in the bucket.
+var ErrNotFound = errors.New("file not found")
+
+// Metadata keys returned by GetObjectMetadata.
+const (
+	MetaContentType   = "Content-Type"
+	MetaContentLength = "Content-Length"
+
+	// MetaETag identifies the stored version of the object; it changes whenever the object is rewritten.
+	MetaETag = "ETag"
+)
+
+// Object describes a stored object as returned by List.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Storage drivers selectable through ServiceConfig.Driver.
+const (
+	DriverS3    = "s3"
+	DriverLocal = "local"
+)
+
 // ServiceConfig holds the configuration required to connect to the storage service.
 type ServiceConfig struct {
-	BucketName      string
+	Driver     string
+	BucketName string
+
+	// S3 driver settings
 	Endpoint        string
 	AccessKeyID     string
 	SecretAccessKey string
+
+	// Local driver settings: files are stored under LocalDir/BucketName and served by this
+	// server at LocalBaseURL + LocalRoutePrefix + BucketName, with URLs signed by SigningKey.
+	// Public buckets serve downloads without a signature.
+	LocalDir     string
+	LocalBaseURL string
+	SigningKey   []byte
+	Public       bool
 }
 
 // StorageService defines the public interface for the file storage service.
@@ -24,18 +62,100 @@ type StorageService interface {
 		duration time.Duration,
 	) (string, error)
 
-	// PresignDownload generates a pre-signed URL for downloading a file.
-	PresignDownload(ctx context.Context, key string, duration time.Duration) (string, error)
+	// PresignDownload generates a pre-signed URL for downloading a file,
+	// with the response headers overridden as requested by opts.
+	PresignDownload(ctx context.Context, key string, duration time.Duration, opts DownloadOptions) (string, error)
 
 	// Delete removes the file specified by the given key.
 	Delete(ctx context.Context, key string) error
 
 	// GetObjectMetadata retrieves the object's metadata.
+	// It returns ErrNotFound if the object does not exist.
 	GetObjectMetadata(ctx context.Context, key string) (map[string]string, error)
+
+	// ReadRange reads up to length bytes of the object starting at offset.
+	// It returns ErrNotFound if the object does not exist.
+	ReadRange(ctx context.Context, key string, offset int64, length int64) ([]byte, error)
+
+	// Get reads the whole object, refusing objects larger than maxSize.
+	// It returns ErrNotFound if the object does not exist.
+	Get(ctx context.Context, key string, maxSize int64) ([]byte, error)
+
+	// Put writes data to the given key, replacing any existing object.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+
+	// Copy duplicates the object under srcKey, with its content type, to dstKey without
+	// transferring it through the server. It returns ErrNotFound if srcKey does not exist.
+	Copy(ctx context.Context, srcKey string, dstKey string) error
+
+	// List returns all objects whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Object, error)
+
+	// DeleteMany removes the given keys, batching requests where the backend supports it.
+	// Keys that do not exist are ignored.
+	DeleteMany(ctx context.Context, keys []string) error
+
+	// CreateMultipartUpload starts a multipart upload for the key and returns its upload ID.
+	CreateMultipartUpload(ctx context.Context, key string, mimeType string) (string, error)
+
+	// PresignUploadPart generates a pre-signed URL for uploading one part of exactly partSize bytes.
+	// Part numbers start at 1.
+	PresignUploadPart(
+		ctx context.Context,
+		key string,
+		uploadID string,
+		partNumber int32,
+		partSize int64,
+		duration time.Duration,
+	) (string, error)
+
+	// CompleteMultipartUpload assembles the uploaded parts, in part number order, into the object.
+	// It returns ErrNotFound if the upload does not exist and ErrInvalidParts if a part
+	// has not been uploaded or does not match its ETag.
+	CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []CompletedPart) error
+
+	// AbortMultipartUpload discards the upload and any parts uploaded so far.
+	AbortMultipartUpload(ctx context.Context, key string, uploadID string) error
+
+	// ListMultipartUploads returns the in-progress multipart uploads whose key starts with prefix.
+	ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error)
 }
 
+// DownloadOptions overrides the response headers of a presigned download.
+// Empty fields keep the stored values.
+type DownloadOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// CompletedPart identifies an uploaded part by its number and the ETag returned by the upload.
+type CompletedPart struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+// MultipartUpload describes an in-progress multipart upload.
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// ErrTooLarge is returned by Get when the object exceeds the requested maximum size.
+var ErrTooLarge = errors.New("object too large")
+
+// ErrInvalidParts is returned by CompleteMultipartUpload when the listed parts do not match the uploaded ones.
+var ErrInvalidParts = errors.New("multipart upload parts are missing or invalid")
+
 // NewStorageService is the factory function for StorageService.
 // It initializes and returns a concrete implementation based on the provided configuration.
 func NewStorageService(cfg ServiceConfig) (StorageService, error) {
-	return newS3Client(cfg)
+	switch cfg.Driver {
+	case "", DriverS3:
+		return newS3Client(cfg)
+	case DriverLocal:
+		return newLocalStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
 }
@@ -0,0 +1,138 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"hzchat/internal/app/storage"
+	"hzchat/internal/pkg/imagex"
+)
+
+const (
+	// AvatarPrefix is the key prefix under which user avatars are stored in the public bucket.
+	AvatarPrefix = "avatars/"
+
+	// MaxAvatarUploadSize is the maximum size of an uploaded avatar (1 MB).
+	MaxAvatarUploadSize = 1 * 1024 * 1024
+
+	// DefaultAvatarSize is the size of the variant referenced by user profiles.
+	DefaultAvatarSize = 256
+)
+
+// AvatarSizes are the standard square sizes every avatar is resized to.
+var AvatarSizes = []int{64, 128, DefaultAvatarSize}
+
+// ErrInvalidAvatar is returned by ProcessAvatar when the uploaded object is missing,
+// too large, or not a WebP image.
+var ErrInvalidAvatar = errors.New("invalid avatar")
+
+// avatarKeyPattern matches the uploaded avatars (avatars/<userID>/<unix>.webp) and their
+// resized variants (avatars/<userID>/<unix>_<size>), capturing the user ID, the upload's
+// base name and the variant size.
+var avatarKeyPattern = regexp.MustCompile(`^avatars/([^/]+)/(\d+)(?:\.webp|_(\d+))$`)
+
+// AvatarUploadKey returns the key under which the user uploads a new avatar.
+func AvatarUploadKey(userID string, now time.Time) string {
+	return fmt.Sprintf("%s%s/%d.webp", AvatarPrefix, userID, now.Unix())
+}
+
+// IsAvatarUploadOf reports whether key is an avatar uploaded by the user, as opposed to a
+// resized variant or an object owned by another user.
+func IsAvatarUploadOf(key string, userID string) bool {
+	m := avatarKeyPattern.FindStringSubmatch(key)
+	return m != nil && m[1] == userID && m[3] == "" && strings.HasSuffix(key, ".webp")
+}
+
+// AvatarVariantKey returns the key of the resized variant of an uploaded avatar.
+func AvatarVariantKey(uploadKey string, size int) string {
+	return fmt.Sprintf("%s_%d", strings.TrimSuffix(uploadKey, ".webp"), size)
+}
+
+// AvatarKeys returns every stored key of the avatar a profile references: all resized
+// variants for a variant key, or the key alone for avatars stored before resizing.
+func AvatarKeys(key string) []string {
+	variants := AvatarVariants(key)
+	if variants == nil {
+		return []string{key}
+	}
+
+	keys := make([]string, 0, len(variants))
+	for _, size := range AvatarSizes {
+		keys = append(keys, variants[size])
+	}
+	return keys
+}
+
+// AvatarVariants maps each standard size to the key of its variant, given the key of any
+// variant. It returns nil for other keys, e.g. avatars stored before resizing.
+func AvatarVariants(key string) map[int]string {
+	m := avatarKeyPattern.FindStringSubmatch(key)
+	if m == nil || m[3] == "" {
+		return nil
+	}
+
+	variants := make(map[int]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		variants[size] = fmt.Sprintf("%s%s/%s_%d", AvatarPrefix, m[1], m[2], size)
+	}
+	return variants
+}
+
+// ProcessAvatar confirms that the uploaded avatar exists and is a WebP image within the size
+// limit, stores its variants at the standard sizes, and removes the upload. It returns the
+// key of the DefaultAvatarSize variant, or ErrInvalidAvatar if the upload is rejected.
+func ProcessAvatar(ctx context.Context, store storage.StorageService, uploadKey string) (string, error) {
+	meta, err := store.GetObjectMetadata(ctx, uploadKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", ErrInvalidAvatar
+		}
+		return "", err
+	}
+
+	if size, err := strconv.ParseInt(meta[storage.MetaContentLength], 10, 64); err != nil || size > MaxAvatarUploadSize {
+		return "", ErrInvalidAvatar
+	}
+
+	data, err := store.Get(ctx, uploadKey, MaxAvatarUploadSize)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrTooLarge) {
+			return "", ErrInvalidAvatar
+		}
+		return "", err
+	}
+
+	// the declared content type is client-supplied; only the decoder is trusted
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "webp" || cfg.Width*cfg.Height > imagex.MaxPixels {
+		return "", ErrInvalidAvatar
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrInvalidAvatar
+	}
+
+	for _, size := range AvatarSizes {
+		variant, err := imagex.Square(img, size)
+		if err != nil {
+			return "", err
+		}
+
+		if err := store.Put(ctx, AvatarVariantKey(uploadKey, size), variant.Data, variant.ContentType); err != nil {
+			return "", err
+		}
+	}
+
+	// the variants replace the upload; a failed deletion is left to the garbage collector
+	_ = store.Delete(ctx, uploadKey)
+
+	return AvatarVariantKey(uploadKey, DefaultAvatarSize), nil
+}
@@ -16,9 +16,12 @@ type User struct {
 	// Nickname is the display name of the user in the chat room.
 	Nickname string `json:"nickname"`
 
-	// Avatar is the URL for the user's avatar (currently unimplemented but reserved).
+	// Avatar is the URL for the user's avatar: their custom image, or a generated default.
 	Avatar string `json:"avatar"`
 
 	// UserType defines the role/status of the participant (e.g., "guest", "registered").
 	UserType string `json:"userType"`
+
+	// PlanType is the service plan of the participant, used for upload limits. It is not sent to clients.
+	PlanType string `json:"-"`
 }
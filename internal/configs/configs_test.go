@@ -0,0 +1,63 @@
+package configs
+
+import "testing"
+
+func TestParseFloodPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{name: "defaults", raw: ""},
+		{name: "override", raw: `{"group":{"messageRate":1,"muteSeconds":120}}`},
+		{name: "byte burst of the maximum message size", raw: `{"group":{"byteBurst":8192}}`},
+		{name: "byte burst below the maximum message size", raw: `{"group":{"byteBurst":8191}}`, wantErr: true},
+		{name: "non-positive rate", raw: `{"private":{"messageRate":0}}`, wantErr: true},
+		{name: "invalid escalation", raw: `{"private":{"muteAfter":0}}`, wantErr: true},
+		{name: "invalid json", raw: `{"group":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := parseFloodPolicies(tt.raw, DefaultFloodPolicies)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got policies %+v, want an error", policies)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			for roomType, p := range policies {
+				if p.ByteBurst < MaxInboundMessageBytes {
+					t.Fatalf("room type %q: byte burst %d is below the maximum message size", roomType, p.ByteBurst)
+				}
+			}
+		})
+	}
+}
+
+func TestGCEnabled(t *testing.T) {
+	tests := []struct {
+		name      string
+		interval  int
+		store     string
+		exclusive bool
+		want      bool
+	}{
+		{name: "single instance", interval: 60, store: "memory", want: true},
+		{name: "disabled", interval: 0, store: "memory", want: false},
+		{name: "shared redis store", interval: 60, store: "redis", want: false},
+		{name: "shared redis store with exclusive storage", interval: 60, store: "redis", exclusive: true, want: true},
+		{name: "disabled with exclusive storage", interval: 0, store: "redis", exclusive: true, want: false},
+	}
+
+	for _, tt := range tests {
+		cfg := &AppConfig{GCIntervalMinutes: tt.interval, RateLimitStore: tt.store, GCExclusiveStorage: tt.exclusive}
+		if got := cfg.GCEnabled(); got != tt.want {
+			t.Fatalf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
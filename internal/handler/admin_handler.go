@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/logx"
+	"hzchat/internal/pkg/resp"
+)
+
+// requireAdmin is an HTTP middleware that only lets requests carrying the admin token through.
+func requireAdmin(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+				logx.Warn("Admin request rejected: invalid token.", "path", r.URL.Path)
+				resp.RespondError(w, r, errs.NewError(errs.ErrUnauthorized))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HandleGCReport returns the report of the last storage garbage collection run.
+// The report is null while the collector is disabled or has not completed a run yet.
+func HandleGCReport(deps *AppDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]any{
+			"enabled": deps.GC != nil,
+			"report":  nil,
+		}
+
+		if deps.GC != nil {
+			if report := deps.GC.LastReport(); report != nil {
+				data["report"] = report
+			}
+		}
+
+		resp.RespondSuccess(w, r, data)
+	}
+}
@@ -0,0 +1,66 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"hzchat/internal/app/gc"
+	"hzchat/internal/configs"
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/testkit"
+)
+
+const adminToken = "admin-secret"
+
+func TestGCReportRequiresTheAdminToken(t *testing.T) {
+	h := testkit.New(t, func(cfg *configs.AppConfig) {
+		cfg.AdminToken = adminToken
+		cfg.GCDryRun = true
+	})
+
+	for _, token := range []string{"", "wrong-secret", h.Register("sam_0001", "secret123").Token} {
+		if res := h.Do(http.MethodGet, "/api/admin/gc/report", token, nil); res.Code != errs.ErrUnauthorized {
+			t.Fatalf("token %q: got code %d, want %d", token, res.Code, errs.ErrUnauthorized)
+		}
+	}
+
+	var before struct {
+		Enabled bool       `json:"enabled"`
+		Report  *gc.Report `json:"report"`
+	}
+	h.MustOK(http.MethodGet, "/api/admin/gc/report", adminToken, nil).Decode(t, &before)
+	if !before.Enabled || before.Report != nil {
+		t.Fatalf("before the first run: got %+v", before)
+	}
+
+	// an attachment left behind by a room that no longer exists
+	if err := h.PrivateStorage.Put(context.Background(), "GONE01/report.pdf", []byte("%PDF-1.7"), "application/pdf"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	h.PrivateStorage.Touch("GONE01/report.pdf", time.Now().Add(-time.Hour))
+	h.GC.RunOnce(context.Background())
+
+	var after struct {
+		Report *gc.Report `json:"report"`
+	}
+	h.MustOK(http.MethodGet, "/api/admin/gc/report", adminToken, nil).Decode(t, &after)
+	if after.Report == nil || !after.Report.DryRun || len(after.Report.Removed) != 1 {
+		t.Fatalf("after a dry run: got %+v", after.Report)
+	}
+	if removed := after.Report.Removed[0]; removed.Key != "GONE01/report.pdf" || removed.Reason != gc.ReasonInactiveRoom {
+		t.Fatalf("got removed object %+v", removed)
+	}
+	if !h.PrivateStorage.Has("GONE01/report.pdf") {
+		t.Fatalf("dry run deleted the orphan")
+	}
+}
+
+func TestAdminEndpointsAreDisabledWithoutToken(t *testing.T) {
+	h := testkit.New(t)
+
+	if res := h.Do(http.MethodGet, "/api/admin/gc/report", "", nil); res.Status != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d", res.Status, http.StatusNotFound)
+	}
+}
@@ -93,13 +93,16 @@ func HandleRegister(deps *AppDeps) http.HandlerFunc {
 			logx.Error(err, "register: failed to update last_login_at", "user_id", user.ID)
 		}
 
+		avatarURL := deps.UserAvatarURL(user.ID.String(), "")
+
 		payload := &jwt.Payload{
 			ID:       user.ID.String(),
 			UserType: "registered",
 			Nickname: user.Nickname.String,
+			Avatar:   avatarURL,
 		}
 
-		tokenString, err := jwt.GenerateToken(payload, deps.Config.JWTSecret, jwt.UserIdentityExpiration)
+		tokenString, err := jwt.GenerateToken(payload, deps.Config.JWTSecret, jwt.AudienceIdentity)
 		if err != nil {
 			logx.Error(err, "failed to generate token after registration")
 			resp.RespondError(w, r, errs.NewError(errs.ErrUnknown))
@@ -111,7 +114,7 @@ func HandleRegister(deps *AppDeps) http.HandlerFunc {
 			"user": map[string]any{
 				"id":          user.ID.String(),
 				"nickname":    user.Nickname.String,
-				"avatar":      "",
+				"avatar":      avatarURL,
 				"userType":    "registered",
 				"planType":    "FREE",
 				"lastLoginAt": time.Now().Format(time.RFC3339),
@@ -156,7 +159,7 @@ func HandleLogin(deps *AppDeps) http.HandlerFunc {
 			logx.Error(err, "login: failed to update last_login_at", "user_id", dbUser.ID)
 		}
 
-		avatarURL := deps.FullAssetURL(dbUser.AvatarUrl.String)
+		avatarURL := deps.UserAvatarURL(dbUser.ID.String(), dbUser.AvatarUrl.String)
 
 		payload := &jwt.Payload{
 			ID:       dbUser.ID.String(),
@@ -165,7 +168,7 @@ func HandleLogin(deps *AppDeps) http.HandlerFunc {
 			Avatar:   avatarURL,
 		}
 
-		token, err := jwt.GenerateToken(payload, deps.Config.JWTSecret, jwt.UserIdentityExpiration)
+		token, err := jwt.GenerateToken(payload, deps.Config.JWTSecret, jwt.AudienceIdentity)
 
 		if err != nil {
 			logx.Error(err, "login: jwt generation failed")
@@ -179,6 +182,7 @@ func HandleLogin(deps *AppDeps) http.HandlerFunc {
 				"id":          dbUser.ID.String(),
 				"nickname":    dbUser.Nickname.String,
 				"avatar":      avatarURL,
+				"avatarSizes": deps.AvatarURLs(dbUser.AvatarUrl.String),
 				"userType":    "registered",
 				"planType":    dbUser.PlanType,
 				"lastLoginAt": time.Now().Format(time.RFC3339),
@@ -229,7 +233,8 @@ func HandleGetUserProfile(deps *AppDeps) http.HandlerFunc {
 			"user": map[string]any{
 				"id":          dbUser.ID.String(),
 				"nickname":    dbUser.Nickname.String,
-				"avatar":      deps.FullAssetURL(dbUser.AvatarUrl.String),
+				"avatar":      deps.UserAvatarURL(dbUser.ID.String(), dbUser.AvatarUrl.String),
+				"avatarSizes": deps.AvatarURLs(dbUser.AvatarUrl.String),
 				"userType":    "registered",
 				"planType":    dbUser.PlanType,
 				"lastLoginAt": lastLoginResponse,
@@ -293,7 +298,7 @@ func HandleChangePassword(deps *AppDeps) http.HandlerFunc {
 			return
 		}
 
-		newToken, err := jwt.GenerateToken(identity, deps.Config.JWTSecret, jwt.UserIdentityExpiration)
+		newToken, err := jwt.GenerateToken(identity, deps.Config.JWTSecret, jwt.AudienceIdentity)
 		if err != nil {
 			logx.Error(err, "failed to generate token after password change", "user_id", identity.ID)
 			resp.RespondError(w, r, errs.NewError(errs.ErrUnknown))
@@ -4,9 +4,19 @@ import (
 	"fmt"
 	"hzchat/internal/app/chat"
 	db "hzchat/internal/app/db/sqlc"
+	"hzchat/internal/app/gc"
 	"hzchat/internal/app/storage"
+	"hzchat/internal/app/user"
 	"hzchat/internal/configs"
+	"hzchat/internal/pkg/cdnsign"
+	"hzchat/internal/pkg/limiter"
+	"hzchat/internal/pkg/logx"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
 )
 
 type AppDeps struct {
@@ -14,7 +24,50 @@ type AppDeps struct {
 	Config         *configs.AppConfig
 	PublicStorage  storage.StorageService
 	PrivateStorage storage.StorageService
-	DB             *db.Queries
+	DB             db.Querier
+	RateLimiter    *limiter.Limiter
+
+	// AssetSigner signs the URLs of public assets; nil serves plain URLs.
+	AssetSigner *cdnsign.Signer
+
+	// GC is the storage garbage collector; nil when it is disabled.
+	GC *gc.Collector
+}
+
+// RateLimitPolicies converts the configured rate limit policies into limiter policies.
+func RateLimitPolicies(cfgPolicies []configs.RateLimitPolicy) []limiter.Policy {
+	policies := make([]limiter.Policy, 0, len(cfgPolicies))
+
+	for _, p := range cfgPolicies {
+		keys := make([]limiter.KeyPart, 0, len(p.Keys))
+		for _, k := range p.Keys {
+			keys = append(keys, limiter.KeyPart(k))
+		}
+
+		policies = append(policies, limiter.Policy{
+			Name:  p.Name,
+			Rate:  rate.Limit(p.Rate),
+			Burst: p.Burst,
+			Keys:  keys,
+		})
+	}
+
+	return policies
+}
+
+// AssetSignerConfig converts the signed CDN URL settings of the application configuration.
+func AssetSignerConfig(cfg *configs.AppConfig) cdnsign.Config {
+	keys := make([]cdnsign.Key, 0, len(cfg.CDNSigningKeys))
+	for _, k := range cfg.CDNSigningKeys {
+		keys = append(keys, cdnsign.Key{ID: k.ID, Secret: k.Secret})
+	}
+
+	return cdnsign.Config{
+		Mode:  cfg.CDNSigning,
+		Keys:  keys,
+		KeyID: cfg.CDNSigningKeyID,
+		TTL:   time.Duration(cfg.CDNSignedURLMinutes) * time.Minute,
+	}
 }
 
 func (deps *AppDeps) FullAssetURL(key string) string {
@@ -26,10 +79,41 @@ func (deps *AppDeps) FullAssetURL(key string) string {
 		return key
 	}
 
-	base := strings.TrimRight(deps.Config.S3PublicBaseURL, "/")
+	base := strings.TrimRight(deps.Config.PublicAssetBaseURL, "/")
 	path := strings.TrimLeft(key, "/")
 
-	return base + "/" + path
+	signed, err := deps.AssetSigner.Sign(base + "/" + path)
+	if err != nil {
+		logx.Error(err, "Failed to sign asset URL", "key", key)
+		return ""
+	}
+
+	return signed
+}
+
+// UserAvatarURL returns the URL of the user's custom avatar stored under key, or of the
+// generated default avatar when the user has none.
+func (deps *AppDeps) UserAvatarURL(userID string, key string) string {
+	if key != "" {
+		return deps.FullAssetURL(key)
+	}
+
+	return deps.Config.APIBaseURL + "/api/avatar/default/" + url.PathEscape(userID)
+}
+
+// AvatarURLs maps each standard avatar size to the URL of its variant, or returns nil for
+// avatars stored before resizing, which are only available at their AvatarUrl.
+func (deps *AppDeps) AvatarURLs(key string) map[string]string {
+	variants := user.AvatarVariants(key)
+	if variants == nil {
+		return nil
+	}
+
+	urls := make(map[string]string, len(variants))
+	for size, variantKey := range variants {
+		urls[strconv.Itoa(size)] = deps.FullAssetURL(variantKey)
+	}
+	return urls
 }
 
 func (deps *AppDeps) NormalizeAssetKey(input string) (string, error) {
@@ -38,10 +122,12 @@ func (deps *AppDeps) NormalizeAssetKey(input string) (string, error) {
 	}
 
 	if strings.HasPrefix(input, "http") {
-		baseURL := strings.TrimRight(deps.Config.S3PublicBaseURL, "/") + "/"
+		baseURL := strings.TrimRight(deps.Config.PublicAssetBaseURL, "/") + "/"
 
 		if strings.HasPrefix(input, baseURL) {
-			return strings.TrimPrefix(input, baseURL), nil
+			// signed URLs carry their signature in the query
+			key, _, _ := strings.Cut(strings.TrimPrefix(input, baseURL), "?")
+			return key, nil
 		}
 
 		return "", fmt.Errorf("invalid asset url: domain mismatch or unauthorized source")
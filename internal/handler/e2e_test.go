@@ -0,0 +1,1140 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"hzchat/internal/app/chat"
+	"hzchat/internal/app/storage"
+	"hzchat/internal/configs"
+	"hzchat/internal/handler"
+	"hzchat/internal/pkg/auth/jwt"
+	"hzchat/internal/pkg/cdnsign"
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/testkit"
+)
+
+func TestRegisterRejectsDuplicateUsername(t *testing.T) {
+	h := testkit.New(t)
+
+	h.Register("alice_01", "secret123")
+
+	res := h.Do(http.MethodPost, "/api/auth/register", "", map[string]string{
+		"username": "alice_01",
+		"password": "secret123",
+	})
+	if res.Code != errs.ErrUserAlreadyExists {
+		t.Fatalf("duplicate registration: got code %d, want %d", res.Code, errs.ErrUserAlreadyExists)
+	}
+}
+
+func TestTextMessageIsBroadcastAndConfirmed(t *testing.T) {
+	h := testkit.New(t)
+
+	alice := h.Register("alice_01", "secret123")
+	code := h.CreateRoom(chat.RoomTypeGroup)
+
+	aliceWS := h.Connect(code, h.JoinAsUser(code, alice))
+	aliceWS.Expect(chat.TypeInitData)
+
+	guestWS := h.Connect(code, h.JoinAsGuest(code, "Bob"))
+
+	var init chat.InitDataPayload
+	testkit.DecodePayload(t, guestWS.Expect(chat.TypeInitData), &init)
+	if init.HostID != alice.ID {
+		t.Fatalf("host: got %q, want first participant %q", init.HostID, alice.ID)
+	}
+	aliceWS.Expect(chat.TypeUserJoined)
+
+	aliceWS.Send(chat.TypeText, chat.TextPayload{Content: "hello"}, "tmp-1")
+
+	var ack struct {
+		TempID string `json:"tempId"`
+	}
+	testkit.DecodePayload(t, aliceWS.Expect(chat.TypeConfirm), &ack)
+	if ack.TempID != "tmp-1" {
+		t.Fatalf("ack tempId: got %q", ack.TempID)
+	}
+
+	var text chat.TextPayload
+	msg := guestWS.Expect(chat.TypeText)
+	testkit.DecodePayload(t, msg, &text)
+	if text.Content != "hello" || msg.Sender.ID != alice.ID {
+		t.Fatalf("broadcast: got %q from %q", text.Content, msg.Sender.ID)
+	}
+}
+
+func TestImageAttachmentIsProcessedAndDownloadable(t *testing.T) {
+	h := testkit.New(t)
+
+	code := h.CreateRoom(chat.RoomTypePrivate)
+	token := h.JoinAsGuest(code, "Carol")
+	sender := h.Connect(code, token)
+	sender.Expect(chat.TypeInitData)
+
+	receiver := h.Connect(code, h.JoinAsGuest(code, "Dave"))
+	receiver.Expect(chat.TypeInitData)
+
+	attachment := h.Upload(token, "photo.png", "image/png", testPNG(t, 640, 480))
+
+	sender.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{attachment},
+	}, "tmp-attach")
+	sender.Expect(chat.TypeConfirm)
+
+	var payload chat.AttachmentsPayload
+	testkit.DecodePayload(t, receiver.Expect(chat.TypeAttachments), &payload)
+
+	var meta chat.ImageMeta
+	if err := json.Unmarshal(payload.Attachments[0].Meta, &meta); err != nil {
+		t.Fatalf("decode meta: %v", err)
+	}
+	if meta.Width != 640 || meta.Height != 480 {
+		t.Fatalf("meta dimensions: got %dx%d", meta.Width, meta.Height)
+	}
+	if !h.PrivateStorage.Has(meta.ThumbnailKey) {
+		t.Fatalf("thumbnail %q was not stored", meta.ThumbnailKey)
+	}
+
+	res := h.Do(http.MethodGet, "/api/file/presign-download?k="+url.QueryEscape(attachment.Key), token, nil)
+	if res.Status != http.StatusFound {
+		t.Fatalf("presign download: got status %d (code %d)", res.Status, res.Code)
+	}
+
+	presigns := h.PrivateStorage.Presigns()
+	last := presigns[len(presigns)-1]
+	if last.Op != storage.PresignOpDownload || last.Key != attachment.Key {
+		t.Fatalf("last presign: got %+v", last)
+	}
+}
+
+func TestSpoofedAttachmentIsQuarantined(t *testing.T) {
+	h := testkit.New(t)
+
+	code := h.CreateRoom(chat.RoomTypePrivate)
+	token := h.JoinAsGuest(code, "Mallory")
+	ws := h.Connect(code, token)
+	ws.Expect(chat.TypeInitData)
+
+	html := []byte("<!DOCTYPE html><html><script>alert(1)</script></html>")
+	attachment := h.Upload(token, "cat.png", "image/png", html)
+
+	ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{attachment},
+	}, "tmp-spoof")
+
+	if got := ws.ExpectError(); got.Code != errs.ErrAttachmentContentInvalid {
+		t.Fatalf("error code: got %d, want %d", got.Code, errs.ErrAttachmentContentInvalid)
+	}
+
+	deadline := time.Now().Add(testkit.DefaultTimeout)
+	for h.PrivateStorage.Has(attachment.Key) {
+		if time.Now().After(deadline) {
+			t.Fatalf("quarantined object %q was not deleted", attachment.Key)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForContent waits until the user's attachment with the given content hash is indexed,
+// which happens in the background once it is sent.
+func waitForContent(t *testing.T, h *testkit.Harness, userID, hash, mimeType string) {
+	t.Helper()
+
+	deadline := time.Now().Add(testkit.DefaultTimeout)
+	for {
+		if _, ok := h.Manager.Contents().Lookup(userID, hash, mimeType); ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("content %s was not indexed", hash)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestMismatchedAttachmentsAreRejectedAndTheConnectionKept(t *testing.T) {
+	h := testkit.New(t)
+
+	code := h.CreateRoom(chat.RoomTypePrivate)
+	token := h.JoinAsGuest(code, "Erin")
+	ws := h.Connect(code, token)
+	ws.Expect(chat.TypeInitData)
+
+	attachment := h.Upload(token, "report.pdf", "application/pdf", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n"))
+
+	missing := attachment
+	missing.Key = code + "/never-uploaded.pdf"
+
+	wrongSize := attachment
+	wrongSize.Size++
+
+	wrongType := attachment
+	wrongType.Name = "report.png"
+	wrongType.MimeType = "image/png"
+
+	tests := []struct {
+		name       string
+		attachment chat.Attachment
+		wantCode   int
+	}{
+		{name: "missing key", attachment: missing, wantCode: errs.ErrAttachmentNotFound},
+		{name: "wrong size", attachment: wrongSize, wantCode: errs.ErrAttachmentMismatch},
+		{name: "wrong type", attachment: wrongType, wantCode: errs.ErrAttachmentMismatch},
+	}
+
+	for _, tt := range tests {
+		ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+			Attachments: []chat.Attachment{tt.attachment},
+		}, "tmp-"+tt.name)
+
+		if got := ws.ExpectError(); got.Code != tt.wantCode {
+			t.Fatalf("%s: got code %d, want %d", tt.name, got.Code, tt.wantCode)
+		}
+	}
+
+	// the rejections leave the connection open for the corrected message
+	ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{attachment},
+	}, "tmp-valid")
+	ws.Expect(chat.TypeConfirm)
+}
+
+func TestAttachmentRewrittenAfterVerificationIsQuarantined(t *testing.T) {
+	h := testkit.New(t)
+
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	token := h.JoinAsGuest(code, "Mallory")
+	ws := h.Connect(code, token)
+	ws.Expect(chat.TypeInitData)
+
+	attachment := h.Upload(token, "report.txt", "text/plain", []byte("quarterly report"))
+	ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{attachment},
+	}, "tmp-report")
+	ws.Expect(chat.TypeConfirm)
+
+	link := "/api/file/presign-download?k=" + url.QueryEscape(attachment.Key)
+	if res := h.Do(http.MethodGet, link, token, nil); res.Status != http.StatusFound {
+		t.Fatalf("download before the rewrite: got status %d (code %d)", res.Status, res.Code)
+	}
+
+	// the presigned upload URL is still valid: same Content-Type and length, other bytes
+	if err := h.PrivateStorage.Put(context.Background(), attachment.Key, []byte("unscanned bytes!"), "text/plain"); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+
+	if res := h.Do(http.MethodGet, link, token, nil); res.Code != errs.ErrAttachmentContentInvalid {
+		t.Fatalf("download after the rewrite: got status %d (code %d), want code %d", res.Status, res.Code, errs.ErrAttachmentContentInvalid)
+	}
+
+	deadline := time.Now().Add(testkit.DefaultTimeout)
+	for h.PrivateStorage.Has(attachment.Key) {
+		if time.Now().After(deadline) {
+			t.Fatalf("rewritten object %q was not deleted", attachment.Key)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMultipartUploadIsSizedByPlan(t *testing.T) {
+	h := testkit.New(t)
+
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	data := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 3*1024*1024)
+
+	guestToken := h.JoinAsGuest(code, "Guest")
+	res := h.Do(http.MethodPost, "/api/file/multipart/initiate", guestToken, map[string]any{
+		"fileName": "big.png",
+		"mimeType": "image/png",
+		"fileSize": len(data),
+	})
+	if res.Code != errs.ErrFileSizeTooLarge {
+		t.Fatalf("guest initiate: got code %d, want %d", res.Code, errs.ErrFileSizeTooLarge)
+	}
+
+	user := h.Register("bob_0001", "secret123")
+	userToken := h.JoinAsUser(code, user)
+	attachment := h.UploadMultipart(userToken, "big.png", "image/png", data)
+
+	stored, err := h.PrivateStorage.Get(context.Background(), attachment.Key, attachment.Size)
+	if err != nil {
+		t.Fatalf("get assembled object: %v", err)
+	}
+	if !bytes.Equal(stored, data) {
+		t.Fatalf("assembled object differs from the uploaded data (%d bytes, want %d)", len(stored), len(data))
+	}
+
+	var parts int
+	for _, p := range h.PrivateStorage.Presigns() {
+		if p.Op == storage.PresignOpUploadPart && p.Key == attachment.Key {
+			parts++
+		}
+	}
+	if parts != 3 {
+		t.Fatalf("part presigns: got %d, want 3", parts)
+	}
+}
+
+func TestDocumentDownloadsAsAttachment(t *testing.T) {
+	h := testkit.New(t)
+
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	token := h.JoinAsGuest(code, "Erin")
+
+	res := h.Do(http.MethodPost, "/api/file/presign-upload", token, map[string]any{
+		"fileName": "archive.zip",
+		"mimeType": "application/zip",
+		"fileSize": 1024,
+	})
+	if res.Code != errs.ErrAttachmentTypeNotAllowed {
+		t.Fatalf("guest zip upload: got code %d, want %d", res.Code, errs.ErrAttachmentTypeNotAllowed)
+	}
+
+	attachment := h.Upload(token, "report.pdf", "application/pdf", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n"))
+
+	res = h.Do(http.MethodGet, "/api/file/presign-download?k="+url.QueryEscape(attachment.Key)+"&n=Q3+report.pdf", token, nil)
+	if res.Status != http.StatusFound {
+		t.Fatalf("presign download: got status %d (code %d)", res.Status, res.Code)
+	}
+
+	presigns := h.PrivateStorage.Presigns()
+	last := presigns[len(presigns)-1]
+	if last.Download.ContentType != "application/pdf" {
+		t.Fatalf("content type override: got %q", last.Download.ContentType)
+	}
+	if want := `attachment; filename="Q3 report.pdf"`; last.Download.ContentDisposition != want {
+		t.Fatalf("content disposition override: got %q, want %q", last.Download.ContentDisposition, want)
+	}
+}
+
+func TestVoiceMessageIsValidatedAndBroadcast(t *testing.T) {
+	h := testkit.New(t)
+
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	token := h.JoinAsGuest(code, "Frank")
+	sender := h.Connect(code, token)
+	sender.Expect(chat.TypeInitData)
+
+	receiver := h.Connect(code, h.JoinAsGuest(code, "Grace"))
+	receiver.Expect(chat.TypeInitData)
+
+	recording := append([]byte("OggS\x00"), bytes.Repeat([]byte{0x42}, 20*1024)...)
+	attachment := h.Upload(token, "voice.ogg", "audio/ogg", recording)
+
+	sender.Send(chat.TypeVoice, chat.VoicePayload{Attachment: attachment, DurationMs: 10}, "tmp-short")
+	if got := sender.ExpectError(); got.Code != errs.ErrVoiceInvalid {
+		t.Fatalf("inconsistent duration: got code %d, want %d", got.Code, errs.ErrVoiceInvalid)
+	}
+
+	sender.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{attachment},
+	}, "tmp-as-file")
+	if got := sender.ExpectError(); got.Code != errs.ErrAttachmentTypeNotAllowed {
+		t.Fatalf("voice sent as attachment: got code %d, want %d", got.Code, errs.ErrAttachmentTypeNotAllowed)
+	}
+
+	sender.Send(chat.TypeVoice, chat.VoicePayload{
+		Attachment: attachment,
+		DurationMs: 10000,
+		Waveform:   []int{0, 64, 255, 128},
+	}, "tmp-voice")
+	sender.Expect(chat.TypeConfirm)
+
+	var payload chat.VoicePayload
+	testkit.DecodePayload(t, receiver.Expect(chat.TypeVoice), &payload)
+
+	if payload.DurationMs != 10000 || len(payload.Waveform) != 4 || payload.Attachment.Key != attachment.Key {
+		t.Fatalf("voice payload: got %+v", payload)
+	}
+}
+
+func TestViewOnceAttachmentIsDownloadableOncePerRecipient(t *testing.T) {
+	h := testkit.New(t)
+
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	token := h.JoinAsGuest(code, "Heidi")
+	sender := h.Connect(code, token)
+	sender.Expect(chat.TypeInitData)
+
+	receiverToken := h.JoinAsGuest(code, "Ivan")
+	receiver := h.Connect(code, receiverToken)
+	receiver.Expect(chat.TypeInitData)
+
+	attachment := h.Upload(token, "secret.png", "image/png", testPNG(t, 64, 64))
+	attachment.ViewOnce = true
+
+	sender.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{attachment},
+	}, "tmp-view-once")
+	sender.Expect(chat.TypeConfirm)
+
+	var payload chat.AttachmentsPayload
+	testkit.DecodePayload(t, receiver.Expect(chat.TypeAttachments), &payload)
+
+	var meta chat.ImageMeta
+	if err := json.Unmarshal(payload.Attachments[0].Meta, &meta); err != nil {
+		t.Fatalf("decode meta: %v", err)
+	}
+	if !payload.Attachments[0].ViewOnce || meta.ThumbnailKey != "" {
+		t.Fatalf("view-once attachment: got %+v", payload.Attachments[0])
+	}
+
+	download := "/api/file/presign-download?k=" + url.QueryEscape(attachment.Key)
+
+	if res := h.Do(http.MethodGet, download, token, nil); res.Code != errs.ErrViewOnceUnavailable {
+		t.Fatalf("sender download: got code %d, want %d", res.Code, errs.ErrViewOnceUnavailable)
+	}
+
+	// a storage failure does not use up the view
+	h.PrivateStorage.FailPresigns(errors.New("storage unavailable"))
+	if res := h.Do(http.MethodGet, download, receiverToken, nil); res.Code != errs.ErrFileStorageFailed {
+		t.Fatalf("failed download: got code %d, want %d", res.Code, errs.ErrFileStorageFailed)
+	}
+	h.PrivateStorage.FailPresigns(nil)
+
+	if res := h.Do(http.MethodGet, download, receiverToken, nil); res.Status != http.StatusFound {
+		t.Fatalf("first download: got status %d (code %d)", res.Status, res.Code)
+	}
+
+	presigns := h.PrivateStorage.Presigns()
+	if last := presigns[len(presigns)-1]; last.Duration != chat.ViewOnceURLDuration {
+		t.Fatalf("view-once URL duration: got %v", last.Duration)
+	}
+
+	if res := h.Do(http.MethodGet, download, receiverToken, nil); res.Code != errs.ErrViewOnceUnavailable {
+		t.Fatalf("second download: got code %d, want %d", res.Code, errs.ErrViewOnceUnavailable)
+	}
+}
+
+func TestUploadsAreLimitedByQuota(t *testing.T) {
+	h := testkit.New(t, func(cfg *configs.AppConfig) {
+		plan := cfg.UploadPlans[configs.GuestPlan]
+		plan.QuotaMB = 1
+		cfg.UploadPlans[configs.GuestPlan] = plan
+	})
+
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	token := h.JoinAsGuest(code, "Judy")
+	ws := h.Connect(code, token)
+
+	var init chat.InitDataPayload
+	testkit.DecodePayload(t, ws.Expect(chat.TypeInitData), &init)
+	if init.Quota.UserRemaining == nil || *init.Quota.UserRemaining != 1024*1024 {
+		t.Fatalf("initial user quota: got %+v", init.Quota)
+	}
+
+	presign := func(size int) *testkit.Response {
+		return h.Do(http.MethodPost, "/api/file/presign-upload", token, map[string]any{
+			"fileName": "notes.txt",
+			"mimeType": "text/plain",
+			"fileSize": size,
+		})
+	}
+
+	res := presign(768 * 1024)
+	var data struct {
+		Quota chat.QuotaStatus `json:"quota"`
+	}
+	res.Decode(t, &data)
+	if data.Quota.UserRemaining == nil || *data.Quota.UserRemaining != 256*1024 {
+		t.Fatalf("remaining user quota: got %+v", data.Quota)
+	}
+
+	if res := presign(512 * 1024); res.Code != errs.ErrUploadQuotaExceeded {
+		t.Fatalf("upload over quota: got code %d, want %d", res.Code, errs.ErrUploadQuotaExceeded)
+	}
+}
+
+func TestAvatarMustBeOwnWebPAndIsResized(t *testing.T) {
+	h := testkit.New(t)
+
+	alice := h.Register("alice_0001", "secret123")
+	mallory := h.Register("mallory_0001", "secret123")
+
+	presign := func(u *testkit.User) string {
+		res := h.MustOK(http.MethodPost, "/api/user/avatar/presign", u.Token, map[string]any{
+			"mimeType": "image/webp",
+			"fileSize": 1024,
+		})
+
+		var data struct {
+			FileKey string `json:"fileKey"`
+		}
+		res.Decode(t, &data)
+
+		return data.FileKey
+	}
+
+	updateAvatar := func(u *testkit.User, key string) *testkit.Response {
+		return h.Do(http.MethodPost, "/api/user/profile", u.Token, map[string]string{
+			"nickname":  u.Nickname,
+			"avatarUrl": key,
+		})
+	}
+
+	// a 1x1 lossless WebP image
+	webp := []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+
+	aliceKey := presign(alice)
+	if err := h.PublicStorage.Put(context.Background(), aliceKey, webp, "image/webp"); err != nil {
+		t.Fatalf("store avatar: %v", err)
+	}
+
+	if res := updateAvatar(mallory, aliceKey); res.Code != errs.ErrAvatarInvalid {
+		t.Fatalf("foreign avatar: got code %d, want %d", res.Code, errs.ErrAvatarInvalid)
+	}
+
+	malloryKey := presign(mallory)
+	if err := h.PublicStorage.Put(context.Background(), malloryKey, testPNG(t, 32, 32), "image/webp"); err != nil {
+		t.Fatalf("store avatar: %v", err)
+	}
+
+	if res := updateAvatar(mallory, malloryKey); res.Code != errs.ErrAvatarInvalid {
+		t.Fatalf("PNG avatar: got code %d, want %d", res.Code, errs.ErrAvatarInvalid)
+	}
+
+	res := updateAvatar(alice, aliceKey)
+	if res.Code != 0 {
+		t.Fatalf("own avatar: got code %d (%s)", res.Code, res.Message)
+	}
+
+	var data struct {
+		User struct {
+			Avatar      string            `json:"avatar"`
+			AvatarSizes map[string]string `json:"avatarSizes"`
+		} `json:"user"`
+	}
+	res.Decode(t, &data)
+
+	if len(data.User.AvatarSizes) != 3 || data.User.AvatarSizes["256"] != data.User.Avatar {
+		t.Fatalf("avatar sizes: got %+v", data.User)
+	}
+	if h.PublicStorage.Has(aliceKey) {
+		t.Fatalf("uploaded avatar %q was not replaced by its variants", aliceKey)
+	}
+}
+
+func TestDefaultAvatarIsGeneratedAndCacheable(t *testing.T) {
+	h := testkit.New(t)
+
+	res := h.MustOK(http.MethodPost, "/api/auth/register", "", map[string]string{
+		"username": "kim_0001",
+		"password": "secret123",
+	})
+
+	var data struct {
+		User struct {
+			ID     string `json:"id"`
+			Avatar string `json:"avatar"`
+		} `json:"user"`
+	}
+	res.Decode(t, &data)
+
+	if want := "/api/avatar/default/" + data.User.ID; data.User.Avatar != want {
+		t.Fatalf("default avatar: got %q, want %q", data.User.Avatar, want)
+	}
+
+	first, err := http.Get(h.Server.URL + data.User.Avatar)
+	if err != nil {
+		t.Fatalf("get avatar: %v", err)
+	}
+	first.Body.Close()
+
+	etag := first.Header.Get("ETag")
+	if first.StatusCode != http.StatusOK || first.Header.Get("Content-Type") != "image/svg+xml" || etag == "" {
+		t.Fatalf("avatar response: status %d, headers %v", first.StatusCode, first.Header)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, h.Server.URL+data.User.Avatar, nil)
+	req.Header.Set("If-None-Match", etag)
+
+	second, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("revalidate avatar: %v", err)
+	}
+	second.Body.Close()
+
+	if second.StatusCode != http.StatusNotModified {
+		t.Fatalf("revalidation: got status %d, want %d", second.StatusCode, http.StatusNotModified)
+	}
+
+	if res := h.Do(http.MethodGet, "/api/avatar/default/..%2Fetc", "", nil); res.Code != errs.ErrInvalidParams {
+		t.Fatalf("invalid ID: got code %d, want %d", res.Code, errs.ErrInvalidParams)
+	}
+}
+
+func TestResentAttachmentIsCopiedInsteadOfUploaded(t *testing.T) {
+	h := testkit.New(t)
+
+	user := h.Register("lena_0001", "secret123")
+
+	first := h.CreateRoom(chat.RoomTypeGroup)
+	token := h.JoinAsUser(first, user)
+	ws := h.Connect(first, token)
+	ws.Expect(chat.TypeInitData)
+
+	data := []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n")
+	attachment := h.Upload(token, "report.pdf", "application/pdf", data)
+
+	ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{attachment},
+	}, "tmp-first")
+	ws.Expect(chat.TypeConfirm)
+	waitForContent(t, h, user.ID, chat.HashContent(data), "application/pdf")
+
+	second := h.CreateRoom(chat.RoomTypeGroup)
+	secondToken := h.JoinAsUser(second, user)
+
+	res := h.MustOK(http.MethodPost, "/api/file/presign-upload", secondToken, map[string]any{
+		"fileName":    "report.pdf",
+		"mimeType":    "application/pdf",
+		"fileSize":    len(data),
+		"contentHash": chat.HashContent(data),
+	})
+
+	var copied struct {
+		PresignedURL string `json:"presignedUrl"`
+		FileKey      string `json:"fileKey"`
+		FileSize     int64  `json:"fileSize"`
+		Deduplicated bool   `json:"deduplicated"`
+	}
+	res.Decode(t, &copied)
+
+	if !copied.Deduplicated || copied.PresignedURL != "" || copied.FileSize != int64(len(data)) {
+		t.Fatalf("deduplicated presign: got %+v", copied)
+	}
+	if !strings.HasPrefix(copied.FileKey, second+"/") || !h.PrivateStorage.Has(copied.FileKey) {
+		t.Fatalf("copy %q was not stored under room %s", copied.FileKey, second)
+	}
+
+	// another user's upload of the same content is not shared
+	other := h.JoinAsGuest(second, "Mike")
+	res = h.MustOK(http.MethodPost, "/api/file/presign-upload", other, map[string]any{
+		"fileName":    "report.pdf",
+		"mimeType":    "application/pdf",
+		"fileSize":    len(data),
+		"contentHash": chat.HashContent(data),
+	})
+	var uploaded struct {
+		PresignedURL string `json:"presignedUrl"`
+		Deduplicated bool   `json:"deduplicated"`
+	}
+	res.Decode(t, &uploaded)
+	if uploaded.Deduplicated || uploaded.PresignedURL == "" {
+		t.Fatalf("other user's presign: got %+v", uploaded)
+	}
+}
+
+func TestResentImageIsNotProcessedAgain(t *testing.T) {
+	h := testkit.New(t)
+
+	user := h.Register("nora_0001", "secret123")
+
+	first := h.CreateRoom(chat.RoomTypeGroup)
+	ws := h.Connect(first, h.JoinAsUser(first, user))
+	ws.Expect(chat.TypeInitData)
+
+	attachment := h.Upload(h.JoinAsUser(first, user), "photo.png", "image/png", testPNG(t, 320, 200))
+
+	ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{attachment},
+	}, "tmp-first")
+	ws.Expect(chat.TypeConfirm)
+
+	// the index holds the hash of the sanitized image, which is what clients download and resend
+	sanitized, err := h.PrivateStorage.Get(context.Background(), attachment.Key, chat.MaxAttachmentSize)
+	if err != nil {
+		t.Fatalf("get sanitized image: %v", err)
+	}
+	waitForContent(t, h, user.ID, chat.HashContent(sanitized), "image/png")
+
+	second := h.CreateRoom(chat.RoomTypeGroup)
+	secondToken := h.JoinAsUser(second, user)
+	sender := h.Connect(second, secondToken)
+	sender.Expect(chat.TypeInitData)
+	receiver := h.Connect(second, h.JoinAsGuest(second, "Owen"))
+	receiver.Expect(chat.TypeInitData)
+
+	res := h.MustOK(http.MethodPost, "/api/file/presign-upload", secondToken, map[string]any{
+		"fileName":    "photo.png",
+		"mimeType":    "image/png",
+		"fileSize":    len(sanitized),
+		"contentHash": chat.HashContent(sanitized),
+	})
+	var copied struct {
+		FileKey      string `json:"fileKey"`
+		FileSize     int64  `json:"fileSize"`
+		Deduplicated bool   `json:"deduplicated"`
+	}
+	res.Decode(t, &copied)
+	if !copied.Deduplicated {
+		t.Fatalf("image was not deduplicated: got %+v", copied)
+	}
+
+	// corrupt the copy past its signature, so that decoding it again would fail
+	corrupted := make([]byte, len(sanitized))
+	copy(corrupted, sanitized[:16])
+	if err := h.PrivateStorage.Put(context.Background(), copied.FileKey, corrupted, "image/png"); err != nil {
+		t.Fatalf("corrupt copy: %v", err)
+	}
+
+	sender.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{{Key: copied.FileKey, Name: "photo.png", MimeType: "image/png", Size: copied.FileSize}},
+	}, "tmp-second")
+	sender.Expect(chat.TypeConfirm)
+
+	var payload chat.AttachmentsPayload
+	testkit.DecodePayload(t, receiver.Expect(chat.TypeAttachments), &payload)
+
+	var meta chat.ImageMeta
+	if err := json.Unmarshal(payload.Attachments[0].Meta, &meta); err != nil {
+		t.Fatalf("decode meta: %v", err)
+	}
+	if meta.Width != 320 || meta.Height != 200 {
+		t.Fatalf("meta dimensions: got %dx%d", meta.Width, meta.Height)
+	}
+	if !strings.HasPrefix(meta.ThumbnailKey, second+"/") || !h.PrivateStorage.Has(meta.ThumbnailKey) {
+		t.Fatalf("thumbnail %q was not copied to room %s", meta.ThumbnailKey, second)
+	}
+}
+
+func TestInfectedAttachmentIsRemovedAndScanOutagesFailClosed(t *testing.T) {
+	clamd := testkit.NewFakeClamd(t)
+	h := testkit.New(t, func(cfg *configs.AppConfig) {
+		cfg.Scanner = chat.ScannerClamd
+		cfg.ClamdAddress = clamd.Address()
+	})
+
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	token := h.JoinAsGuest(code, "Oscar")
+	ws := h.Connect(code, token)
+	ws.Expect(chat.TypeInitData)
+
+	infected := h.Upload(token, "readme.txt", "text/plain", []byte("hello "+testkit.EICAR))
+
+	ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{infected},
+	}, "tmp-infected")
+
+	if got := ws.ExpectError(); got.Code != errs.ErrAttachmentInfected {
+		t.Fatalf("infected: got code %d, want %d", got.Code, errs.ErrAttachmentInfected)
+	}
+
+	deadline := time.Now().Add(testkit.DefaultTimeout)
+	for h.PrivateStorage.Has(infected.Key) {
+		if time.Now().After(deadline) {
+			t.Fatalf("infected object %q was not deleted", infected.Key)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	clean := h.Upload(token, "notes.txt", "text/plain", []byte("just some notes"))
+	download := "/api/file/presign-download?k=" + url.QueryEscape(clean.Key)
+
+	clamd.SetDown(true)
+
+	if res := h.Do(http.MethodGet, download, token, nil); res.Code != errs.ErrAttachmentScanUnavailable {
+		t.Fatalf("download during outage: got code %d, want %d", res.Code, errs.ErrAttachmentScanUnavailable)
+	}
+
+	ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{clean},
+	}, "tmp-outage")
+
+	if got := ws.ExpectError(); got.Code != errs.ErrAttachmentScanUnavailable {
+		t.Fatalf("send during outage: got code %d, want %d", got.Code, errs.ErrAttachmentScanUnavailable)
+	}
+
+	clamd.SetDown(false)
+
+	ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{clean},
+	}, "tmp-clean")
+	ws.Expect(chat.TypeConfirm)
+
+	if res := h.Do(http.MethodGet, download, token, nil); res.Status != http.StatusFound {
+		t.Fatalf("clean download: got status %d (code %d)", res.Status, res.Code)
+	}
+}
+
+func TestLateJoinerCanPageThroughSharedFiles(t *testing.T) {
+	h := testkit.New(t)
+
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	token := h.JoinAsGuest(code, "Nina")
+	ws := h.Connect(code, token)
+	ws.Expect(chat.TypeInitData)
+
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	for i, name := range names {
+		attachment := h.Upload(token, name, "text/plain", []byte("file "+name))
+		attachment.ViewOnce = i == 1
+
+		ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+			Attachments: []chat.Attachment{attachment},
+		}, "tmp-"+name)
+		ws.Expect(chat.TypeConfirm)
+	}
+
+	lateToken := h.JoinAsGuest(code, "Omar")
+
+	var first chat.GalleryPage
+	h.MustOK(http.MethodGet, "/api/chat/files?limit=1", lateToken, nil).Decode(t, &first)
+	if len(first.Files) != 1 || first.Files[0].Name != "c.txt" || first.NextCursor == "" {
+		t.Fatalf("first page: got %+v", first)
+	}
+	if first.Files[0].Sender.Nickname != "Nina" {
+		t.Fatalf("sender: got %+v", first.Files[0].Sender)
+	}
+
+	// the view-once attachment is not listed
+	var second chat.GalleryPage
+	h.MustOK(http.MethodGet, "/api/chat/files?limit=1&cursor="+url.QueryEscape(first.NextCursor), lateToken, nil).Decode(t, &second)
+	if len(second.Files) != 1 || second.Files[0].Name != "a.txt" || second.NextCursor != "" {
+		t.Fatalf("second page: got %+v", second)
+	}
+
+	download := "/api/file/presign-download?k=" + url.QueryEscape(second.Files[0].Key)
+	if res := h.Do(http.MethodGet, download, lateToken, nil); res.Status != http.StatusFound {
+		t.Fatalf("download: got status %d (code %d)", res.Status, res.Code)
+	}
+
+	if res := h.Do(http.MethodGet, "/api/chat/files?cursor=bogus", lateToken, nil); res.Code != errs.ErrInvalidParams {
+		t.Fatalf("invalid cursor: got code %d, want %d", res.Code, errs.ErrInvalidParams)
+	}
+
+	late := h.Connect(code, lateToken)
+	late.Expect(chat.TypeInitData)
+	late.Send(chat.TypeGallery, chat.GalleryRequestPayload{}, "tmp-gallery")
+
+	reply := late.Expect(chat.TypeGallery)
+	var page chat.GalleryPage
+	testkit.DecodePayload(t, reply, &page)
+	if reply.TempID != "tmp-gallery" || len(page.Files) != 2 || page.Files[0].Name != "c.txt" {
+		t.Fatalf("gallery reply: got %+v (tempId %q)", page, reply.TempID)
+	}
+}
+
+func TestAvatarURLsAreSignedWithTheActiveKey(t *testing.T) {
+	h := testkit.New(t, func(cfg *configs.AppConfig) {
+		cfg.CDNSigning = cdnsign.ModeHMAC
+		cfg.CDNSigningKeys = []configs.CDNSigningKey{{ID: "old", Secret: "old-secret"}, {ID: "new", Secret: "new-secret"}}
+		cfg.CDNSigningKeyID = "new"
+		cfg.CDNSignedURLMinutes = 60
+	})
+
+	pat := h.Register("pat_0001", "secret123")
+
+	res := h.MustOK(http.MethodPost, "/api/user/avatar/presign", pat.Token, map[string]any{
+		"mimeType": "image/webp",
+		"fileSize": 1024,
+	})
+	var presigned struct {
+		FileKey string `json:"fileKey"`
+	}
+	res.Decode(t, &presigned)
+
+	webp := []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+	if err := h.PublicStorage.Put(context.Background(), presigned.FileKey, webp, "image/webp"); err != nil {
+		t.Fatalf("store avatar: %v", err)
+	}
+
+	h.MustOK(http.MethodPost, "/api/user/profile", pat.Token, map[string]string{
+		"nickname":  pat.Nickname,
+		"avatarUrl": presigned.FileKey,
+	})
+
+	var profile struct {
+		User struct {
+			Avatar      string            `json:"avatar"`
+			AvatarSizes map[string]string `json:"avatarSizes"`
+		} `json:"user"`
+	}
+	h.MustOK(http.MethodGet, "/api/user/profile", pat.Token, nil).Decode(t, &profile)
+
+	for _, signed := range append([]string{profile.User.Avatar}, profile.User.AvatarSizes["64"]) {
+		resource, query, _ := strings.Cut(signed, "?")
+		params, err := url.ParseQuery(query)
+		if err != nil || !strings.HasPrefix(resource, h.Config.PublicAssetBaseURL+"/avatars/") {
+			t.Fatalf("signed URL: got %q", signed)
+		}
+
+		expires, _ := strconv.ParseInt(params.Get("Expires"), 10, 64)
+		if until := time.Until(time.Unix(expires, 0)); until < time.Hour || until > 75*time.Minute+time.Second {
+			t.Fatalf("expiry: got %v from now", until)
+		}
+
+		mac := hmac.New(sha256.New, []byte("new-secret"))
+		mac.Write([]byte(cdnsign.CannedPolicy(resource, expires)))
+		if params.Get("Key-Pair-Id") != "new" || params.Get("Signature") != cdnsign.EncodeSignature(mac.Sum(nil)) {
+			t.Fatalf("signature of %q does not verify with the active key", signed)
+		}
+	}
+
+	// a signed URL sent back by the client still refers to the stored avatar
+	res = h.MustOK(http.MethodPost, "/api/user/profile", pat.Token, map[string]string{
+		"nickname":  "Pat",
+		"avatarUrl": profile.User.Avatar,
+	})
+	var updated struct {
+		User struct {
+			Avatar string `json:"avatar"`
+		} `json:"user"`
+	}
+	res.Decode(t, &updated)
+	if resource, _, _ := strings.Cut(updated.User.Avatar, "?"); !strings.HasPrefix(profile.User.Avatar, resource+"?") {
+		t.Fatalf("avatar after renaming: got %q, want %q", updated.User.Avatar, profile.User.Avatar)
+	}
+}
+
+func TestDownloadLinksAreReusedThrottledAndCounted(t *testing.T) {
+	h := testkit.New(t, func(cfg *configs.AppConfig) {
+		for i, p := range cfg.RateLimitPolicies {
+			if p.Name == handler.PolicyFileDownloadObject {
+				cfg.RateLimitPolicies[i].Rate, cfg.RateLimitPolicies[i].Burst = 0.001, 3
+			}
+		}
+	})
+
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	hostToken := h.JoinAsGuest(code, "Quinn")
+	host := h.Connect(code, hostToken)
+	host.Expect(chat.TypeInitData)
+
+	attachment := h.Upload(hostToken, "minutes.txt", "text/plain", []byte("meeting minutes"))
+	host.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{attachment},
+	}, "tmp-minutes")
+	host.Expect(chat.TypeConfirm)
+
+	guestToken := h.JoinAsGuest(code, "Rita")
+	download := "/api/file/presign-download?k=" + url.QueryEscape(attachment.Key)
+
+	presigned := len(h.PrivateStorage.Presigns())
+
+	first := h.Do(http.MethodGet, download, guestToken, nil)
+	second := h.Do(http.MethodGet, download, guestToken, nil)
+	if first.Status != http.StatusFound || first.Header.Get("Location") != second.Header.Get("Location") {
+		t.Fatalf("repeated downloads: got %d %q and %d %q",
+			first.Status, first.Header.Get("Location"), second.Status, second.Header.Get("Location"))
+	}
+	if n := len(h.PrivateStorage.Presigns()) - presigned; n != 1 {
+		t.Fatalf("presigned URLs: got %d, want 1", n)
+	}
+
+	if res := h.Do(http.MethodGet, download, hostToken, nil); res.Status != http.StatusFound {
+		t.Fatalf("host download: got status %d (code %d)", res.Status, res.Code)
+	}
+
+	// the file's bucket is exhausted for every user
+	if res := h.Do(http.MethodGet, download, hostToken, nil); res.Code != errs.ErrRateLimitExceeded {
+		t.Fatalf("throttled download: got code %d, want %d", res.Code, errs.ErrRateLimitExceeded)
+	}
+
+	if res := h.Do(http.MethodGet, "/api/file/downloads", guestToken, nil); res.Code != errs.ErrNotRoomHost {
+		t.Fatalf("guest stats: got code %d, want %d", res.Code, errs.ErrNotRoomHost)
+	}
+
+	var stats struct {
+		Files []chat.DownloadStat `json:"files"`
+	}
+	h.MustOK(http.MethodGet, "/api/file/downloads", hostToken, nil).Decode(t, &stats)
+	if len(stats.Files) != 1 || stats.Files[0].Downloads != 3 || stats.Files[0].Downloaders != 2 {
+		t.Fatalf("download stats: got %+v", stats.Files)
+	}
+}
+
+func TestTokensAreOnlyAcceptedForTheirAudience(t *testing.T) {
+	h := testkit.New(t)
+
+	sam := h.Register("sam_0001", "secret123")
+	code := h.CreateRoom(chat.RoomTypeGroup)
+	roomToken := h.JoinAsUser(code, sam)
+	ws := h.Connect(code, roomToken)
+	ws.Expect(chat.TypeInitData)
+
+	report := h.Upload(roomToken, "report.txt", "text/plain", []byte("quarterly report"))
+	other := h.Upload(roomToken, "other.txt", "text/plain", []byte("other file"))
+	ws.Send(chat.TypeAttachments, chat.AttachmentsPayload{
+		Attachments: []chat.Attachment{report, other},
+	}, "tmp-report")
+	ws.Expect(chat.TypeConfirm)
+
+	if res := h.Do(http.MethodGet, "/api/user/profile", roomToken, nil); res.Code != errs.ErrUnauthorized {
+		t.Fatalf("room token for profile: got code %d, want %d", res.Code, errs.ErrUnauthorized)
+	}
+	if res := h.Do(http.MethodGet, "/api/chat/files", sam.Token, nil); res.Code != errs.ErrUnauthorized {
+		t.Fatalf("identity token for room files: got code %d, want %d", res.Code, errs.ErrUnauthorized)
+	}
+
+	linkTo := func(key, token string) string {
+		return "/api/file/presign-download?k=" + url.QueryEscape(key) + "&t=" + url.QueryEscape(token)
+	}
+
+	// room access tokens no longer travel in links
+	if res := h.Do(http.MethodGet, linkTo(report.Key, roomToken), "", nil); res.Code != errs.ErrUnauthorized {
+		t.Fatalf("room token in link: got code %d, want %d", res.Code, errs.ErrUnauthorized)
+	}
+
+	var issued struct {
+		Token     string `json:"token"`
+		ExpiresIn int    `json:"expiresIn"`
+	}
+	h.MustOK(http.MethodPost, "/api/file/download-token", roomToken, map[string]string{
+		"fileKey": report.Key,
+	}).Decode(t, &issued)
+	if issued.Token == "" || issued.ExpiresIn != int(jwt.DownloadExpiration.Seconds()) {
+		t.Fatalf("download token: got %+v", issued)
+	}
+
+	if res := h.Do(http.MethodGet, linkTo(report.Key, issued.Token), "", nil); res.Status != http.StatusFound {
+		t.Fatalf("download link: got status %d (code %d)", res.Status, res.Code)
+	}
+	if res := h.Do(http.MethodGet, linkTo(other.Key, issued.Token), "", nil); res.Code != errs.ErrUnauthorized {
+		t.Fatalf("download token for another file: got code %d, want %d", res.Code, errs.ErrUnauthorized)
+	}
+	if res := h.Do(http.MethodGet, "/api/chat/files", issued.Token, nil); res.Code != errs.ErrUnauthorized {
+		t.Fatalf("download token as bearer: got code %d, want %d", res.Code, errs.ErrUnauthorized)
+	}
+
+	if res := h.Do(http.MethodPost, "/api/file/download-token", roomToken, map[string]string{
+		"fileKey": "ZZZZZZ/secret.txt",
+	}); res.Code != errs.ErrUnauthorized {
+		t.Fatalf("download token for another room: got code %d, want %d", res.Code, errs.ErrUnauthorized)
+	}
+}
+
+// dialCode opens a WebSocket connection and returns it, or the business code of the rejected handshake.
+func dialCode(t *testing.T, h *testkit.Harness, roomCode, roomToken string) (*websocket.Conn, int) {
+	t.Helper()
+
+	conn, res, err := h.Dial(roomCode, roomToken)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+		return conn, 0
+	}
+	if res == nil {
+		t.Fatalf("dial room %s: %v", roomCode, err)
+	}
+	defer res.Body.Close()
+
+	var envelope struct {
+		Code int `json:"code"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil {
+		t.Fatalf("decode rejected handshake (status %d): %v", res.StatusCode, err)
+	}
+
+	return nil, envelope.Code
+}
+
+// dialUntilAccepted retries a connection whose slot is freed asynchronously by the server.
+func dialUntilAccepted(t *testing.T, h *testkit.Harness, roomCode, roomToken string) {
+	t.Helper()
+
+	deadline := time.Now().Add(testkit.DefaultTimeout)
+	for {
+		_, code := dialCode(t, h, roomCode, roomToken)
+		if code == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connection slot was not freed: got code %d", code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnectionsAreCappedPerIPAndUser(t *testing.T) {
+	t.Run("per ip", func(t *testing.T) {
+		h := testkit.New(t, func(cfg *configs.AppConfig) {
+			cfg.MaxConnsPerIP = 2
+		})
+		code := h.CreateRoom(chat.RoomTypeGroup)
+
+		first, _ := dialCode(t, h, code, h.JoinAsGuest(code, "Guest One"))
+		dialCode(t, h, code, h.JoinAsGuest(code, "Guest Two"))
+
+		third := h.JoinAsGuest(code, "Guest Three")
+		if _, got := dialCode(t, h, code, third); got != errs.ErrTooManyConnections {
+			t.Fatalf("connection over the ip cap: got code %d, want %d", got, errs.ErrTooManyConnections)
+		}
+
+		first.Close()
+		dialUntilAccepted(t, h, code, third)
+	})
+
+	t.Run("per user", func(t *testing.T) {
+		h := testkit.New(t, func(cfg *configs.AppConfig) {
+			cfg.MaxConnsPerUser = 1
+		})
+		sam := h.Register("sam_0001", "secret123")
+		lobby := h.CreateRoom(chat.RoomTypeGroup)
+		other := h.CreateRoom(chat.RoomTypeGroup)
+
+		first, _ := dialCode(t, h, lobby, h.JoinAsUser(lobby, sam))
+
+		otherToken := h.JoinAsUser(other, sam)
+		if _, got := dialCode(t, h, other, otherToken); got != errs.ErrTooManyConnections {
+			t.Fatalf("connection over the user cap: got code %d, want %d", got, errs.ErrTooManyConnections)
+		}
+
+		// other users are not affected by sam's cap
+		dialCode(t, h, other, h.JoinAsGuest(other, "Guest One"))
+
+		first.Close()
+		dialUntilAccepted(t, h, other, otherToken)
+	})
+
+	t.Run("failed upgrade", func(t *testing.T) {
+		h := testkit.New(t, func(cfg *configs.AppConfig) {
+			cfg.MaxConnsPerIP = 1
+		})
+		code := h.CreateRoom(chat.RoomTypeGroup)
+		roomToken := h.JoinAsGuest(code, "Guest One")
+
+		// a plain request passes every check but cannot be upgraded
+		path := "/ws/" + code + "?token=" + url.QueryEscape(roomToken)
+		if res := h.Do(http.MethodGet, path, "", nil); res.Status != http.StatusBadRequest {
+			t.Fatalf("plain request: got status %d, want %d", res.Status, http.StatusBadRequest)
+		}
+
+		if _, got := dialCode(t, h, code, roomToken); got != 0 {
+			t.Fatalf("connection after a failed upgrade: got code %d, want the slot to be free", got)
+		}
+	})
+}
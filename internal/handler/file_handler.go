@@ -1,13 +1,18 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"hzchat/internal/app/chat"
+	"hzchat/internal/app/storage"
+	"hzchat/internal/app/user"
 	"hzchat/internal/pkg/auth/jwt"
 	"hzchat/internal/pkg/errs"
 	"hzchat/internal/pkg/randx"
@@ -21,6 +26,10 @@ type PresignChatMessageInput struct {
 	FileName string `json:"fileName"`
 	MimeType string `json:"mimeType"`
 	FileSize int64  `json:"fileSize"`
+
+	// ContentHash is the optional hex-encoded SHA-256 digest of the file, used to reuse a copy
+	// of a file the user recently sent instead of uploading it again.
+	ContentHash string `json:"contentHash,omitempty"`
 }
 
 func HandlePresignChatMessageURL(deps *AppDeps) http.HandlerFunc {
@@ -44,20 +53,57 @@ func HandlePresignChatMessageURL(deps *AppDeps) http.HandlerFunc {
 			return
 		}
 
-		if err := chat.ValidateFileSize(input.FileSize); err != nil {
-			resp.RespondError(w, r, err)
+		rule, customErr := deps.Manager.Attachments().Resolve(input.FileName, input.MimeType, room.Type, identity.PlanType)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
 			return
 		}
 
-		if err := chat.ValidateFileType(input.FileName, input.MimeType); err != nil {
+		// larger files must use a multipart upload
+		if err := chat.ValidateFileSizeLimit(input.FileSize, min(rule.MaxSize, chat.MaxAttachmentSize)); err != nil {
 			resp.RespondError(w, r, err)
 			return
 		}
 
+		if input.ContentHash != "" && !chat.IsContentHash(input.ContentHash) {
+			resp.RespondError(w, r, errs.NewError(errs.ErrInvalidParams))
+			return
+		}
+
 		fileExt := strings.ToLower(filepath.Ext(input.FileName))
 		fileID := uuid.New().String()
 		fileKey := fmt.Sprintf("%s/%s%s", identity.Code, fileID, fileExt)
 
+		if input.ContentHash != "" {
+			ref, ok := deps.Manager.Contents().Lookup(identity.ID, input.ContentHash, input.MimeType)
+			if ok {
+				data, customErr := copyContent(r, deps, identity, ref, input.ContentHash, fileKey)
+				if customErr != nil {
+					resp.RespondError(w, r, customErr)
+					return
+				}
+				if data != nil {
+					data["fileName"] = input.FileName
+					resp.RespondSuccess(w, r, data)
+					return
+				}
+				// the object is gone: fall back to a regular upload
+			}
+		}
+
+		quota, customErr := deps.Manager.Quotas().Reserve(
+			identity.Code,
+			identity.ID,
+			identity.PlanType,
+			fileKey,
+			input.FileSize,
+			chat.PresignedURLDuration,
+		)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
 		url, err := deps.PrivateStorage.PresignUpload(
 			r.Context(),
 			fileKey,
@@ -67,6 +113,7 @@ func HandlePresignChatMessageURL(deps *AppDeps) http.HandlerFunc {
 		)
 
 		if err != nil {
+			deps.Manager.Quotas().Release(identity.Code, fileKey)
 			resp.RespondError(w, r, errs.NewError(errs.ErrFileStorageFailed))
 			return
 		}
@@ -75,10 +122,53 @@ func HandlePresignChatMessageURL(deps *AppDeps) http.HandlerFunc {
 			"presignedUrl": url,
 			"fileKey":      fileKey,
 			"fileName":     input.FileName,
+			"quota":        quota,
 		})
 	}
 }
 
+// copyContent copies a file the user recently sent to the new key in the current room, so that
+// the room-scoped access checks apply to the copy. The response data tells the client to send the
+// copy, whose size may differ from the file's after image processing, instead of uploading.
+// It returns nil data if the recent file no longer exists.
+func copyContent(
+	r *http.Request,
+	deps *AppDeps,
+	identity *jwt.Payload,
+	ref chat.ContentRef,
+	hash string,
+	fileKey string,
+) (map[string]any, *errs.CustomError) {
+	quota, customErr := deps.Manager.Quotas().Reserve(
+		identity.Code,
+		identity.ID,
+		identity.PlanType,
+		fileKey,
+		ref.Size,
+		chat.PresignedURLDuration,
+	)
+	if customErr != nil {
+		return nil, customErr
+	}
+
+	if err := deps.Manager.Contents().Copy(r.Context(), identity.ID, hash, ref, identity.Code, fileKey); err != nil {
+		deps.Manager.Quotas().Release(identity.Code, fileKey)
+
+		if errors.Is(err, storage.ErrNotFound) {
+			deps.Manager.Contents().Forget(identity.ID, hash)
+			return nil, nil
+		}
+		return nil, errs.NewError(errs.ErrFileStorageFailed)
+	}
+
+	return map[string]any{
+		"fileKey":      fileKey,
+		"fileSize":     ref.Size,
+		"deduplicated": true,
+		"quota":        quota,
+	}, nil
+}
+
 type PresignAvatarInput struct {
 	MimeType string `json:"mimeType"`
 	FileSize int64  `json:"fileSize"`
@@ -103,12 +193,12 @@ func HandlePresignAvatarURL(deps *AppDeps) http.HandlerFunc {
 			return
 		}
 
-		if input.FileSize > 1*1024*1024 {
+		if input.FileSize > user.MaxAvatarUploadSize {
 			resp.RespondError(w, r, errs.NewError(errs.ErrFileSizeTooLarge))
 			return
 		}
 
-		fileKey := fmt.Sprintf("avatars/%s/%d.webp", identity.ID, time.Now().Unix())
+		fileKey := user.AvatarUploadKey(identity.ID, time.Now())
 
 		url, err := deps.PublicStorage.PresignUpload(
 			r.Context(),
@@ -130,6 +220,52 @@ func HandlePresignAvatarURL(deps *AppDeps) http.HandlerFunc {
 	}
 }
 
+type DownloadTokenInput struct {
+	FileKey string `json:"fileKey" validate:"required"`
+}
+
+// HandleDownloadToken issues a download token for a single file of the room, to be passed as the
+// "t" query parameter of presign-download links that cannot carry an Authorization header. Unlike
+// the room access token, a leaked link only exposes that file, and only for a short time.
+func HandleDownloadToken(deps *AppDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, _, customErr := roomIdentity(deps, r)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		var input DownloadTokenInput
+		if customErr := req.BindJSON(r, &input); customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		if !strings.HasPrefix(input.FileKey, identity.Code+"/") {
+			resp.RespondError(w, r, errs.NewError(errs.ErrUnauthorized))
+			return
+		}
+
+		payload := &jwt.Payload{
+			ID:       identity.ID,
+			Code:     identity.Code,
+			FileKey:  input.FileKey,
+			UserType: identity.UserType,
+		}
+
+		tokenString, err := jwt.GenerateToken(payload, deps.Config.JWTSecret, jwt.AudienceDownload)
+		if err != nil {
+			resp.RespondError(w, r, errs.NewError(errs.ErrUnknown))
+			return
+		}
+
+		resp.RespondSuccess(w, r, map[string]any{
+			"token":     tokenString,
+			"expiresIn": int(jwt.DownloadExpiration.Seconds()),
+		})
+	}
+}
+
 func HandlePresignDownloadURL(deps *AppDeps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		identity := jwt.GetPayloadFromContext(r)
@@ -145,6 +281,12 @@ func HandlePresignDownloadURL(deps *AppDeps) http.HandlerFunc {
 			return
 		}
 
+		// a download token only grants the file it was issued for
+		if identity.Audience() == jwt.AudienceDownload && identity.FileKey != fileKey {
+			resp.RespondError(w, r, errs.NewError(errs.ErrUnauthorized))
+			return
+		}
+
 		room := deps.Manager.GetRoom(identity.Code)
 		if room == nil {
 			resp.RespondError(w, r, errs.NewError(errs.ErrRoomNotFound))
@@ -158,10 +300,40 @@ func HandlePresignDownloadURL(deps *AppDeps) http.HandlerFunc {
 			return
 		}
 
+		if err := deps.Manager.Verifier().CheckDownload(r.Context(), fileKey); err != nil {
+			resp.RespondError(w, r, err)
+			return
+		}
+
+		// each recipient of a view-once attachment gets a single, short-lived URL, claimed
+		// only once it is issued so that a storage failure does not use up the view
+		duration := chat.PresignedURLDuration
+		viewOnce, customErr := deps.Manager.ViewOnce().Check(fileKey, identity.ID)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+		if viewOnce {
+			duration = chat.ViewOnceURLDuration
+		}
+
+		fileName := r.URL.Query().Get("n")
+		downloads := room.Downloads()
+
+		// repeated requests reuse the URL issued moments ago instead of presigning a new one
+		if !viewOnce {
+			if url, ok := downloads.CachedURL(identity.ID, fileKey, fileName); ok {
+				downloads.Record(identity.ID, fileKey)
+				http.Redirect(w, r, url, http.StatusFound)
+				return
+			}
+		}
+
 		url, err := deps.PrivateStorage.PresignDownload(
 			r.Context(),
 			fileKey,
-			chat.PresignedURLDuration,
+			duration,
+			attachmentDownloadOptions(deps.Manager.Attachments(), fileKey, fileName),
 		)
 
 		if err != nil {
@@ -169,6 +341,72 @@ func HandlePresignDownloadURL(deps *AppDeps) http.HandlerFunc {
 			return
 		}
 
+		if viewOnce {
+			// a concurrent request of the user, or the expiry, may have won the race
+			if claimed, customErr := deps.Manager.ViewOnce().Claim(fileKey, identity.ID); !claimed || customErr != nil {
+				resp.RespondError(w, r, errs.NewError(errs.ErrViewOnceUnavailable))
+				return
+			}
+		} else {
+			downloads.CacheURL(identity.ID, fileKey, fileName, url)
+		}
+		downloads.Record(identity.ID, fileKey)
+
 		http.Redirect(w, r, url, http.StatusFound)
 	}
 }
+
+// HandleDownloadStats returns to the room host how many times, and by how many participants,
+// each file of the room was downloaded.
+func HandleDownloadStats(deps *AppDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, room, customErr := roomIdentity(deps, r)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		if !room.IsHost(identity.ID) {
+			resp.RespondError(w, r, errs.NewError(errs.ErrNotRoomHost))
+			return
+		}
+
+		resp.RespondSuccess(w, r, map[string]any{
+			"files": room.Downloads().Stats(),
+		})
+	}
+}
+
+// attachmentDownloadOptions forces the Content-Type of the attachment type owning the key's
+// extension, and a Content-Disposition under the given file name that makes browsers download
+// every type that is not displayed inline. Keys of unknown types are served as binary files.
+func attachmentDownloadOptions(policy chat.AttachmentPolicy, fileKey string, fileName string) storage.DownloadOptions {
+	mimeType, t, ok := policy.TypeOfKey(fileKey)
+	if !ok {
+		mimeType = "application/octet-stream"
+	}
+
+	if strings.HasPrefix(mimeType, "text/") {
+		mimeType += "; charset=utf-8"
+	}
+
+	disposition := "attachment"
+	if t.Inline {
+		disposition = "inline"
+	}
+
+	// the file name is client-supplied: keep only its base name, and only if the extension matches the key
+	fileName = path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	if fileName == "." || fileName == "/" || !strings.EqualFold(filepath.Ext(fileName), filepath.Ext(fileKey)) {
+		fileName = path.Base(fileKey)
+	}
+
+	if formatted := mime.FormatMediaType(disposition, map[string]string{"filename": fileName}); formatted != "" {
+		disposition = formatted
+	}
+
+	return storage.DownloadOptions{
+		ContentType:        mimeType,
+		ContentDisposition: disposition,
+	}
+}
@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"hzchat/internal/app/chat"
+	"hzchat/internal/app/storage"
+	"hzchat/internal/pkg/auth/jwt"
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/logx"
+	"hzchat/internal/pkg/randx"
+	"hzchat/internal/pkg/req"
+	"hzchat/internal/pkg/resp"
+
+	"github.com/google/uuid"
+)
+
+type InitiateMultipartInput struct {
+	FileName string `json:"fileName"`
+	MimeType string `json:"mimeType"`
+	FileSize int64  `json:"fileSize"`
+}
+
+// HandleInitiateMultipartUpload starts a multipart upload for an attachment. The total size is
+// limited by the caller's plan, and the file must be uploaded in parts of the plan's part size.
+func HandleInitiateMultipartUpload(deps *AppDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, room, customErr := roomIdentity(deps, r)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		var input InitiateMultipartInput
+		if customErr := req.BindJSON(r, &input); customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		rule, customErr := deps.Manager.Attachments().Resolve(input.FileName, input.MimeType, room.Type, identity.PlanType)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		if err := chat.ValidateFileSizeLimit(input.FileSize, rule.MaxSize); err != nil {
+			resp.RespondError(w, r, err)
+			return
+		}
+
+		fileExt := strings.ToLower(filepath.Ext(input.FileName))
+		fileID := uuid.New().String()
+		fileKey := fmt.Sprintf("%s/%s%s", identity.Code, fileID, fileExt)
+
+		quota, customErr := deps.Manager.Quotas().Reserve(
+			identity.Code,
+			identity.ID,
+			identity.PlanType,
+			fileKey,
+			input.FileSize,
+			chat.UploadSessionTTL,
+		)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		uploadID, err := deps.PrivateStorage.CreateMultipartUpload(r.Context(), fileKey, input.MimeType)
+		if err != nil {
+			deps.Manager.Quotas().Release(identity.Code, fileKey)
+			resp.RespondError(w, r, errs.NewError(errs.ErrFileStorageFailed))
+			return
+		}
+
+		partSize := deps.Config.UploadPlans.Plan(identity.PlanType).PartSize()
+		partCount := int32((input.FileSize + partSize - 1) / partSize)
+
+		deps.Manager.Uploads().Add(chat.UploadSession{
+			Key:       fileKey,
+			UploadID:  uploadID,
+			RoomCode:  identity.Code,
+			UserID:    identity.ID,
+			MimeType:  input.MimeType,
+			Size:      input.FileSize,
+			PartSize:  partSize,
+			PartCount: partCount,
+		})
+
+		resp.RespondSuccess(w, r, map[string]any{
+			"uploadId":  uploadID,
+			"fileKey":   fileKey,
+			"fileName":  input.FileName,
+			"partSize":  partSize,
+			"partCount": partCount,
+			"quota":     quota,
+		})
+	}
+}
+
+type PresignUploadPartInput struct {
+	FileKey    string `json:"fileKey"`
+	UploadID   string `json:"uploadId"`
+	PartNumber int32  `json:"partNumber"`
+}
+
+// HandlePresignUploadPart returns an upload URL for one part of a multipart upload.
+// Parts may be (re)requested in any order, e.g. to retry a part after a dropped connection.
+func HandlePresignUploadPart(deps *AppDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, _, customErr := roomIdentity(deps, r)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		var input PresignUploadPartInput
+		if customErr := req.BindJSON(r, &input); customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		session, ok := deps.Manager.Uploads().Get(input.UploadID, input.FileKey, identity.Code, identity.ID)
+		if !ok {
+			resp.RespondError(w, r, errs.NewError(errs.ErrUploadSessionInvalid))
+			return
+		}
+
+		if input.PartNumber < 1 || input.PartNumber > session.PartCount {
+			resp.RespondError(w, r, errs.NewError(errs.ErrInvalidParams))
+			return
+		}
+
+		partSize := session.PartLength(input.PartNumber)
+
+		url, err := deps.PrivateStorage.PresignUploadPart(
+			r.Context(),
+			session.Key,
+			session.UploadID,
+			input.PartNumber,
+			partSize,
+			chat.PresignedURLDuration,
+		)
+
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				deps.Manager.Uploads().Remove(session.UploadID)
+				resp.RespondError(w, r, errs.NewError(errs.ErrUploadSessionInvalid))
+				return
+			}
+			resp.RespondError(w, r, errs.NewError(errs.ErrFileStorageFailed))
+			return
+		}
+
+		resp.RespondSuccess(w, r, map[string]any{
+			"presignedUrl": url,
+			"partNumber":   input.PartNumber,
+			"partSize":     partSize,
+		})
+	}
+}
+
+type CompleteMultipartInput struct {
+	FileKey  string                  `json:"fileKey"`
+	UploadID string                  `json:"uploadId"`
+	Parts    []storage.CompletedPart `json:"parts"`
+}
+
+// HandleCompleteMultipartUpload assembles the uploaded parts into the attachment object.
+// Every part must be listed exactly once, in order, with the ETag returned by its upload.
+func HandleCompleteMultipartUpload(deps *AppDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, _, customErr := roomIdentity(deps, r)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		var input CompleteMultipartInput
+		if customErr := req.BindJSON(r, &input); customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		session, ok := deps.Manager.Uploads().Get(input.UploadID, input.FileKey, identity.Code, identity.ID)
+		if !ok {
+			resp.RespondError(w, r, errs.NewError(errs.ErrUploadSessionInvalid))
+			return
+		}
+
+		if int32(len(input.Parts)) != session.PartCount {
+			resp.RespondError(w, r, errs.NewError(errs.ErrUploadPartsInvalid))
+			return
+		}
+
+		for i, part := range input.Parts {
+			if part.PartNumber != int32(i+1) || part.ETag == "" {
+				resp.RespondError(w, r, errs.NewError(errs.ErrUploadPartsInvalid))
+				return
+			}
+		}
+
+		err := deps.PrivateStorage.CompleteMultipartUpload(r.Context(), session.Key, session.UploadID, input.Parts)
+		if err != nil {
+			switch {
+			case errors.Is(err, storage.ErrInvalidParts):
+				resp.RespondError(w, r, errs.NewError(errs.ErrUploadPartsInvalid))
+			case errors.Is(err, storage.ErrNotFound):
+				deps.Manager.Uploads().Remove(session.UploadID)
+				resp.RespondError(w, r, errs.NewError(errs.ErrUploadSessionInvalid))
+			default:
+				resp.RespondError(w, r, errs.NewError(errs.ErrFileStorageFailed))
+			}
+			return
+		}
+
+		deps.Manager.Uploads().Remove(session.UploadID)
+
+		resp.RespondSuccess(w, r, map[string]any{
+			"fileKey":  session.Key,
+			"fileSize": session.Size,
+		})
+	}
+}
+
+type AbortMultipartInput struct {
+	FileKey  string `json:"fileKey"`
+	UploadID string `json:"uploadId"`
+}
+
+// HandleAbortMultipartUpload discards a multipart upload and the parts uploaded so far.
+func HandleAbortMultipartUpload(deps *AppDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, _, customErr := roomIdentity(deps, r)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		var input AbortMultipartInput
+		if customErr := req.BindJSON(r, &input); customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		session, ok := deps.Manager.Uploads().Get(input.UploadID, input.FileKey, identity.Code, identity.ID)
+		if !ok {
+			resp.RespondError(w, r, errs.NewError(errs.ErrUploadSessionInvalid))
+			return
+		}
+
+		if err := deps.PrivateStorage.AbortMultipartUpload(r.Context(), session.Key, session.UploadID); err != nil {
+			logx.Error(err, "Failed to abort multipart upload", "file_key", session.Key)
+			resp.RespondError(w, r, errs.NewError(errs.ErrFileStorageFailed))
+			return
+		}
+
+		deps.Manager.Uploads().Remove(session.UploadID)
+		deps.Manager.Quotas().Release(session.RoomCode, session.Key)
+
+		resp.RespondSuccess(w, r, nil)
+	}
+}
+
+// roomIdentity returns the identity of a room access token and its room, which must still be active.
+func roomIdentity(deps *AppDeps, r *http.Request) (*jwt.Payload, *chat.Room, *errs.CustomError) {
+	identity := jwt.GetPayloadFromContext(r)
+
+	if identity == nil || !randx.IsValidRoomCode(identity.Code) {
+		return nil, nil, errs.NewError(errs.ErrUnauthorized)
+	}
+
+	room := deps.Manager.GetRoom(identity.Code)
+	if room == nil {
+		return nil, nil, errs.NewError(errs.ErrRoomNotFound)
+	}
+
+	return identity, room, nil
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 
 	"hzchat/internal/app/chat"
+	"hzchat/internal/configs"
 	"hzchat/internal/pkg/auth/jwt"
 	"hzchat/internal/pkg/errs"
 	"hzchat/internal/pkg/logx"
@@ -31,9 +33,9 @@ func HandleCreateRoom(deps *AppDeps) http.HandlerFunc {
 		var maxClients int
 
 		switch input.Type {
-		case "private":
+		case chat.RoomTypePrivate:
 			maxClients = chat.PrivateMaxClients
-		case "group":
+		case chat.RoomTypeGroup:
 			maxClients = chat.GroupMaxClients
 		}
 
@@ -48,7 +50,7 @@ func HandleCreateRoom(deps *AppDeps) http.HandlerFunc {
 			return
 		}
 
-		room, createErr := deps.Manager.CreateRoom(roomCode, maxClients)
+		room, createErr := deps.Manager.CreateRoom(roomCode, input.Type, maxClients)
 		if createErr != nil {
 			resp.RespondError(w, r, createErr)
 			return
@@ -86,6 +88,7 @@ func HandleJoinRoom(deps *AppDeps) http.HandlerFunc {
 		var userType string
 		var nickName string
 		var avatar string
+		var planType string
 
 		if identity != nil {
 			var userUUID pgtype.UUID
@@ -107,7 +110,8 @@ func HandleJoinRoom(deps *AppDeps) http.HandlerFunc {
 			finalID = identity.ID
 			userType = "registered"
 			nickName = dbUser.Nickname.String
-			avatar = deps.FullAssetURL(dbUser.AvatarUrl.String)
+			avatar = deps.UserAvatarURL(identity.ID, dbUser.AvatarUrl.String)
+			planType = dbUser.PlanType
 
 		} else {
 			if !randx.IsValidGuestID(input.GuestID) {
@@ -125,6 +129,8 @@ func HandleJoinRoom(deps *AppDeps) http.HandlerFunc {
 			finalID = input.GuestID
 			userType = "guest"
 			nickName = input.Nickname
+			avatar = deps.UserAvatarURL(finalID, "")
+			planType = configs.GuestPlan
 		}
 
 		if !randx.IsValidRoomCode(input.Code) {
@@ -150,9 +156,10 @@ func HandleJoinRoom(deps *AppDeps) http.HandlerFunc {
 			UserType: userType,
 			Nickname: nickName,
 			Avatar:   avatar,
+			PlanType: planType,
 		}
 
-		tokenString, err := jwt.GenerateToken(payload, deps.Config.JWTSecret, jwt.RoomAccessExpiration)
+		tokenString, err := jwt.GenerateToken(payload, deps.Config.JWTSecret, jwt.AudienceRoom)
 		if err != nil {
 			resp.RespondError(w, r, errs.NewError(errs.ErrUnknown))
 			return
@@ -163,3 +170,34 @@ func HandleJoinRoom(deps *AppDeps) http.HandlerFunc {
 		})
 	}
 }
+
+// HandleListRoomFiles returns a page of the files shared in the room of the access token,
+// newest first. The "cursor" query parameter requests the page after a previous one's
+// nextCursor, and "limit" sets the page size.
+func HandleListRoomFiles(deps *AppDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, room, customErr := roomIdentity(deps, r)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		limit := 0
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				resp.RespondError(w, r, errs.NewError(errs.ErrInvalidParams))
+				return
+			}
+			limit = n
+		}
+
+		page, customErr := room.Gallery().Page(r.URL.Query().Get("cursor"), limit)
+		if customErr != nil {
+			resp.RespondError(w, r, customErr)
+			return
+		}
+
+		resp.RespondSuccess(w, r, page)
+	}
+}
@@ -2,7 +2,7 @@
 Package handler provides the HTTP handlers and routing setup for the HZ Chat Server.
 
 This file defines the main Router, applying necessary middleware like logging, CORS,
-and IP-based rate limiting before delegating requests to specific handlers (API and WebSocket).
+and policy-based rate limiting before delegating requests to specific handlers (API and WebSocket).
 */
 package handler
 
@@ -13,27 +13,31 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gorilla/websocket"
 	"github.com/rs/cors"
-	"golang.org/x/time/rate"
 
+	"hzchat/internal/app/storage"
 	"hzchat/internal/pkg/auth/jwt"
 	"hzchat/internal/pkg/limiter"
 	"hzchat/internal/pkg/logx"
+	"hzchat/internal/pkg/req"
 	"hzchat/internal/pkg/resp"
 )
 
+// Names of the rate limit policies applied by the router.
 const (
-	CreateRate  = 0.05
-	CreateBurst = 2
-	JoinRate    = 0.2
-	JoinBurst   = 5
+	PolicyRoomCreate  = "room_create"
+	PolicyWSConnect   = "ws_connect"
+	PolicyAuth        = "auth"
+	PolicyFilePresign = "file_presign"
+
+	PolicyFileDownload       = "file_download"
+	PolicyFileDownloadObject = "file_download_object"
 )
 
 // Router sets up the main HTTP routing table (chi.Router) for the application.
-// It initializes IP-based rate limiters, configures CORS, and applies global and per-route middleware.
+// It configures CORS, and applies global and per-route middleware, including the named rate limit policies.
 // It requires the chat.Manager for business logic and the AppConfig for settings (like allowed origins).
 func Router(deps *AppDeps) http.Handler {
-	createLimiter := limiter.NewIPRateLimiter(rate.Limit(CreateRate), CreateBurst)
-	joinLimiter := limiter.NewIPRateLimiter(rate.Limit(JoinRate), JoinBurst)
+	rl := deps.RateLimiter
 
 	r := chi.NewRouter()
 
@@ -69,9 +73,9 @@ func Router(deps *AppDeps) http.Handler {
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:   corsAllowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		ExposedHeaders:   []string{},
+		ExposedHeaders:   []string{limiter.HeaderLimit, limiter.HeaderRemaining, limiter.HeaderReset, limiter.HeaderRetryAfter, "ETag"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
@@ -92,30 +96,94 @@ func Router(deps *AppDeps) http.Handler {
 		resp.RespondSuccess(w, r, data)
 	})
 
+	// every route declares the token audiences it accepts; other tokens are ignored
+	anonymous := jwt.AcceptAudiences()
+	identityToken := jwt.AcceptAudiences(jwt.AudienceIdentity)
+	roomToken := jwt.AcceptAudiences(jwt.AudienceRoom)
+	downloadToken := jwt.AcceptAudiences(jwt.AudienceRoom, jwt.AudienceDownload)
+
 	r.Route("/api", func(api chi.Router) {
 		api.Use(jwt.IdentityExtractorMiddleware(deps.Config.JWTSecret))
 
 		api.Route("/auth", func(auth chi.Router) {
-			auth.Post("/register", HandleRegister(deps))
-			auth.Post("/login", HandleLogin(deps))
-			auth.Post("/change-password", HandleChangePassword(deps))
+			auth.With(identityToken, rl.Middleware(PolicyAuth, rateLimitSubject)).Post("/register", HandleRegister(deps))
+			auth.With(identityToken, rl.Middleware(PolicyAuth, rateLimitSubject)).Post("/login", HandleLogin(deps))
+			auth.With(identityToken).Post("/change-password", HandleChangePassword(deps))
 		})
 
 		api.Route("/user", func(user chi.Router) {
+			user.Use(identityToken)
 			user.Get("/profile", HandleGetUserProfile(deps))
 			user.Post("/avatar/presign", HandlePresignAvatarURL(deps))
 			user.Post("/profile", HandleUpdateUserProfile(deps))
 		})
 
-		rateLimitedCreateHandler := createLimiter.Middleware(HandleCreateRoom(deps))
-		api.Post("/chat/create", http.HandlerFunc(rateLimitedCreateHandler.ServeHTTP))
-		api.Post("/chat/join", HandleJoinRoom(deps))
+		api.With(anonymous).Get("/avatar/default/{userID}", HandleDefaultAvatar())
+
+		api.With(anonymous, rl.Middleware(PolicyRoomCreate, rateLimitSubject)).Post("/chat/create", HandleCreateRoom(deps))
+		api.With(identityToken).Post("/chat/join", HandleJoinRoom(deps))
+		api.With(roomToken).Get("/chat/files", HandleListRoomFiles(deps))
+
+		api.With(roomToken, rl.Middleware(PolicyFilePresign, rateLimitSubject)).Post("/file/presign-upload", HandlePresignChatMessageURL(deps))
+		api.With(roomToken).Post("/file/download-token", HandleDownloadToken(deps))
+		api.With(
+			downloadToken,
+			rl.Middleware(PolicyFileDownload, rateLimitSubject),
+			rl.Middleware(PolicyFileDownloadObject, downloadSubject),
+		).Get("/file/presign-download", HandlePresignDownloadURL(deps))
+		api.With(roomToken).Get("/file/downloads", HandleDownloadStats(deps))
+
+		api.Route("/file/multipart", func(multipart chi.Router) {
+			multipart.Use(roomToken)
+			multipart.With(rl.Middleware(PolicyFilePresign, rateLimitSubject)).Post("/initiate", HandleInitiateMultipartUpload(deps))
+			multipart.Post("/presign-part", HandlePresignUploadPart(deps))
+			multipart.Post("/complete", HandleCompleteMultipartUpload(deps))
+			multipart.Post("/abort", HandleAbortMultipartUpload(deps))
+		})
 
-		api.Post("/file/presign-upload", HandlePresignChatMessageURL(deps))
-		api.Get("/file/presign-download", HandlePresignDownloadURL(deps))
+		if deps.Config.AdminToken != "" {
+			api.Route("/admin", func(admin chi.Router) {
+				admin.Use(anonymous, requireAdmin(deps.Config.AdminToken))
+				admin.Get("/gc/report", HandleGCReport(deps))
+			})
+		}
 	})
 
-	r.Get("/ws/{code}", HandleWebSocket(wsUpgrader, joinLimiter, deps))
+	r.Get("/ws/{code}", HandleWebSocket(wsUpgrader, deps))
+
+	// storage backends that serve their own signed URLs (e.g. the local filesystem driver)
+	for _, store := range []storage.StorageService{deps.PublicStorage, deps.PrivateStorage} {
+		if server, ok := store.(storage.HTTPServer); ok {
+			r.Mount(server.RoutePrefix(), server)
+		}
+	}
 
 	return r
 }
+
+// rateLimitSubject builds the rate limit subject from the resolved client IP,
+// the authenticated identity (if any) and the room code of the token or URL.
+func rateLimitSubject(r *http.Request) limiter.Subject {
+	subject := limiter.Subject{
+		IP:       req.ClientIP(r),
+		RoomCode: chi.URLParam(r, "code"),
+	}
+
+	if identity := jwt.GetPayloadFromContext(r); identity != nil {
+		subject.UserID = identity.ID
+		if identity.Code != "" {
+			subject.RoomCode = identity.Code
+		}
+	}
+
+	return subject
+}
+
+// downloadSubject extends the rate limit subject with the requested file key,
+// so that a single file cannot be hot-linked through the download endpoint.
+func downloadSubject(r *http.Request) limiter.Subject {
+	subject := rateLimitSubject(r)
+	subject.Object = r.URL.Query().Get("k")
+
+	return subject
+}
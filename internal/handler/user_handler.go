@@ -4,17 +4,23 @@ Package handler provides HTTP handler functions for user authentication and mana
 package handler
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	dbc "hzchat/internal/app/db/sqlc"
+	"hzchat/internal/app/user"
 	"hzchat/internal/pkg/auth/jwt"
 	"hzchat/internal/pkg/errs"
 	"hzchat/internal/pkg/logx"
+	"hzchat/internal/pkg/randx"
 	"hzchat/internal/pkg/req"
 	"hzchat/internal/pkg/resp"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -39,7 +45,7 @@ func HandleUpdateUserProfile(deps *AppDeps) http.HandlerFunc {
 
 		avatarKey, err := deps.NormalizeAssetKey(input.AvatarUrl)
 		if err != nil {
-			resp.RespondError(w, r, errs.NewError(errs.ErrInvalidParams))
+			resp.RespondError(w, r, errs.NewError(errs.ErrAvatarInvalid))
 			return
 		}
 
@@ -52,6 +58,27 @@ func HandleUpdateUserProfile(deps *AppDeps) http.HandlerFunc {
 			return
 		}
 
+		oldKey := oldUser.AvatarUrl.String
+
+		// a new avatar must be the user's own upload; it is replaced by its resized variants
+		if avatarKey != "" && avatarKey != oldKey {
+			if !user.IsAvatarUploadOf(avatarKey, identity.ID) {
+				resp.RespondError(w, r, errs.NewError(errs.ErrAvatarInvalid))
+				return
+			}
+
+			avatarKey, err = user.ProcessAvatar(r.Context(), deps.PublicStorage, avatarKey)
+			if err != nil {
+				if errors.Is(err, user.ErrInvalidAvatar) {
+					resp.RespondError(w, r, errs.NewError(errs.ErrAvatarInvalid))
+					return
+				}
+				logx.Error(err, "update_profile: avatar processing failed", "user_id", identity.ID)
+				resp.RespondError(w, r, errs.NewError(errs.ErrFileStorageFailed))
+				return
+			}
+		}
+
 		updatedUser, err := deps.DB.UpdateUserProfile(r.Context(), dbc.UpdateUserProfileParams{
 			ID:        userUUID,
 			Nickname:  pgtype.Text{String: input.Nickname, Valid: true},
@@ -62,13 +89,12 @@ func HandleUpdateUserProfile(deps *AppDeps) http.HandlerFunc {
 			return
 		}
 
-		oldKey := oldUser.AvatarUrl.String
 		if avatarKey != "" && oldKey != "" && oldKey != avatarKey {
-			go func(k string) {
+			go func(keys []string) {
 				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 				defer cancel()
-				_ = deps.PublicStorage.Delete(ctx, k)
-			}(oldKey)
+				_ = deps.PublicStorage.DeleteMany(ctx, keys)
+			}(user.AvatarKeys(oldKey))
 		}
 
 		lastLoginStr := ""
@@ -76,12 +102,13 @@ func HandleUpdateUserProfile(deps *AppDeps) http.HandlerFunc {
 			lastLoginStr = oldUser.LastLoginAt.Time.Format(time.RFC3339)
 		}
 
-		avatarURL := deps.FullAssetURL(updatedUser.AvatarUrl.String)
+		avatarURL := deps.UserAvatarURL(identity.ID, updatedUser.AvatarUrl.String)
 
 		userData := map[string]any{
 			"id":          identity.ID,
 			"nickname":    updatedUser.Nickname.String,
 			"avatar":      avatarURL,
+			"avatarSizes": deps.AvatarURLs(updatedUser.AvatarUrl.String),
 			"userType":    "registered",
 			"planType":    oldUser.PlanType,
 			"lastLoginAt": lastLoginStr,
@@ -98,7 +125,7 @@ func HandleUpdateUserProfile(deps *AppDeps) http.HandlerFunc {
 			Avatar:   avatarURL,
 		}
 
-		newToken, err := jwt.GenerateToken(newPayload, deps.Config.JWTSecret, jwt.UserIdentityExpiration)
+		newToken, err := jwt.GenerateToken(newPayload, deps.Config.JWTSecret, jwt.AudienceIdentity)
 		if err != nil {
 			logx.Error(err, "update_profile: token generation failed, fallback to old token")
 		} else {
@@ -108,3 +135,25 @@ func HandleUpdateUserProfile(deps *AppDeps) http.HandlerFunc {
 		resp.RespondSuccess(w, r, finalResponse)
 	}
 }
+
+// HandleDefaultAvatar serves the generated default avatar of a registered user or guest.
+// The image only depends on the ID, so clients and proxies may cache it and revalidate by ETag.
+func HandleDefaultAvatar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := chi.URLParam(r, "userID")
+
+		if _, err := uuid.Parse(userID); err != nil && !randx.IsValidGuestID(userID) {
+			resp.RespondError(w, r, errs.NewError(errs.ErrInvalidParams))
+			return
+		}
+
+		svg, etag := user.Identicon(userID)
+
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Header().Set("ETag", etag)
+
+		// ServeContent answers If-None-Match with 304 Not Modified
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(svg))
+	}
+}
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"net"
 	"net/http"
 	"time"
 
@@ -15,21 +14,18 @@ import (
 	"hzchat/internal/pkg/limiter"
 	"hzchat/internal/pkg/logx"
 	"hzchat/internal/pkg/randx"
+	"hzchat/internal/pkg/req"
 	"hzchat/internal/pkg/resp"
 )
 
-func HandleWebSocket(upgrader websocket.Upgrader, rateLimiter *limiter.IPRateLimiter, deps *AppDeps) http.HandlerFunc {
+func HandleWebSocket(upgrader websocket.Upgrader, deps *AppDeps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			ip = r.RemoteAddr
-		}
+		ip := req.ClientIP(r)
 
-		if ip == "" {
-			ip = "unknown_ip"
-		}
+		decision := deps.RateLimiter.Allow(r.Context(), PolicyWSConnect, limiter.Subject{IP: ip})
+		limiter.WriteHeaders(w, decision)
 
-		if !rateLimiter.GetLimiter(ip).Allow() {
+		if !decision.Allowed {
 			logx.Warn("WebSocket connection rejected: Rate limit exceeded.", "ip", ip)
 			resp.RespondError(w, r, errs.NewError(errs.ErrRateLimitExceeded))
 			return
@@ -42,7 +38,7 @@ func HandleWebSocket(upgrader websocket.Upgrader, rateLimiter *limiter.IPRateLim
 		}
 
 		tokenString := r.URL.Query().Get("token")
-		payload, err := jwt.ParseToken(tokenString, deps.Config.JWTSecret)
+		payload, err := jwt.ParseToken(tokenString, deps.Config.JWTSecret, jwt.AudienceRoom)
 
 		if err != nil || payload.Code != roomCode {
 			logx.Warn("WS connection rejected: Invalid or mismatched token", "room", roomCode)
@@ -63,6 +59,7 @@ func HandleWebSocket(upgrader websocket.Upgrader, rateLimiter *limiter.IPRateLim
 			Nickname: payload.Nickname,
 			Avatar:   payload.Avatar,
 			UserType: payload.UserType,
+			PlanType: payload.PlanType,
 		}
 
 		if currentUser.ID == "" || currentUser.Nickname == "" {
@@ -85,13 +82,21 @@ func HandleWebSocket(upgrader websocket.Upgrader, rateLimiter *limiter.IPRateLim
 			return
 		}
 
+		lease, capErr := deps.Manager.AcquireConnection(ip, currentUser.ID)
+		if capErr != nil {
+			logx.Warn("WebSocket connection rejected: Connection cap reached.", "client_id", currentUser.ID)
+			resp.RespondError(w, r, capErr)
+			return
+		}
+
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
+			lease.Release()
 			logx.Error(err, "Failed to upgrade connection to WebSocket")
 			return
 		}
 
-		client := chat.NewClient(room, conn, currentUser, tokenExpiry)
+		client := chat.NewClient(room, conn, currentUser, tokenExpiry, lease)
 
 		go client.WritePump()
 
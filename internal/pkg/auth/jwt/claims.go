@@ -1,6 +1,10 @@
 package jwt
 
-import "github.com/golang-jwt/jwt"
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt"
+)
 
 type Payload struct {
 	jwt.StandardClaims `json:"standard_claims"`
@@ -9,15 +13,49 @@ type Payload struct {
 	// Guest ID or a registered User ID, depending on the UserType.
 	ID string `json:"id"`
 
-	// Code optionally specifies the chat room the token holder is authorized to access.
-	// When present, it elevates the token from a general identity credential to a
-	// room-specific access token. It is omitted in long-term identity tokens.
+	// Code specifies the chat room the token holder is authorized to access.
+	// It is set in room access and download tokens, and omitted in long-term identity tokens.
 	Code string `json:"code,omitempty"`
 
+	// FileKey is the only file a download token grants access to. It is omitted in other tokens.
+	FileKey string `json:"fileKey,omitempty"`
+
 	// UserType defines the role of the participant, allowing the server to apply
 	// different logic and permissions (e.g., "guest", "registered", or "subscriber").
 	UserType string `json:"userType"`
 
 	Nickname string `json:"nickname,omitempty"`
 	Avatar   string `json:"avatar,omitempty"`
+
+	// PlanType is the service plan of the participant (e.g., "GUEST", "FREE", "PRO"),
+	// which determines their upload limits. It is only set in room access tokens.
+	PlanType string `json:"planType,omitempty"`
+}
+
+// Audience returns the audience the token was issued for.
+func (p *Payload) Audience() Audience {
+	return Audience(p.StandardClaims.Audience)
+}
+
+// validate checks that the payload carries exactly the claims of its audience.
+func (p *Payload) validate() error {
+	if p.ID == "" {
+		return errors.New("token has no subject ID")
+	}
+
+	var ok bool
+	switch p.Audience() {
+	case AudienceIdentity:
+		ok = p.Code == "" && p.FileKey == ""
+	case AudienceRoom:
+		ok = p.Code != "" && p.FileKey == ""
+	case AudienceDownload:
+		ok = p.Code != "" && p.FileKey != ""
+	}
+
+	if !ok {
+		return errors.New("token claims do not match its audience")
+	}
+
+	return nil
 }
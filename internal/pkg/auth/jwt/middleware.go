@@ -3,6 +3,7 @@ package jwt
 import (
 	"context"
 	"net/http"
+	"slices"
 	"strings"
 )
 
@@ -15,6 +16,8 @@ const (
 )
 
 // IdentityExtractorMiddleware is an HTTP middleware that extracts and validates a JWT from the request.
+// Identity and room access tokens are read from the Authorization header; download tokens, which are
+// meant to be embedded in links, are read from the "t" query parameter and only from there.
 // If a valid token is found, the corresponding Payload is injected into the request Context.
 // If no token is found or if the token is invalid, the request proceeds as anonymous (no Payload in Context).
 func IdentityExtractorMiddleware(secretKey string) func(next http.Handler) http.Handler {
@@ -23,19 +26,16 @@ func IdentityExtractorMiddleware(secretKey string) func(next http.Handler) http.
 			authHeader := r.Header.Get("Authorization")
 
 			var tokenString string
+			var audiences []Audience
 
 			if authHeader == "" {
-				if r.URL.Path != "/api/file/presign-download" {
-					next.ServeHTTP(w, r)
-					return
-				}
-
 				token := r.URL.Query().Get("t")
 				if token == "" {
 					next.ServeHTTP(w, r)
 					return
 				}
 				tokenString = token
+				audiences = []Audience{AudienceDownload}
 
 			} else {
 				parts := strings.SplitN(authHeader, " ", 2)
@@ -44,9 +44,10 @@ func IdentityExtractorMiddleware(secretKey string) func(next http.Handler) http.
 					return
 				}
 				tokenString = parts[1]
+				audiences = []Audience{AudienceIdentity, AudienceRoom}
 			}
 
-			payload, err := ParseToken(tokenString, secretKey)
+			payload, err := ParseToken(tokenString, secretKey, audiences...)
 
 			if err != nil {
 				next.ServeHTTP(w, r)
@@ -60,6 +61,21 @@ func IdentityExtractorMiddleware(secretKey string) func(next http.Handler) http.
 	}
 }
 
+// AcceptAudiences is an HTTP middleware declaring the token audiences a route accepts.
+// Tokens of other audiences are dropped from the request Context, so the handler treats
+// the request as anonymous. Without audiences, the route accepts no token at all.
+func AcceptAudiences(audiences ...Audience) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if payload := GetPayloadFromContext(r); payload != nil && !slices.Contains(audiences, payload.Audience()) {
+				r = r.WithContext(context.WithValue(r.Context(), ContextAuthPayloadKey, nil))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetPayloadFromContext safely extracts the authenticated Payload from the request Context.
 func GetPayloadFromContext(r *http.Request) *Payload {
 	payload, ok := r.Context().Value(ContextAuthPayloadKey).(*Payload)
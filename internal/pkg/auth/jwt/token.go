@@ -2,11 +2,28 @@ package jwt
 
 import (
 	"errors"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
+// Audience identifies the purpose of a token. Every token is issued for a single audience,
+// and every handler declares the audiences it accepts.
+type Audience string
+
+const (
+	// AudienceIdentity marks long-term identity tokens of registered users.
+	AudienceIdentity Audience = "identity"
+
+	// AudienceRoom marks room access tokens, which carry the room code.
+	AudienceRoom Audience = "room"
+
+	// AudienceDownload marks download tokens, which only grant the download of a single file
+	// of a room and may therefore be passed in URLs.
+	AudienceDownload Audience = "download"
+)
+
 const (
 	// RoomAccessExpiration defines the duration for room-specific access tokens (short-term).
 	RoomAccessExpiration = 15 * time.Minute
@@ -14,27 +31,52 @@ const (
 	// UserIdentityExpiration defines the duration for general user identity tokens (long-term).
 	UserIdentityExpiration = 24 * time.Hour
 
+	// DownloadExpiration defines the duration for single-file download tokens.
+	DownloadExpiration = 10 * time.Minute
+
 	// TokenIssuer identifies the issuer of the token.
 	TokenIssuer = "HZChat-Server"
 )
 
-// GenerateToken creates and signs a new JWT Token string based on the provided Payload struct.
-func GenerateToken(payload *Payload, secretKey string, duration time.Duration) (string, error) {
+// ErrAudienceMismatch is returned by ParseToken for tokens issued for another audience.
+var ErrAudienceMismatch = errors.New("token audience not accepted")
+
+// Expiration returns the lifetime of tokens issued for the audience.
+func (a Audience) Expiration() time.Duration {
+	switch a {
+	case AudienceIdentity:
+		return UserIdentityExpiration
+	case AudienceDownload:
+		return DownloadExpiration
+	default:
+		return RoomAccessExpiration
+	}
+}
+
+// GenerateToken creates and signs a new JWT Token string based on the provided Payload struct,
+// for the given audience and with the audience's lifetime.
+func GenerateToken(payload *Payload, secretKey string, audience Audience) (string, error) {
 	now := time.Now()
 
 	payload.StandardClaims = jwt.StandardClaims{
-		ExpiresAt: now.Add(duration).Unix(),
+		Audience:  string(audience),
+		ExpiresAt: now.Add(audience.Expiration()).Unix(),
 		IssuedAt:  now.Unix(),
 		Issuer:    TokenIssuer,
 	}
 
+	if err := payload.validate(); err != nil {
+		return "", err
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
 
 	return token.SignedString([]byte(secretKey))
 }
 
 // ParseToken parses and validates the JWT Token string using the provided secretKey.
-func ParseToken(tokenString string, secretKey string) (*Payload, error) {
+// The token must have been issued for one of the given audiences.
+func ParseToken(tokenString string, secretKey string, audiences ...Audience) (*Payload, error) {
 	claims := &Payload{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -52,5 +94,21 @@ func ParseToken(tokenString string, secretKey string) (*Payload, error) {
 		return nil, errors.New("invalid or expired token")
 	}
 
+	// tokens issued before audiences were introduced are identity or room access tokens
+	if claims.StandardClaims.Audience == "" {
+		claims.StandardClaims.Audience = string(AudienceIdentity)
+		if claims.Code != "" {
+			claims.StandardClaims.Audience = string(AudienceRoom)
+		}
+	}
+
+	if !slices.Contains(audiences, claims.Audience()) {
+		return nil, ErrAudienceMismatch
+	}
+
+	if err := claims.validate(); err != nil {
+		return nil, err
+	}
+
 	return claims, nil
 }
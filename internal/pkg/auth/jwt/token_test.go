@@ -0,0 +1,204 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const testSecret = "test-secret"
+
+// sign signs the payload as is, without the claims GenerateToken sets, like tokens issued
+// before audiences were introduced.
+func sign(t *testing.T, payload *Payload, method jwt.SigningMethod, key any) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, payload).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestParseToken(t *testing.T) {
+	live := jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix(), Issuer: TokenIssuer}
+	expired := jwt.StandardClaims{ExpiresAt: time.Now().Add(-time.Minute).Unix(), Issuer: TokenIssuer}
+	withAudience := func(audience Audience) jwt.StandardClaims {
+		claims := live
+		claims.Audience = string(audience)
+		return claims
+	}
+
+	tests := []struct {
+		name      string
+		payload   Payload
+		method    jwt.SigningMethod
+		key       any
+		audiences []Audience
+		want      Audience
+		mismatch  bool
+		wantErr   bool
+	}{
+		{
+			name:      "legacy identity token",
+			payload:   Payload{StandardClaims: live, ID: "u1"},
+			audiences: []Audience{AudienceIdentity},
+			want:      AudienceIdentity,
+		},
+		{
+			name:      "legacy identity token for a room",
+			payload:   Payload{StandardClaims: live, ID: "u1"},
+			audiences: []Audience{AudienceRoom},
+			mismatch:  true,
+		},
+		{
+			name:      "legacy room token",
+			payload:   Payload{StandardClaims: live, ID: "u1", Code: "ABC123"},
+			audiences: []Audience{AudienceRoom},
+			want:      AudienceRoom,
+		},
+		{
+			name:      "legacy room token as identity",
+			payload:   Payload{StandardClaims: live, ID: "u1", Code: "ABC123"},
+			audiences: []Audience{AudienceIdentity},
+			mismatch:  true,
+		},
+		{
+			name:      "legacy room token for a download",
+			payload:   Payload{StandardClaims: live, ID: "u1", Code: "ABC123", FileKey: "ABC123/a.txt"},
+			audiences: []Audience{AudienceRoom, AudienceDownload},
+			wantErr:   true,
+		},
+		{
+			name:      "legacy token with a file key only",
+			payload:   Payload{StandardClaims: live, ID: "u1", FileKey: "ABC123/a.txt"},
+			audiences: []Audience{AudienceIdentity},
+			wantErr:   true,
+		},
+		{
+			name:      "expired legacy token",
+			payload:   Payload{StandardClaims: expired, ID: "u1"},
+			audiences: []Audience{AudienceIdentity},
+			wantErr:   true,
+		},
+		{
+			name:      "download token",
+			payload:   Payload{StandardClaims: withAudience(AudienceDownload), ID: "u1", Code: "ABC123", FileKey: "ABC123/a.txt"},
+			audiences: []Audience{AudienceDownload},
+			want:      AudienceDownload,
+		},
+		{
+			name:      "download token as room token",
+			payload:   Payload{StandardClaims: withAudience(AudienceDownload), ID: "u1", Code: "ABC123", FileKey: "ABC123/a.txt"},
+			audiences: []Audience{AudienceRoom},
+			mismatch:  true,
+		},
+		{
+			name:      "room token among several audiences",
+			payload:   Payload{StandardClaims: withAudience(AudienceRoom), ID: "u1", Code: "ABC123"},
+			audiences: []Audience{AudienceIdentity, AudienceRoom},
+			want:      AudienceRoom,
+		},
+		{
+			name:      "unknown audience",
+			payload:   Payload{StandardClaims: withAudience("admin"), ID: "u1"},
+			audiences: []Audience{AudienceIdentity},
+			mismatch:  true,
+		},
+		{
+			name:      "no subject",
+			payload:   Payload{StandardClaims: withAudience(AudienceIdentity)},
+			audiences: []Audience{AudienceIdentity},
+			wantErr:   true,
+		},
+		{
+			name:      "other secret",
+			payload:   Payload{StandardClaims: live, ID: "u1"},
+			key:       []byte("other-secret"),
+			audiences: []Audience{AudienceIdentity},
+			wantErr:   true,
+		},
+		{
+			name:      "unsigned",
+			payload:   Payload{StandardClaims: live, ID: "u1"},
+			method:    jwt.SigningMethodNone,
+			key:       jwt.UnsafeAllowNoneSignatureType,
+			audiences: []Audience{AudienceIdentity},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, key := tt.method, tt.key
+			if method == nil {
+				method = jwt.SigningMethodHS256
+			}
+			if key == nil {
+				key = []byte(testSecret)
+			}
+
+			payload := tt.payload
+			claims, err := ParseToken(sign(t, &payload, method, key), testSecret, tt.audiences...)
+
+			switch {
+			case tt.mismatch:
+				if !errors.Is(err, ErrAudienceMismatch) {
+					t.Fatalf("got %v, %v, want ErrAudienceMismatch", claims, err)
+				}
+			case tt.wantErr:
+				if err == nil {
+					t.Fatalf("got %+v, want an error", claims)
+				}
+			case err != nil:
+				t.Fatalf("got error %v", err)
+			case claims.Audience() != tt.want || claims.ID != "u1":
+				t.Fatalf("got audience %q for %q, want %q", claims.Audience(), claims.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  Payload
+		audience Audience
+		wantErr  bool
+	}{
+		{name: "identity", payload: Payload{ID: "u1"}, audience: AudienceIdentity},
+		{name: "room", payload: Payload{ID: "u1", Code: "ABC123"}, audience: AudienceRoom},
+		{name: "download", payload: Payload{ID: "u1", Code: "ABC123", FileKey: "ABC123/a.txt"}, audience: AudienceDownload},
+		{name: "identity with a room", payload: Payload{ID: "u1", Code: "ABC123"}, audience: AudienceIdentity, wantErr: true},
+		{name: "room without code", payload: Payload{ID: "u1"}, audience: AudienceRoom, wantErr: true},
+		{name: "download without file", payload: Payload{ID: "u1", Code: "ABC123"}, audience: AudienceDownload, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := tt.payload
+			token, err := GenerateToken(&payload, testSecret, tt.audience)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("token was issued")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+
+			claims, err := ParseToken(token, testSecret, tt.audience)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			lifetime := time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second
+			if claims.Issuer != TokenIssuer || lifetime != tt.audience.Expiration() {
+				t.Fatalf("got issuer %q and lifetime %v", claims.Issuer, lifetime)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package cdnsign
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCannedPolicy(t *testing.T) {
+	// the canned policy example of the CloudFront developer guide
+	want := `{"Statement":[{"Resource":"http://d111111abcdef8.cloudfront.net/horizon.jpg?size=large&license=yes",` +
+		`"Condition":{"DateLessThan":{"AWS:EpochTime":1357034400}}}]}`
+
+	if got := CannedPolicy("http://d111111abcdef8.cloudfront.net/horizon.jpg?size=large&license=yes", 1357034400); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestEncodeSignature(t *testing.T) {
+	tests := []struct {
+		signature []byte
+		want      string
+	}{
+		{signature: []byte{0xfb, 0xff}, want: "-~8_"},
+		{signature: []byte{0xf8}, want: "-A__"},
+		{signature: []byte("abc"), want: "YWJj"},
+		{signature: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := EncodeSignature(tt.signature); got != tt.want {
+			t.Fatalf("%x: got %q, want %q", tt.signature, got, tt.want)
+		}
+	}
+}
+
+// decodeSignature reverses EncodeSignature.
+func decodeSignature(t *testing.T, encoded string) []byte {
+	t.Helper()
+
+	raw := strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(encoded)
+	signature, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		t.Fatalf("decode signature %q: %v", encoded, err)
+	}
+	return signature
+}
+
+// signed splits a signed URL into the original URL, its canned policy and its query parameters.
+func signed(t *testing.T, signedURL string) (string, string, url.Values) {
+	t.Helper()
+
+	i := strings.LastIndex(signedURL, "Expires=")
+	if i < 1 {
+		t.Fatalf("unsigned URL %q", signedURL)
+	}
+	query, err := url.ParseQuery(signedURL[i:])
+	if err != nil {
+		t.Fatalf("parse query: %v", err)
+	}
+	expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("parse expiry: %v", err)
+	}
+
+	rawURL := signedURL[:i-1]
+	return rawURL, CannedPolicy(rawURL, expires), query
+}
+
+func TestSignHMAC(t *testing.T) {
+	signer, err := New(Config{
+		Mode:  ModeHMAC,
+		Keys:  []Key{{ID: "old", Secret: "old-secret"}, {ID: "new", Secret: "new-secret"}},
+		KeyID: "new",
+		TTL:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("new signer: %v", err)
+	}
+
+	for _, rawURL := range []string{"https://cdn.example.test/avatars/u1.webp", "https://cdn.example.test/a.webp?size=64"} {
+		signedURL, err := signer.Sign(rawURL)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+
+		gotURL, policy, query := signed(t, signedURL)
+		if gotURL != rawURL || query.Get("Key-Pair-Id") != "new" {
+			t.Fatalf("signed %q as %q", rawURL, signedURL)
+		}
+
+		mac := hmac.New(sha256.New, []byte("new-secret"))
+		mac.Write([]byte(policy))
+		if !hmac.Equal(decodeSignature(t, query.Get("Signature")), mac.Sum(nil)) {
+			t.Fatalf("signature of %q does not match its policy", signedURL)
+		}
+
+		expires, _ := strconv.ParseInt(query.Get("Expires"), 10, 64)
+		if until := time.Until(time.Unix(expires, 0)); until < time.Hour-time.Second || until > time.Hour+15*time.Minute {
+			t.Fatalf("expiry in %v, want between the TTL and a quarter more", until)
+		}
+
+		// URLs signed within the same window are identical
+		if again, _ := signer.Sign(rawURL); again != signedURL {
+			t.Fatalf("got %q, then %q", signedURL, again)
+		}
+	}
+}
+
+func TestSignRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	keys := map[string][]byte{
+		"pkcs1.pem": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		"pkcs8.pem": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+	}
+
+	for name, data := range keys {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("write key: %v", err)
+		}
+
+		signer, err := New(Config{Mode: ModeRSA, Keys: []Key{{ID: "K2JCJMDEHXQW5F", Secret: path}}, TTL: time.Hour})
+		if err != nil {
+			t.Fatalf("%s: new signer: %v", name, err)
+		}
+
+		signedURL, err := signer.Sign("https://cdn.example.test/avatars/u1.webp")
+		if err != nil {
+			t.Fatalf("%s: sign: %v", name, err)
+		}
+
+		_, policy, query := signed(t, signedURL)
+		digest := sha1.Sum([]byte(policy))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], decodeSignature(t, query.Get("Signature"))); err != nil {
+			t.Fatalf("%s: signature does not verify: %v", name, err)
+		}
+		if query.Get("Key-Pair-Id") != "K2JCJMDEHXQW5F" {
+			t.Fatalf("%s: got key pair ID %q", name, query.Get("Key-Pair-Id"))
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	keys := []Key{{ID: "k1", Secret: "secret"}}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "unset mode", cfg: Config{}, wantNil: true},
+		{name: "none", cfg: Config{Mode: ModeNone}, wantNil: true},
+		{name: "hmac", cfg: Config{Mode: ModeHMAC, Keys: keys, TTL: time.Hour}},
+		{name: "zero ttl", cfg: Config{Mode: ModeHMAC, Keys: keys}, wantErr: true},
+		{name: "no keys", cfg: Config{Mode: ModeHMAC, TTL: time.Hour}, wantErr: true},
+		{name: "unknown key", cfg: Config{Mode: ModeHMAC, Keys: keys, KeyID: "k2", TTL: time.Hour}, wantErr: true},
+		{name: "unknown mode", cfg: Config{Mode: "md5", Keys: keys, TTL: time.Hour}, wantErr: true},
+		{name: "missing rsa key", cfg: Config{Mode: ModeRSA, Keys: []Key{{ID: "k1", Secret: "/nonexistent.pem"}}, TTL: time.Hour}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		signer, err := New(tt.cfg)
+		if (err != nil) != tt.wantErr || (signer == nil) != (tt.wantNil || tt.wantErr) {
+			t.Fatalf("%s: got %v, %v", tt.name, signer, err)
+		}
+	}
+
+	var none *Signer
+	if got, err := none.Sign("https://cdn.example.test/a.webp"); err != nil || got != "https://cdn.example.test/a.webp" {
+		t.Fatalf("nil signer: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Package clamd implements a minimal client for the ClamAV daemon (clamd).
+
+Only the INSTREAM command is supported: content is streamed to the daemon in length-prefixed
+chunks, so the scanned data never has to exist on a filesystem clamd can read.
+*/
+package clamd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// chunkSize is the size of each chunk streamed to the daemon.
+	chunkSize = 1 << 20
+
+	// defaultTimeout bounds a whole scan when the context has no earlier deadline.
+	defaultTimeout = 2 * time.Minute
+)
+
+// ErrScanFailed is returned when the daemon answers with an error, e.g. when the stream
+// exceeds its StreamMaxLength.
+var ErrScanFailed = errors.New("clamd scan failed")
+
+// Client scans content with a clamd daemon listening on a TCP or Unix socket.
+type Client struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// New creates a client for the daemon at the given address, either tcp://host:port or
+// unix:///path/to/clamd.sock. A zero timeout selects the default.
+func New(address string, timeout time.Duration) (*Client, error) {
+	network, addr, ok := strings.Cut(address, "://")
+	if !ok || addr == "" || (network != "tcp" && network != "unix") {
+		return nil, fmt.Errorf("invalid clamd address %q: expected tcp://host:port or unix:///path", address)
+	}
+
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Client{network: network, address: addr, timeout: timeout}, nil
+}
+
+// Scan streams the content of r to the daemon and returns the name of the detected signature,
+// or an empty string if the content is clean.
+func (c *Client) Scan(ctx context.Context, r io.Reader) (string, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	// the daemon closes the connection after replying to an oversized stream,
+	// so a failed write is reported through the reply when one can be read
+	writeErr := c.stream(conn, r)
+
+	var srcErr *sourceError
+	if errors.As(writeErr, &srcErr) {
+		return "", srcErr.err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		if writeErr != nil {
+			return "", fmt.Errorf("failed to stream to clamd: %w", writeErr)
+		}
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+
+	return parseReply(reply)
+}
+
+// stream sends the INSTREAM command followed by the content in length-prefixed chunks
+// and the terminating zero-length chunk.
+func (c *Client) stream(w io.Writer, r io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return &sourceError{err: err}
+		}
+	}
+
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// sourceError wraps a failure to read the scanned content, as opposed to a failed write to the daemon.
+type sourceError struct {
+	err error
+}
+
+func (e *sourceError) Error() string {
+	return e.err.Error()
+}
+
+// parseReply interprets a reply such as "stream: OK", "stream: Eicar-Signature FOUND"
+// or "INSTREAM size limit exceeded. ERROR".
+func parseReply(reply string) (string, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrScanFailed, reply)
+	}
+}
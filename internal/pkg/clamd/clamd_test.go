@@ -0,0 +1,173 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		want      string
+		wantError bool
+	}{
+		{reply: "stream: OK\x00", want: ""},
+		{reply: "stream: OK\n", want: ""},
+		{reply: "OK", want: ""},
+		{reply: "stream: Eicar-Signature FOUND\x00", want: "Eicar-Signature"},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND", want: "Win.Test.EICAR_HDB-1"},
+		{reply: "INSTREAM size limit exceeded. ERROR\x00", wantError: true},
+		{reply: "stream: FOUND", wantError: true},
+		{reply: "stream: OKAY", wantError: true},
+		{reply: "\x00", wantError: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseReply(tt.reply)
+		if tt.wantError {
+			if !errors.Is(err, ErrScanFailed) {
+				t.Fatalf("%q: got %q, %v, want ErrScanFailed", tt.reply, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("%q: got %q, %v, want %q", tt.reply, got, err, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{address: "tcp://clamav:3310", valid: true},
+		{address: "unix:///run/clamav/clamd.sock", valid: true},
+		{address: "clamav:3310"},
+		{address: "tcp://"},
+		{address: "http://clamav:3310"},
+		{address: ""},
+	}
+
+	for _, tt := range tests {
+		if _, err := New(tt.address, 0); (err == nil) != tt.valid {
+			t.Fatalf("%q: got %v, want valid %v", tt.address, err, tt.valid)
+		}
+	}
+}
+
+// serveOnce accepts one connection, reads an INSTREAM command and its chunks, and answers with
+// the reply chosen for the received content.
+func serveOnce(t *testing.T, reply func(content []byte) string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+			return
+		}
+
+		var content bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := io.CopyN(&content, r, int64(size)); err != nil {
+				return
+			}
+		}
+
+		io.WriteString(conn, reply(content.Bytes()))
+	}()
+
+	return "tcp://" + ln.Addr().String()
+}
+
+func TestScan(t *testing.T) {
+	eicar := []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+	tests := []struct {
+		name      string
+		content   []byte
+		want      string
+		wantError bool
+	}{
+		{name: "clean", content: []byte("hello"), want: ""},
+		{name: "empty", content: nil, want: ""},
+		{name: "several chunks", content: bytes.Repeat([]byte("a"), 2*chunkSize+10), want: ""},
+		{name: "infected", content: eicar, want: "Eicar-Signature"},
+		{name: "too large", content: bytes.Repeat([]byte("b"), 3*chunkSize), wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := serveOnce(t, func(content []byte) string {
+				switch {
+				case !bytes.Equal(content, tt.content):
+					return "stream: content mismatch ERROR\x00"
+				case len(content) > 2*chunkSize+10:
+					return "INSTREAM size limit exceeded. ERROR\x00"
+				case bytes.Contains(content, []byte("EICAR")):
+					return "stream: Eicar-Signature FOUND\x00"
+				}
+				return "stream: OK\x00"
+			})
+
+			client, err := New(address, 5*time.Second)
+			if err != nil {
+				t.Fatalf("new client: %v", err)
+			}
+
+			got, err := client.Scan(context.Background(), bytes.NewReader(tt.content))
+			if tt.wantError {
+				if !errors.Is(err, ErrScanFailed) {
+					t.Fatalf("got %q, %v, want ErrScanFailed", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanReportsSourceErrors(t *testing.T) {
+	errSource := errors.New("source failed")
+	address := serveOnce(t, func([]byte) string { return "stream: OK\x00" })
+
+	client, err := New(address, 5*time.Second)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	broken := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errSource))
+	if _, err := client.Scan(context.Background(), broken); !errors.Is(err, errSource) {
+		t.Fatalf("got %v, want the source error", err)
+	}
+}
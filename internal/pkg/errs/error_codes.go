@@ -44,6 +44,12 @@ const (
 	// ErrRoomIsFull indicates that the room being joined has reached its maximum user capacity.
 	ErrRoomIsFull = 2104
 
+	// ErrRoomBusy indicates that the room cannot accept more messages right now (its broadcast queue is full).
+	ErrRoomBusy = 2105
+
+	// ErrNotRoomHost indicates that the operation is restricted to the room host.
+	ErrNotRoomHost = 2106
+
 	// ErrMessageContentTooLong indicates that the user's message content exceeded the maximum length limit.
 	ErrMessageContentTooLong = 2201
 
@@ -55,6 +61,48 @@ const (
 
 	// ErrAttachmentKeyInvalid indicates that an attachment key does not belong to the expected room or user.
 	ErrAttachmentKeyInvalid = 2204
+
+	// ErrMessageRateLimited indicates that the client is sending messages faster than the room allows.
+	ErrMessageRateLimited = 2205
+
+	// ErrUserMuted indicates that the client has been temporarily muted for sustained flooding.
+	ErrUserMuted = 2206
+
+	// ErrSlowModeActive indicates that the client must wait for the room's slow mode cooldown before posting again.
+	ErrSlowModeActive = 2207
+
+	// ErrAttachmentNotFound indicates that the referenced attachment has not been uploaded.
+	ErrAttachmentNotFound = 2208
+
+	// ErrAttachmentMismatch indicates that the uploaded object does not match the declared size or type.
+	ErrAttachmentMismatch = 2209
+
+	// ErrAttachmentContentInvalid indicates that the uploaded file's content does not match its declared type.
+	ErrAttachmentContentInvalid = 2210
+
+	// ErrUploadSessionInvalid indicates that the multipart upload does not exist, has expired, or belongs to someone else.
+	ErrUploadSessionInvalid = 2211
+
+	// ErrUploadPartsInvalid indicates that the parts listed to complete a multipart upload are missing or out of order.
+	ErrUploadPartsInvalid = 2212
+
+	// ErrAttachmentTypeNotAllowed indicates that the file type is not allowed in this room or on the user's plan.
+	ErrAttachmentTypeNotAllowed = 2213
+
+	// ErrVoiceInvalid indicates that a voice message's duration or waveform is invalid or inconsistent with its recording.
+	ErrVoiceInvalid = 2214
+
+	// ErrViewOnceUnavailable indicates that a view-once attachment was already opened by the user, or was not sent to them.
+	ErrViewOnceUnavailable = 2215
+
+	// ErrUploadQuotaExceeded indicates that an upload would exceed the user's or the room's upload quota.
+	ErrUploadQuotaExceeded = 2216
+
+	// ErrAttachmentInfected indicates that the malware scanner flagged the uploaded file, which has been removed.
+	ErrAttachmentInfected = 2217
+
+	// ErrAttachmentScanUnavailable indicates that the uploaded file could not be scanned for malware.
+	ErrAttachmentScanUnavailable = 2218
 )
 
 // 3xxx: User, Session, and Security Errors
@@ -94,6 +142,12 @@ const (
 
 	// ErrOldPasswordInvalid indicates that the current password provided for verification is incorrect.
 	ErrOldPasswordInvalid = 3012
+
+	// ErrTooManyConnections indicates that the client IP or account already holds the maximum number of live connections.
+	ErrTooManyConnections = 3013
+
+	// ErrAvatarInvalid indicates that the avatar is not a WebP image within the size limit uploaded by the user.
+	ErrAvatarInvalid = 3014
 )
 
 // 5xxx: Internal System Errors
@@ -21,14 +21,30 @@ var errorMap = map[int]CustomError{
 	ErrRateLimitExceeded:     {Code: ErrRateLimitExceeded, Message: "Too many requests. Please try again later.", Status: http.StatusTooManyRequests},
 
 	// 2xxx: Room and Content Business Logic Errors
-	ErrRoomTypeInvalid:        {Code: ErrRoomTypeInvalid, Message: "Invalid chat type."},
-	ErrRoomCodeExists:         {Code: ErrRoomCodeExists, Message: "Chat code already exists."},
-	ErrRoomNotFound:           {Code: ErrRoomNotFound, Message: "Chat room not found."},
-	ErrRoomIsFull:             {Code: ErrRoomIsFull, Message: "This chat room is full."},
-	ErrMessageContentTooLong:  {Code: ErrMessageContentTooLong, Message: "Message is too long."},
-	ErrFileSizeTooLarge:       {Code: ErrFileSizeTooLarge, Message: "File is too large."},
-	ErrAttachmentCountInvalid: {Code: ErrAttachmentCountInvalid, Message: "Invalid number of attachments."},
-	ErrAttachmentKeyInvalid:   {Code: ErrAttachmentKeyInvalid, Message: "Invalid attachment."},
+	ErrRoomTypeInvalid:           {Code: ErrRoomTypeInvalid, Message: "Invalid chat type."},
+	ErrRoomCodeExists:            {Code: ErrRoomCodeExists, Message: "Chat code already exists."},
+	ErrRoomNotFound:              {Code: ErrRoomNotFound, Message: "Chat room not found."},
+	ErrRoomIsFull:                {Code: ErrRoomIsFull, Message: "This chat room is full."},
+	ErrRoomBusy:                  {Code: ErrRoomBusy, Message: "Chat room is busy. Please try again."},
+	ErrNotRoomHost:               {Code: ErrNotRoomHost, Message: "Only the room host can do this."},
+	ErrMessageContentTooLong:     {Code: ErrMessageContentTooLong, Message: "Message is too long."},
+	ErrFileSizeTooLarge:          {Code: ErrFileSizeTooLarge, Message: "File is too large."},
+	ErrAttachmentCountInvalid:    {Code: ErrAttachmentCountInvalid, Message: "Invalid number of attachments."},
+	ErrAttachmentKeyInvalid:      {Code: ErrAttachmentKeyInvalid, Message: "Invalid attachment."},
+	ErrMessageRateLimited:        {Code: ErrMessageRateLimited, Message: "You are sending messages too quickly."},
+	ErrUserMuted:                 {Code: ErrUserMuted, Message: "You have been temporarily muted for sending too many messages."},
+	ErrSlowModeActive:            {Code: ErrSlowModeActive, Message: "Slow mode is on. Please wait before sending another message."},
+	ErrAttachmentNotFound:        {Code: ErrAttachmentNotFound, Message: "Attachment upload not found."},
+	ErrAttachmentMismatch:        {Code: ErrAttachmentMismatch, Message: "Attachment does not match the uploaded file."},
+	ErrAttachmentContentInvalid:  {Code: ErrAttachmentContentInvalid, Message: "File content does not match its type."},
+	ErrUploadSessionInvalid:      {Code: ErrUploadSessionInvalid, Message: "Upload session is invalid or has expired."},
+	ErrUploadPartsInvalid:        {Code: ErrUploadPartsInvalid, Message: "Uploaded parts are incomplete."},
+	ErrAttachmentTypeNotAllowed:  {Code: ErrAttachmentTypeNotAllowed, Message: "This file type is not allowed here."},
+	ErrVoiceInvalid:              {Code: ErrVoiceInvalid, Message: "Invalid voice message."},
+	ErrViewOnceUnavailable:       {Code: ErrViewOnceUnavailable, Message: "This view-once attachment is no longer available."},
+	ErrUploadQuotaExceeded:       {Code: ErrUploadQuotaExceeded, Message: "Upload quota exceeded."},
+	ErrAttachmentInfected:        {Code: ErrAttachmentInfected, Message: "This file was flagged as malicious and has been removed."},
+	ErrAttachmentScanUnavailable: {Code: ErrAttachmentScanUnavailable, Message: "File scanning is temporarily unavailable. Please try again later.", Status: http.StatusServiceUnavailable},
 
 	// 3xxx: User, Session, and Security Errors
 	ErrPowChallengeRequired: {Code: ErrPowChallengeRequired, Message: "Verification required. Please try again."},
@@ -42,6 +58,8 @@ var errorMap = map[int]CustomError{
 	ErrInvalidCredentials:   {Code: ErrInvalidCredentials, Message: "Incorrect username or password."},
 	ErrUserNotFound:         {Code: ErrUserNotFound, Message: "Account not found."},
 	ErrOldPasswordInvalid:   {Code: ErrOldPasswordInvalid, Message: "Current password is incorrect."},
+	ErrTooManyConnections:   {Code: ErrTooManyConnections, Message: "Too many open connections. Please close other tabs or devices.", Status: http.StatusTooManyRequests},
+	ErrAvatarInvalid:        {Code: ErrAvatarInvalid, Message: "Invalid avatar image."},
 
 	ErrUnauthorized: {Code: ErrUnauthorized, Message: "Please sign in to continue.", Status: http.StatusUnauthorized},
 
@@ -0,0 +1,71 @@
+package imagex
+
+import "encoding/binary"
+
+// GIF block introducers.
+const (
+	gifExtension  = 0x21
+	gifDescriptor = 0x2C
+	gifTrailer    = 0x3B
+)
+
+// gifFrames walks the block structure of a GIF without decoding any pixel data and returns
+// the number of frames and the sum of their areas. It stops at the first malformed or
+// truncated block, leaving the error to the decoder.
+func gifFrames(data []byte) (frames int, pixels int64) {
+	// header (6 bytes) and logical screen descriptor (7 bytes)
+	if len(data) < 13 {
+		return 0, 0
+	}
+	pos := 13 + colorTableSize(data[10])
+
+	for pos < len(data) {
+		switch data[pos] {
+		case gifExtension:
+			pos = skipSubBlocks(data, pos+2)
+		case gifDescriptor:
+			if pos+10 > len(data) {
+				return frames, pixels
+			}
+			width := int64(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[pos+7:]))
+			frames++
+			pixels += width * height
+
+			// descriptor (10 bytes), local color table, LZW minimum code size (1 byte)
+			pos = skipSubBlocks(data, pos+10+colorTableSize(data[pos+9])+1)
+		case gifTrailer:
+			return frames, pixels
+		default:
+			return frames, pixels
+		}
+		if pos < 0 {
+			return frames, pixels
+		}
+	}
+
+	return frames, pixels
+}
+
+// colorTableSize returns the size in bytes of the color table announced by a packed field.
+func colorTableSize(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+	return 3 << (packed&0x07 + 1)
+}
+
+// skipSubBlocks returns the position following the data sub-blocks starting at pos,
+// or -1 if they are truncated.
+func skipSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos
+		}
+		pos += size
+	}
+
+	return -1
+}
@@ -0,0 +1,248 @@
+/*
+Package imagex provides image re-encoding helpers used to sanitize user uploads.
+
+Re-encoding decodes the pixels and writes a fresh file, which drops every metadata block
+(EXIF, XMP, comments, GPS data) carried by the original. JPEG orientation is applied to the
+pixels first so that stripped photos are still displayed the right way up.
+*/
+package imagex
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxPixels bounds the decoded size of an image to protect against decompression bombs.
+	MaxPixels = 40_000_000
+
+	// MaxFrames bounds the number of frames of an animated GIF.
+	MaxFrames = 1000
+
+	// MaxAnimationPixels bounds the decoded size of all the frames of an animated GIF together.
+	// Paletted frames take a byte per pixel, a quarter of a decoded still image.
+	MaxAnimationPixels = 4 * MaxPixels
+
+	// ThumbnailSize is the maximum width and height of a generated thumbnail.
+	ThumbnailSize = 320
+
+	// jpegQuality is the quality used when re-encoding JPEG images and thumbnails.
+	jpegQuality = 88
+)
+
+var (
+	// ErrUnsupportedFormat is returned for images whose format cannot be processed.
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+
+	// ErrTooLarge is returned when the image dimensions exceed MaxPixels, or when an
+	// animation exceeds MaxFrames or MaxAnimationPixels.
+	ErrTooLarge = errors.New("image dimensions too large")
+)
+
+// Encoded is an image file produced by this package.
+type Encoded struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Result is the outcome of processing an uploaded image.
+type Result struct {
+	// Original is the metadata-free re-encoding of the uploaded image.
+	Original Encoded
+
+	// Thumbnail is a downscaled preview that fits within ThumbnailSize.
+	Thumbnail Encoded
+}
+
+// Process decodes the image, strips its metadata by re-encoding it in its own format and
+// generates a thumbnail. The mimeType is the declared (and already verified) type of data.
+func Process(data []byte, mimeType string) (*Result, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	switch mimeType {
+	case "image/jpeg":
+		return processJPEG(data)
+	case "image/png":
+		return processStill(data, encodePNG)
+	case "image/gif":
+		return processGIF(data)
+	case "image/webp":
+		return processWebP(data)
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+func processJPEG(data []byte) (*Result, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	img = applyOrientation(img, jpegOrientation(data))
+
+	original, err := encodeJPEG(img)
+	if err != nil {
+		return nil, err
+	}
+
+	return withThumbnail(original, img)
+}
+
+func processStill(data []byte, encode func(image.Image) (Encoded, error)) (*Result, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := encode(img)
+	if err != nil {
+		return nil, err
+	}
+
+	return withThumbnail(original, img)
+}
+
+// processGIF re-encodes every frame, keeping animation timing but dropping comment
+// and application extensions other than the loop count.
+func processGIF(data []byte) (*Result, error) {
+	frames, pixels := gifFrames(data)
+	if frames > MaxFrames || pixels > MaxAnimationPixels {
+		return nil, ErrTooLarge
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(anim.Image) == 0 {
+		return nil, ErrUnsupportedFormat
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, err
+	}
+
+	original := Encoded{
+		Data:        buf.Bytes(),
+		ContentType: "image/gif",
+		Width:       anim.Config.Width,
+		Height:      anim.Config.Height,
+	}
+
+	return withThumbnail(original, anim.Image[0])
+}
+
+// processWebP strips metadata chunks from the RIFF container instead of re-encoding,
+// since the standard library has no WebP encoder. The pixels are only decoded for the thumbnail.
+func processWebP(data []byte) (*Result, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	stripped, err := stripWebPMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	original := Encoded{
+		Data:        stripped,
+		ContentType: "image/webp",
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+	}
+
+	return withThumbnail(original, img)
+}
+
+func withThumbnail(original Encoded, img image.Image) (*Result, error) {
+	thumb, err := Thumbnail(img, ThumbnailSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Original: original, Thumbnail: thumb}, nil
+}
+
+// Thumbnail scales img down to fit within size x size, preserving the aspect ratio.
+// Opaque images are encoded as JPEG, images with transparency as PNG.
+func Thumbnail(img image.Image, size int) (Encoded, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	if w > size || h > size {
+		if w >= h {
+			h = max(1, h*size/w)
+			w = size
+		} else {
+			w = max(1, w*size/h)
+			h = size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	if dst.Opaque() {
+		return encodeJPEG(dst)
+	}
+	return encodePNG(dst)
+}
+
+// Square crops img to its centered square and scales it to size x size, enlarging small images.
+// Opaque images are encoded as JPEG, images with transparency as PNG.
+func Square(img image.Image, size int) (Encoded, error) {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+
+	if dst.Opaque() {
+		return encodeJPEG(dst)
+	}
+	return encodePNG(dst)
+}
+
+func encodeJPEG(img image.Image) (Encoded, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return Encoded{}, err
+	}
+
+	bounds := img.Bounds()
+	return Encoded{Data: buf.Bytes(), ContentType: "image/jpeg", Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+func encodePNG(img image.Image) (Encoded, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return Encoded{}, err
+	}
+
+	bounds := img.Bounds()
+	return Encoded{Data: buf.Bytes(), ContentType: "image/png", Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
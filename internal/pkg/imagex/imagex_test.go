@@ -0,0 +1,117 @@
+package imagex
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// encodeGIF encodes an animation of frames of the given size.
+func encodeGIF(t *testing.T, width, height, frames int) []byte {
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		frame.SetColorIndex(i%width, 0, 1)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("encode gif: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// repeatFrames builds a GIF that repeats the single frame of data n times, without
+// decoding it, the way a decompression bomb would be crafted.
+func repeatFrames(t *testing.T, data []byte, n int) []byte {
+	t.Helper()
+
+	start := 13 + colorTableSize(data[10])
+	end := len(data) - 1 // trailer
+	if data[end] != gifTrailer {
+		t.Fatalf("gif does not end with a trailer")
+	}
+
+	out := append([]byte(nil), data[:start]...)
+	for i := 0; i < n; i++ {
+		out = append(out, data[start:end]...)
+	}
+	return append(out, gifTrailer)
+}
+
+func TestGIFFrames(t *testing.T) {
+	data := encodeGIF(t, 30, 20, 3)
+
+	frames, pixels := gifFrames(data)
+	if frames != 3 || pixels != 3*30*20 {
+		t.Fatalf("got %d frames, %d pixels; want 3, %d", frames, pixels, 3*30*20)
+	}
+
+	// truncated streams are counted up to the damage
+	if frames, _ := gifFrames(data[:len(data)/2]); frames > 3 {
+		t.Fatalf("truncated gif: got %d frames", frames)
+	}
+	if frames, pixels := gifFrames([]byte("GIF89a")); frames != 0 || pixels != 0 {
+		t.Fatalf("header only: got %d frames, %d pixels", frames, pixels)
+	}
+}
+
+func TestProcessAnimatedGIF(t *testing.T) {
+	result, err := Process(encodeGIF(t, 640, 480, 5), "image/gif")
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(result.Original.Data))
+	if err != nil {
+		t.Fatalf("decode re-encoded gif: %v", err)
+	}
+	if len(anim.Image) != 5 {
+		t.Fatalf("got %d frames, want 5", len(anim.Image))
+	}
+	if result.Thumbnail.Width != ThumbnailSize || result.Thumbnail.Height != ThumbnailSize*480/640 {
+		t.Fatalf("thumbnail: got %dx%d", result.Thumbnail.Width, result.Thumbnail.Height)
+	}
+}
+
+func TestProcessRejectsGIFBombs(t *testing.T) {
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte
+	}{
+		{
+			// well under MaxPixels per frame, but 7.2 billion pixels in total
+			name: "large frames",
+			data: func(t *testing.T) []byte {
+				return repeatFrames(t, encodeGIF(t, 6000, 6000, 1), 200)
+			},
+		},
+		{
+			name: "too many frames",
+			data: func(t *testing.T) []byte {
+				return repeatFrames(t, encodeGIF(t, 1, 1, 1), MaxFrames+1)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.data(t)
+			if len(data) > 25<<20 {
+				t.Fatalf("bomb is %d bytes, want it under the upload limit", len(data))
+			}
+
+			if _, err := Process(data, "image/gif"); !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("got %v, want ErrTooLarge", err)
+			}
+		})
+	}
+}
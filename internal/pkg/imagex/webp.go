@@ -0,0 +1,64 @@
+package imagex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// errInvalidWebP is returned when the RIFF container of a WebP file is malformed.
+var errInvalidWebP = errors.New("invalid webp container")
+
+// VP8X feature flags signalling the presence of metadata chunks.
+const (
+	vp8xFlagEXIF = 1 << 3
+	vp8xFlagXMP  = 1 << 2
+)
+
+// stripWebPMetadata rewrites a WebP RIFF container without its EXIF and XMP chunks,
+// clearing the matching VP8X feature flags. Image data chunks are copied unchanged.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errInvalidWebP
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+
+	pos := 12
+	for pos+8 <= len(data) {
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+
+		end := pos + 8 + size
+		if end > len(data) {
+			return nil, errInvalidWebP
+		}
+
+		// chunks are padded to an even size; some encoders omit the final pad byte
+		if size%2 == 1 && end < len(data) {
+			end++
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+			// dropped
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= vp8xFlagEXIF | vp8xFlagXMP
+			}
+			body.Write(chunk)
+		default:
+			body.Write(data[pos:end])
+		}
+
+		pos = end
+	}
+
+	out := make([]byte, 8, 8+body.Len())
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:8], uint32(body.Len()))
+
+	return append(out, body.Bytes()...), nil
+}
@@ -0,0 +1,74 @@
+package limiter
+
+import (
+	"context"
+	"time"
+
+	"hzchat/internal/pkg/logx"
+)
+
+// Decision is the outcome of a rate limit check.
+type Decision struct {
+	// Allowed reports whether the event may proceed.
+	Allowed bool
+
+	// Limit is the bucket capacity (burst) of the policy.
+	Limit int
+
+	// Remaining is the number of events still available in the current window.
+	Remaining int
+
+	// ResetAfter is the time until the bucket is completely refilled.
+	ResetAfter time.Duration
+
+	// RetryAfter is the time the caller must wait before retrying (zero when allowed).
+	RetryAfter time.Duration
+}
+
+// Limiter evaluates named policies against the buckets held by its Store.
+type Limiter struct {
+	// policies stores the configured policies, keyed by name.
+	policies map[string]Policy
+
+	// store holds the bucket state (local memory or a shared Redis server).
+	store Store
+}
+
+// New creates a Limiter for the given policies backed by the given store.
+func New(policies []Policy, store Store) *Limiter {
+	l := &Limiter{
+		policies: make(map[string]Policy, len(policies)),
+		store:    store,
+	}
+
+	for _, p := range policies {
+		l.policies[p.Name] = p
+	}
+
+	return l
+}
+
+// Policy returns the policy registered under the given name.
+func (l *Limiter) Policy(name string) (Policy, bool) {
+	p, ok := l.policies[name]
+	return p, ok
+}
+
+// Allow consumes one token from the subject's bucket under the named policy.
+// Unknown policies and store failures are logged and allowed (fail-open),
+// so a configuration typo or a backend outage never locks users out.
+func (l *Limiter) Allow(ctx context.Context, policyName string, s Subject) Decision {
+	policy, ok := l.policies[policyName]
+	if !ok {
+		logx.Warn("Rate limit policy not found, allowing request.", "policy", policyName)
+		return Decision{Allowed: true}
+	}
+
+	decision, err := l.store.Take(ctx, policy.bucketKey(s), policy)
+	if err != nil {
+		logx.Error(err, "Rate limit store failed, allowing request.", "policy", policyName)
+		return Decision{Allowed: true}
+	}
+
+	return decision
+}
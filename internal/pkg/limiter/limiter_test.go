@@ -0,0 +1,151 @@
+package limiter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hzchat/internal/pkg/errs"
+)
+
+func TestBucketKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []KeyPart
+		subject Subject
+		want    string
+	}{
+		{
+			name:    "ip",
+			keys:    []KeyPart{KeyIP},
+			subject: Subject{IP: "203.0.113.7", UserID: "alice"},
+			want:    "p|ip:203.0.113.7",
+		},
+		{
+			name:    "user",
+			keys:    []KeyPart{KeyUser},
+			subject: Subject{IP: "203.0.113.7", UserID: "alice"},
+			want:    "p|user:alice",
+		},
+		{
+			name:    "anonymous user falls back to the ip",
+			keys:    []KeyPart{KeyUser},
+			subject: Subject{IP: "203.0.113.7"},
+			want:    "p|ip:203.0.113.7",
+		},
+		{
+			name:    "unknown ip",
+			keys:    []KeyPart{KeyIP},
+			subject: Subject{},
+			want:    "p|ip:unknown_ip",
+		},
+		{
+			name:    "combined",
+			keys:    []KeyPart{KeyUser, KeyRoom, KeyObject},
+			subject: Subject{UserID: "alice", RoomCode: "ABC123", Object: "ABC123/a.txt"},
+			want:    "p|user:alice|room:ABC123|object:ABC123/a.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Policy{Name: "p", Keys: tt.keys}).bucketKey(tt.subject); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreBurst(t *testing.T) {
+	l := New([]Policy{{Name: "auth", Rate: 0.5, Burst: 2, Keys: []KeyPart{KeyIP}}}, newMemoryStore())
+	ctx := context.Background()
+	alice := Subject{IP: "203.0.113.7"}
+
+	for i, remaining := range []int{1, 0} {
+		d := l.Allow(ctx, "auth", alice)
+		if !d.Allowed || d.Remaining != remaining || d.Limit != 2 {
+			t.Fatalf("event %d: got %+v", i+1, d)
+		}
+	}
+
+	d := l.Allow(ctx, "auth", alice)
+	if d.Allowed || d.Remaining != 0 {
+		t.Fatalf("over the burst: got %+v", d)
+	}
+	if d.RetryAfter <= time.Second || d.RetryAfter > 2*time.Second {
+		t.Fatalf("over the burst: retry after %v, want about 2s", d.RetryAfter)
+	}
+
+	if d := l.Allow(ctx, "auth", Subject{IP: "198.51.100.1"}); !d.Allowed {
+		t.Fatalf("other ip: got %+v", d)
+	}
+	if d := l.Allow(ctx, "missing", alice); !d.Allowed {
+		t.Fatalf("unknown policy: got %+v, want the request allowed", d)
+	}
+}
+
+func TestMiddlewareHeaders(t *testing.T) {
+	l := New([]Policy{{Name: "auth", Rate: 0.25, Burst: 2, Keys: []KeyPart{KeyIP}}}, newMemoryStore())
+	subject := func(r *http.Request) Subject { return Subject{IP: "203.0.113.7"} }
+
+	handler := l.Middleware("auth", subject)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{status: http.StatusNoContent, remaining: "1", reset: "4"},
+		{status: http.StatusNoContent, remaining: "0", reset: "8"},
+		{status: http.StatusTooManyRequests, remaining: "0", reset: "8", retryAfter: "4"},
+	}
+
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", nil))
+
+		h := rec.Header()
+		if rec.Code != tt.status {
+			t.Fatalf("request %d: got status %d, want %d", i+1, rec.Code, tt.status)
+		}
+		if got := h.Get(HeaderLimit); got != "2" {
+			t.Fatalf("request %d: %s = %q, want 2", i+1, HeaderLimit, got)
+		}
+		if got := h.Get(HeaderRemaining); got != tt.remaining {
+			t.Fatalf("request %d: %s = %q, want %q", i+1, HeaderRemaining, got, tt.remaining)
+		}
+		if got := h.Get(HeaderReset); got != tt.reset {
+			t.Fatalf("request %d: %s = %q, want %q", i+1, HeaderReset, got, tt.reset)
+		}
+		if got := h.Get(HeaderRetryAfter); got != tt.retryAfter {
+			t.Fatalf("request %d: %s = %q, want %q", i+1, HeaderRetryAfter, got, tt.retryAfter)
+		}
+
+		if tt.status == http.StatusTooManyRequests {
+			var body struct {
+				Code int `json:"code"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode error body: %v", err)
+			}
+			if body.Code != errs.ErrRateLimitExceeded {
+				t.Fatalf("got code %d, want %d", body.Code, errs.ErrRateLimitExceeded)
+			}
+		}
+	}
+}
+
+func TestWriteHeadersWithoutPolicy(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteHeaders(rec, Decision{Allowed: true})
+
+	if len(rec.Header()) != 0 {
+		t.Fatalf("got headers %v for an unknown policy", rec.Header())
+	}
+}
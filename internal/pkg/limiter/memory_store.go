@@ -0,0 +1,98 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// memoryStore implements the Store interface with rate.Limiter token buckets held in a local map.
+// Limits are enforced per process, so running several instances multiplies every limit.
+type memoryStore struct {
+	// mu is used to protect concurrent access to the buckets map.
+	mu sync.Mutex
+
+	// buckets stores the map from bucket key to the *rate.Limiter instance.
+	buckets map[string]*rate.Limiter
+}
+
+// newMemoryStore creates a memoryStore and starts a background goroutine
+// to periodically clean up inactive buckets.
+func newMemoryStore() *memoryStore {
+	s := &memoryStore{
+		buckets: make(map[string]*rate.Limiter),
+	}
+
+	go s.cleanUpBuckets()
+
+	return s
+}
+
+// Take consumes one token from the bucket identified by key.
+func (s *memoryStore) Take(_ context.Context, key string, policy Policy) (Decision, error) {
+	bucket := s.getBucket(policy, key)
+
+	now := time.Now()
+	reservation := bucket.ReserveN(now, 1)
+
+	decision := Decision{Limit: policy.Burst}
+
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		decision.RetryAfter = delay
+	} else {
+		decision.Allowed = true
+	}
+
+	tokens := bucket.TokensAt(now)
+	decision.Remaining = int(math.Max(0, math.Floor(tokens)))
+	decision.ResetAfter = refillDuration(policy, tokens)
+
+	return decision, nil
+}
+
+// getBucket retrieves the token bucket for the given key, creating it if it does not exist.
+func (s *memoryStore) getBucket(policy Policy, key string) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, exists := s.buckets[key]
+	if !exists {
+		bucket = rate.NewLimiter(policy.Rate, policy.Burst)
+		s.buckets[key] = bucket
+	}
+
+	return bucket
+}
+
+// cleanUpBuckets periodically removes inactive buckets.
+// A bucket is considered inactive and removed if it is full
+// (i.e., tokens equal to the burst capacity), which frees up memory.
+func (s *memoryStore) cleanUpBuckets() {
+	ticker := time.NewTicker(3 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		for key, bucket := range s.buckets {
+			if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+				delete(s.buckets, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// refillDuration returns how long it takes for a bucket holding the given tokens to be full again.
+func refillDuration(policy Policy, tokens float64) time.Duration {
+	missing := float64(policy.Burst) - tokens
+	if missing <= 0 || policy.Rate <= 0 {
+		return 0
+	}
+
+	return time.Duration(missing / float64(policy.Rate) * float64(time.Second))
+}
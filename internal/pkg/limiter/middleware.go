@@ -0,0 +1,65 @@
+package limiter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hzchat/internal/pkg/errs"
+	"hzchat/internal/pkg/logx"
+	"hzchat/internal/pkg/resp"
+)
+
+// Standard rate limit response headers.
+const (
+	HeaderLimit      = "RateLimit-Limit"
+	HeaderRemaining  = "RateLimit-Remaining"
+	HeaderReset      = "RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+)
+
+// SubjectFunc extracts the rate limit subject from an incoming request.
+type SubjectFunc func(r *http.Request) Subject
+
+// Middleware returns an HTTP middleware that enforces the named policy.
+// RateLimit-* headers are set on every response; rejected requests receive
+// a 429 Too Many Requests error with a Retry-After header.
+func (l *Limiter) Middleware(policyName string, subject SubjectFunc) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			decision := l.Allow(r.Context(), policyName, subject(r))
+
+			WriteHeaders(w, decision)
+
+			if !decision.Allowed {
+				logx.Warn("Request rejected: Rate limit exceeded.", "policy", policyName, "path", r.URL.Path)
+				resp.RespondError(w, r, errs.NewError(errs.ErrRateLimitExceeded))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WriteHeaders sets the standard rate limit headers for the given decision.
+func WriteHeaders(w http.ResponseWriter, d Decision) {
+	if d.Limit == 0 {
+		return
+	}
+
+	h := w.Header()
+	h.Set(HeaderLimit, strconv.Itoa(d.Limit))
+	h.Set(HeaderRemaining, strconv.Itoa(d.Remaining))
+	h.Set(HeaderReset, strconv.Itoa(ceilSeconds(d.ResetAfter)))
+
+	if !d.Allowed {
+		h.Set(HeaderRetryAfter, strconv.Itoa(ceilSeconds(d.RetryAfter)))
+	}
+}
+
+// ceilSeconds rounds a duration up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,142 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedis starts an embedded Redis-compatible server with a frozen clock.
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, time.Time) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+
+	return server, now
+}
+
+// newTestRedisStore connects a new store to the server, as a separate instance would.
+func newTestRedisStore(t *testing.T, server *miniredis.Miniredis) Store {
+	t.Helper()
+
+	store, err := NewStore(StoreConfig{Driver: StoreRedis, RedisURL: "redis://" + server.Addr()})
+	if err != nil {
+		t.Fatalf("new redis store: %v", err)
+	}
+	t.Cleanup(func() { store.(*redisStore).client.Close() })
+
+	return store
+}
+
+func TestRedisStoreGCRA(t *testing.T) {
+	server, now := newTestRedis(t)
+	store := newTestRedisStore(t, server)
+	ctx := context.Background()
+
+	// one event per second, three at once
+	policy := Policy{Name: "test", Rate: 1, Burst: 3, Keys: []KeyPart{KeyIP}}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    Decision
+	}{
+		{
+			name: "first event",
+			want: Decision{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second},
+		},
+		{
+			name: "second event",
+			want: Decision{Allowed: true, Limit: 3, Remaining: 1, ResetAfter: 2 * time.Second},
+		},
+		{
+			name: "burst exhausted",
+			want: Decision{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: 3 * time.Second},
+		},
+		{
+			name: "over the burst",
+			want: Decision{Allowed: false, Limit: 3, Remaining: 0, RetryAfter: time.Second, ResetAfter: 3 * time.Second},
+		},
+		{
+			name:    "partially refilled",
+			advance: 400 * time.Millisecond,
+			want:    Decision{Allowed: false, Limit: 3, Remaining: 0, RetryAfter: 600 * time.Millisecond, ResetAfter: 2600 * time.Millisecond},
+		},
+		{
+			name:    "one event refilled",
+			advance: 600 * time.Millisecond,
+			want:    Decision{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: 3 * time.Second},
+		},
+		{
+			name:    "fully reset",
+			advance: time.Minute,
+			want:    Decision{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		server.SetTime(now)
+		server.FastForward(tt.advance)
+
+		got, err := store.Take(ctx, policy.bucketKey(Subject{IP: "203.0.113.7"}), policy)
+		if err != nil {
+			t.Fatalf("%s: take: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// the bucket expires once it is full again
+	key := redisKeyPrefix + policy.bucketKey(Subject{IP: "203.0.113.7"})
+	if !server.Exists(key) {
+		t.Fatalf("bucket %q is missing", key)
+	}
+	server.FastForward(time.Second)
+	if server.Exists(key) {
+		t.Fatalf("full bucket %q was not expired", key)
+	}
+}
+
+func TestRedisStoreIsSharedByLimiters(t *testing.T) {
+	server, _ := newTestRedis(t)
+	policies := []Policy{{Name: "ws_connect", Rate: 0.1, Burst: 2, Keys: []KeyPart{KeyUser}}}
+
+	first := New(policies, newTestRedisStore(t, server))
+	second := New(policies, newTestRedisStore(t, server))
+	ctx := context.Background()
+	alice := Subject{IP: "203.0.113.7", UserID: "alice"}
+
+	if d := first.Allow(ctx, "ws_connect", alice); !d.Allowed || d.Remaining != 1 {
+		t.Fatalf("first instance: got %+v", d)
+	}
+	if d := second.Allow(ctx, "ws_connect", alice); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("second instance: got %+v", d)
+	}
+	for name, l := range map[string]*Limiter{"first": first, "second": second} {
+		if d := l.Allow(ctx, "ws_connect", alice); d.Allowed || d.RetryAfter != 10*time.Second {
+			t.Fatalf("%s instance over the shared limit: got %+v", name, d)
+		}
+	}
+
+	// other subjects keep their own bucket
+	if d := second.Allow(ctx, "ws_connect", Subject{IP: "203.0.113.7", UserID: "bob"}); !d.Allowed {
+		t.Fatalf("other user: got %+v", d)
+	}
+}
+
+func TestRedisStoreFailsOpen(t *testing.T) {
+	server, _ := newTestRedis(t)
+	l := New([]Policy{{Name: "auth", Rate: 1, Burst: 1, Keys: []KeyPart{KeyIP}}}, newTestRedisStore(t, server))
+
+	server.Close()
+
+	if d := l.Allow(context.Background(), "auth", Subject{IP: "203.0.113.7"}); !d.Allowed {
+		t.Fatalf("store outage: got %+v, want the request allowed", d)
+	}
+}
@@ -0,0 +1,39 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// StoreMemory keeps token buckets in the local process.
+	StoreMemory = "memory"
+
+	// StoreRedis keeps rate limit state in a Redis-protocol server shared by all instances.
+	StoreRedis = "redis"
+)
+
+// Store defines the backend that holds rate limit state.
+type Store interface {
+	// Take consumes one event from the bucket identified by key under the given policy.
+	Take(ctx context.Context, key string, policy Policy) (Decision, error)
+}
+
+// StoreConfig holds the configuration required to build a Store.
+type StoreConfig struct {
+	Driver   string
+	RedisURL string
+}
+
+// NewStore is the factory function for Store.
+// It initializes and returns a concrete implementation based on the configured driver.
+func NewStore(cfg StoreConfig) (Store, error) {
+	switch cfg.Driver {
+	case "", StoreMemory:
+		return newMemoryStore(), nil
+	case StoreRedis:
+		return newRedisStore(cfg.RedisURL)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store driver %q", cfg.Driver)
+	}
+}
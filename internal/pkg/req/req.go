@@ -9,6 +9,7 @@ package req
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 	"strings"
 
@@ -62,3 +63,18 @@ func SetupMultipart(w http.ResponseWriter, r *http.Request) *errs.CustomError {
 
 	return nil
 }
+
+// ClientIP returns the client IP address of the request.
+// It relies on RemoteAddr, which the RealIP middleware has already resolved from proxy headers.
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if ip == "" {
+		ip = "unknown_ip"
+	}
+
+	return ip
+}
@@ -0,0 +1,118 @@
+package testkit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// EICAR is the standard antivirus test string, which FakeClamd reports as infected.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// FakeClamdSignature is the signature FakeClamd reports for streams containing EICAR.
+const FakeClamdSignature = "Eicar-Test-Signature"
+
+// FakeClamd is a local clamd daemon that answers INSTREAM scans, flagging streams that contain EICAR.
+type FakeClamd struct {
+	listener net.Listener
+	down     atomic.Bool
+	scans    atomic.Int64
+	wg       sync.WaitGroup
+}
+
+// NewFakeClamd starts a fake daemon on a local TCP port and registers its shutdown with t.Cleanup.
+func NewFakeClamd(t testing.TB) *FakeClamd {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("testkit: fake clamd: %v", err)
+	}
+
+	f := &FakeClamd{listener: listener}
+
+	f.wg.Add(1)
+	go f.serve()
+
+	t.Cleanup(func() {
+		listener.Close()
+		f.wg.Wait()
+	})
+
+	return f
+}
+
+// Address returns the daemon address in the form expected by CLAMD_ADDRESS.
+func (f *FakeClamd) Address() string {
+	return "tcp://" + f.listener.Addr().String()
+}
+
+// SetDown simulates an outage: while down, connections are closed without a reply.
+func (f *FakeClamd) SetDown(down bool) {
+	f.down.Store(down)
+}
+
+// Scans returns the number of completed scans.
+func (f *FakeClamd) Scans() int64 {
+	return f.scans.Load()
+}
+
+func (f *FakeClamd) serve() {
+	defer f.wg.Done()
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer conn.Close()
+
+			if f.down.Load() {
+				return
+			}
+			f.handle(conn)
+		}()
+	}
+}
+
+// handle reads one INSTREAM command and writes the scan result.
+func (f *FakeClamd) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+
+	cmd, err := r.ReadString(0)
+	if err != nil || cmd != "zINSTREAM\x00" {
+		io.WriteString(conn, "UNKNOWN COMMAND\x00")
+		return
+	}
+
+	var content bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&content, r, int64(size)); err != nil {
+			return
+		}
+	}
+
+	f.scans.Add(1)
+
+	if bytes.Contains(content.Bytes(), []byte(EICAR)) {
+		io.WriteString(conn, "stream: "+FakeClamdSignature+" FOUND\x00")
+		return
+	}
+	io.WriteString(conn, "stream: OK\x00")
+}
@@ -0,0 +1,180 @@
+package testkit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "hzchat/internal/app/db/sqlc"
+)
+
+// FakeQuerier is an in-memory implementation of the generated db.Querier interface.
+// It mirrors the behaviour of the SQL queries closely enough for handler tests:
+// soft-deleted users are invisible, missing rows return pgx.ErrNoRows, and duplicate
+// usernames fail with a unique violation.
+type FakeQuerier struct {
+	// mu protects users.
+	mu    sync.Mutex
+	users map[[16]byte]db.User
+}
+
+var _ db.Querier = (*FakeQuerier)(nil)
+
+// NewFakeQuerier creates an empty FakeQuerier.
+func NewFakeQuerier() *FakeQuerier {
+	return &FakeQuerier{users: make(map[[16]byte]db.User)}
+}
+
+// CreateUser inserts a user, failing with a unique violation if the username is taken.
+func (f *FakeQuerier) CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range f.users {
+		if u.Username == arg.Username && !u.DeletedAt.Valid {
+			return db.User{}, &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+		}
+	}
+
+	now := time.Now()
+	user := db.User{
+		ID:           pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Username:     arg.Username,
+		PasswordHash: arg.PasswordHash,
+		Nickname:     arg.Nickname,
+		PlanType:     "FREE",
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	f.users[user.ID.Bytes] = user
+
+	return user, nil
+}
+
+// GetUserByID returns an active user by ID.
+func (f *FakeQuerier) GetUserByID(ctx context.Context, id pgtype.UUID) (db.GetUserByIDRow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.active(id)
+	if !ok {
+		return db.GetUserByIDRow{}, pgx.ErrNoRows
+	}
+
+	return db.GetUserByIDRow{
+		ID:           u.ID,
+		Nickname:     u.Nickname,
+		AvatarUrl:    u.AvatarUrl,
+		PlanType:     u.PlanType,
+		LastLoginAt:  u.LastLoginAt,
+		PasswordHash: u.PasswordHash,
+	}, nil
+}
+
+// GetUserByUsername returns an active user by username.
+func (f *FakeQuerier) GetUserByUsername(ctx context.Context, username string) (db.GetUserByUsernameRow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range f.users {
+		if u.Username == username && !u.DeletedAt.Valid {
+			return db.GetUserByUsernameRow{
+				ID:           u.ID,
+				Username:     u.Username,
+				PasswordHash: u.PasswordHash,
+				Nickname:     u.Nickname,
+				AvatarUrl:    u.AvatarUrl,
+				PlanType:     u.PlanType,
+			}, nil
+		}
+	}
+
+	return db.GetUserByUsernameRow{}, pgx.ErrNoRows
+}
+
+// ListAvatarKeys returns the non-empty avatar keys of active users.
+func (f *FakeQuerier) ListAvatarKeys(ctx context.Context) ([]pgtype.Text, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var keys []pgtype.Text
+	for _, u := range f.users {
+		if u.AvatarUrl.Valid && u.AvatarUrl.String != "" && !u.DeletedAt.Valid {
+			keys = append(keys, u.AvatarUrl)
+		}
+	}
+
+	return keys, nil
+}
+
+// UpdateLastLogin sets the last login time of an active user.
+func (f *FakeQuerier) UpdateLastLogin(ctx context.Context, id pgtype.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if u, ok := f.active(id); ok {
+		u.LastLoginAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		f.users[id.Bytes] = u
+	}
+
+	return nil
+}
+
+// UpdateUserPassword replaces the password hash of an active user.
+func (f *FakeQuerier) UpdateUserPassword(ctx context.Context, arg db.UpdateUserPasswordParams) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if u, ok := f.active(arg.ID); ok {
+		u.PasswordHash = arg.PasswordHash
+		u.UpdatedAt = time.Now()
+		f.users[arg.ID.Bytes] = u
+	}
+
+	return nil
+}
+
+// UpdateUserProfile replaces the nickname and avatar of an active user.
+func (f *FakeQuerier) UpdateUserProfile(ctx context.Context, arg db.UpdateUserProfileParams) (db.UpdateUserProfileRow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.active(arg.ID)
+	if !ok {
+		return db.UpdateUserProfileRow{}, pgx.ErrNoRows
+	}
+
+	u.Nickname = arg.Nickname
+	u.AvatarUrl = arg.AvatarUrl
+	u.UpdatedAt = time.Now()
+	f.users[arg.ID.Bytes] = u
+
+	return db.UpdateUserProfileRow{
+		ID:        u.ID,
+		Nickname:  u.Nickname,
+		AvatarUrl: u.AvatarUrl,
+		UpdatedAt: u.UpdatedAt,
+	}, nil
+}
+
+// User returns the stored row of a user, including soft-deleted ones.
+func (f *FakeQuerier) User(id pgtype.UUID) (db.User, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.users[id.Bytes]
+	return u, ok
+}
+
+func (f *FakeQuerier) active(id pgtype.UUID) (db.User, bool) {
+	u, ok := f.users[id.Bytes]
+	if !ok || u.DeletedAt.Valid {
+		return db.User{}, false
+	}
+	return u, true
+}
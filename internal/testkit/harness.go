@@ -0,0 +1,402 @@
+/*
+Package testkit provides an in-process server harness for end-to-end tests.
+
+The Harness wires the real Router, chat Manager, rate limiter and handlers to in-memory
+storage and a fake database, listens on a local httptest server, and offers helpers to
+register users, create and join rooms, upload attachments and drive WebSocket clients.
+*/
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hzchat/internal/app/chat"
+	"hzchat/internal/app/gc"
+	"hzchat/internal/app/storage"
+	"hzchat/internal/configs"
+	"hzchat/internal/handler"
+	"hzchat/internal/pkg/cdnsign"
+	"hzchat/internal/pkg/limiter"
+)
+
+// Secret is the JWT secret used by the harness configuration.
+const Secret = "testkit-secret"
+
+// Harness is a fully wired in-process server.
+type Harness struct {
+	t testing.TB
+
+	Config         *configs.AppConfig
+	Manager        *chat.Manager
+	DB             *FakeQuerier
+	PublicStorage  *storage.MemoryStore
+	PrivateStorage *storage.MemoryStore
+	RateLimiter    *limiter.Limiter
+	Server         *httptest.Server
+
+	// GC is a garbage collector over the harness stores; it never runs unless a test calls RunOnce.
+	GC *gc.Collector
+
+	guests atomic.Int64
+}
+
+// Option adjusts the harness configuration before the server is built.
+type Option func(cfg *configs.AppConfig)
+
+// New starts a harness and registers its shutdown with t.Cleanup.
+// Rate limits are effectively disabled unless an Option restores them.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+
+	cfg := DefaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	h := &Harness{
+		t:              t,
+		Config:         cfg,
+		DB:             NewFakeQuerier(),
+		PublicStorage:  storage.NewMemoryStore(cfg.S3PublicBucketName),
+		PrivateStorage: storage.NewMemoryStore(cfg.S3PrivateBucketName),
+	}
+
+	rateLimitStore, err := limiter.NewStore(limiter.StoreConfig{Driver: limiter.StoreMemory})
+	if err != nil {
+		t.Fatalf("testkit: rate limit store: %v", err)
+	}
+	h.RateLimiter = limiter.New(handler.RateLimitPolicies(cfg.RateLimitPolicies), rateLimitStore)
+
+	scanner, err := chat.NewAttachmentScanner(cfg, h.PrivateStorage)
+	if err != nil {
+		t.Fatalf("testkit: attachment scanner: %v", err)
+	}
+
+	h.Manager = chat.NewManager(cfg, chat.ManagerDeps{
+		RateLimiter:    h.RateLimiter,
+		PrivateStorage: h.PrivateStorage,
+		Scanner:        scanner,
+	})
+
+	h.GC = gc.New(gc.Config{
+		Interval:    time.Hour,
+		GracePeriod: time.Duration(cfg.GCGraceMinutes) * time.Minute,
+		DryRun:      cfg.GCDryRun,
+	}, gc.Deps{
+		PrivateStorage: h.PrivateStorage,
+		PublicStorage:  h.PublicStorage,
+		Rooms:          h.Manager,
+		Avatars:        h.DB,
+	})
+
+	assetSigner, err := cdnsign.New(handler.AssetSignerConfig(cfg))
+	if err != nil {
+		t.Fatalf("testkit: asset signer: %v", err)
+	}
+
+	h.Server = httptest.NewServer(handler.Router(&handler.AppDeps{
+		Manager:        h.Manager,
+		Config:         cfg,
+		PublicStorage:  h.PublicStorage,
+		PrivateStorage: h.PrivateStorage,
+		DB:             h.DB,
+		RateLimiter:    h.RateLimiter,
+		AssetSigner:    assetSigner,
+		GC:             h.GC,
+	}))
+
+	t.Cleanup(func() {
+		h.Server.Close()
+		h.Manager.Shutdown()
+	})
+
+	return h
+}
+
+// DefaultConfig returns the configuration used by New: development mode, memory stores, the
+// default flood policies, upload plans, quotas and attachment types, no malware scanner, and
+// rate limit policies raised far above any test's traffic.
+func DefaultConfig() *configs.AppConfig {
+	policies := make([]configs.RateLimitPolicy, 0, len(configs.DefaultRateLimitPolicies))
+	for _, p := range configs.DefaultRateLimitPolicies {
+		p.Rate, p.Burst = 10000, 10000
+		policies = append(policies, p)
+	}
+
+	floodPolicies := make(map[string]configs.FloodPolicy, len(configs.DefaultFloodPolicies))
+	for roomType, p := range configs.DefaultFloodPolicies {
+		floodPolicies[roomType] = p
+	}
+
+	uploadPlans := make(configs.UploadPlans, len(configs.DefaultUploadPlans))
+	for planType, p := range configs.DefaultUploadPlans {
+		uploadPlans[planType] = p
+	}
+
+	attachmentTypes := make(configs.AttachmentTypes, len(configs.DefaultAttachmentTypes))
+	for mimeType, t := range configs.DefaultAttachmentTypes {
+		attachmentTypes[mimeType] = t
+	}
+
+	return &configs.AppConfig{
+		Environment:         "development",
+		JWTSecret:           Secret,
+		AllowedOrigins:      []string{},
+		PublicAssetBaseURL:  "https://assets.example.test",
+		S3PublicBucketName:  "public",
+		S3PrivateBucketName: "private",
+		RateLimitPolicies:   policies,
+		RateLimitStore:      limiter.StoreMemory,
+		FloodPolicies:       floodPolicies,
+		UploadPlans:         uploadPlans,
+		RoomUploadQuotaMB:   1024,
+		AttachmentTypes:     attachmentTypes,
+		Scanner:             chat.ScannerNone,
+		CDNSigning:          cdnsign.ModeNone,
+	}
+}
+
+// Response is a decoded API response.
+type Response struct {
+	Status  int
+	Header  http.Header
+	Code    int
+	Message string
+	Data    json.RawMessage
+}
+
+// Decode unmarshals the response data into v.
+func (r *Response) Decode(t testing.TB, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("testkit: decode response data %s: %v", r.Data, err)
+	}
+}
+
+// Do sends a JSON request to the harness server. A non-empty token is sent as a Bearer token.
+// Redirects are not followed so that presigned download redirects can be inspected.
+func (h *Harness) Do(method, path, token string, body any) *Response {
+	h.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			h.t.Fatalf("testkit: encode request body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, h.Server.URL+path, reader)
+	if err != nil {
+		h.t.Fatalf("testkit: build request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		h.t.Fatalf("testkit: %s %s: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	out := &Response{Status: res.StatusCode, Header: res.Header}
+
+	raw, _ := io.ReadAll(res.Body)
+	var envelope struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(raw, &envelope) == nil {
+		out.Code, out.Message, out.Data = envelope.Code, envelope.Message, envelope.Data
+	}
+
+	return out
+}
+
+// MustOK sends a request and fails the test unless it succeeds with business code 0.
+func (h *Harness) MustOK(method, path, token string, body any) *Response {
+	h.t.Helper()
+
+	res := h.Do(method, path, token, body)
+	if res.Status != http.StatusOK || res.Code != 0 {
+		h.t.Fatalf("testkit: %s %s: status %d, code %d (%s)", method, path, res.Status, res.Code, res.Message)
+	}
+
+	return res
+}
+
+// User is a registered account created through the API.
+type User struct {
+	ID       string
+	Nickname string
+	Token    string
+}
+
+// Register creates an account through /api/auth/register.
+func (h *Harness) Register(username, password string) *User {
+	h.t.Helper()
+
+	res := h.MustOK(http.MethodPost, "/api/auth/register", "", map[string]string{
+		"username": username,
+		"password": password,
+	})
+
+	var data struct {
+		Token string `json:"token"`
+		User  struct {
+			ID       string `json:"id"`
+			Nickname string `json:"nickname"`
+		} `json:"user"`
+	}
+	res.Decode(h.t, &data)
+
+	return &User{ID: data.User.ID, Nickname: data.User.Nickname, Token: data.Token}
+}
+
+// CreateRoom creates a room of the given type and returns its code.
+func (h *Harness) CreateRoom(roomType string) string {
+	h.t.Helper()
+
+	res := h.MustOK(http.MethodPost, "/api/chat/create", "", map[string]string{"type": roomType})
+
+	var data struct {
+		ChatCode string `json:"chatCode"`
+	}
+	res.Decode(h.t, &data)
+
+	return data.ChatCode
+}
+
+// JoinAsGuest joins the room with a fresh guest ID and returns the room access token.
+func (h *Harness) JoinAsGuest(roomCode, nickname string) string {
+	h.t.Helper()
+
+	guestID := fmt.Sprintf("guest_%06d", h.guests.Add(1))
+
+	return h.join("", map[string]string{"code": roomCode, "guestId": guestID, "nickname": nickname})
+}
+
+// JoinAsUser joins the room as a registered user and returns the room access token.
+func (h *Harness) JoinAsUser(roomCode string, user *User) string {
+	h.t.Helper()
+
+	return h.join(user.Token, map[string]string{"code": roomCode})
+}
+
+func (h *Harness) join(token string, body map[string]string) string {
+	h.t.Helper()
+
+	res := h.MustOK(http.MethodPost, "/api/chat/join", token, body)
+
+	var data struct {
+		Token string `json:"token"`
+	}
+	res.Decode(h.t, &data)
+
+	return data.Token
+}
+
+// Upload requests a presigned upload URL with the room token and simulates the client's
+// direct upload by storing data in the private memory store. It returns the attachment
+// to send in an ATTACHMENTS message.
+func (h *Harness) Upload(roomToken, fileName, mimeType string, data []byte) chat.Attachment {
+	h.t.Helper()
+
+	res := h.MustOK(http.MethodPost, "/api/file/presign-upload", roomToken, map[string]any{
+		"fileName": fileName,
+		"mimeType": mimeType,
+		"fileSize": len(data),
+	})
+
+	var presign struct {
+		FileKey string `json:"fileKey"`
+	}
+	res.Decode(h.t, &presign)
+
+	if err := h.PrivateStorage.Put(context.Background(), presign.FileKey, data, mimeType); err != nil {
+		h.t.Fatalf("testkit: store upload: %v", err)
+	}
+
+	return chat.Attachment{
+		Key:      presign.FileKey,
+		Name:     fileName,
+		MimeType: mimeType,
+		Size:     int64(len(data)),
+	}
+}
+
+// UploadMultipart uploads data through the multipart endpoints with the room token, simulating
+// each part upload with the private memory store. It returns the attachment to send in an
+// ATTACHMENTS message.
+func (h *Harness) UploadMultipart(roomToken, fileName, mimeType string, data []byte) chat.Attachment {
+	h.t.Helper()
+
+	res := h.MustOK(http.MethodPost, "/api/file/multipart/initiate", roomToken, map[string]any{
+		"fileName": fileName,
+		"mimeType": mimeType,
+		"fileSize": len(data),
+	})
+
+	var upload struct {
+		UploadID  string `json:"uploadId"`
+		FileKey   string `json:"fileKey"`
+		PartSize  int64  `json:"partSize"`
+		PartCount int32  `json:"partCount"`
+	}
+	res.Decode(h.t, &upload)
+
+	parts := make([]storage.CompletedPart, 0, upload.PartCount)
+	for n := int32(1); n <= upload.PartCount; n++ {
+		res := h.MustOK(http.MethodPost, "/api/file/multipart/presign-part", roomToken, map[string]any{
+			"fileKey":    upload.FileKey,
+			"uploadId":   upload.UploadID,
+			"partNumber": n,
+		})
+
+		var part struct {
+			PartSize int64 `json:"partSize"`
+		}
+		res.Decode(h.t, &part)
+
+		start := int64(n-1) * upload.PartSize
+		etag, err := h.PrivateStorage.UploadPart(upload.FileKey, upload.UploadID, n, data[start:start+part.PartSize])
+		if err != nil {
+			h.t.Fatalf("testkit: upload part %d: %v", n, err)
+		}
+
+		parts = append(parts, storage.CompletedPart{PartNumber: n, ETag: etag})
+	}
+
+	h.MustOK(http.MethodPost, "/api/file/multipart/complete", roomToken, map[string]any{
+		"fileKey":  upload.FileKey,
+		"uploadId": upload.UploadID,
+		"parts":    parts,
+	})
+
+	return chat.Attachment{
+		Key:      upload.FileKey,
+		Name:     fileName,
+		MimeType: mimeType,
+		Size:     int64(len(data)),
+	}
+}
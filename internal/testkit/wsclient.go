@@ -0,0 +1,129 @@
+package testkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"hzchat/internal/app/chat"
+)
+
+// DefaultTimeout is how long WSClient waits for an expected message.
+const DefaultTimeout = 5 * time.Second
+
+// WSClient is a real WebSocket connection to a harness room.
+type WSClient struct {
+	t    testing.TB
+	conn *websocket.Conn
+}
+
+// Connect opens a WebSocket connection to the room with a room access token.
+func (h *Harness) Connect(roomCode, roomToken string) *WSClient {
+	h.t.Helper()
+
+	conn, res, err := h.Dial(roomCode, roomToken)
+	if err != nil {
+		status := 0
+		if res != nil {
+			status = res.StatusCode
+		}
+		h.t.Fatalf("testkit: dial room %s: %v (status %d)", roomCode, err, status)
+	}
+
+	c := &WSClient{t: h.t, conn: conn}
+	h.t.Cleanup(c.Close)
+
+	return c
+}
+
+// Dial opens a raw WebSocket connection, returning the handshake response so that
+// rejected connections can be inspected.
+func (h *Harness) Dial(roomCode, roomToken string) (*websocket.Conn, *http.Response, error) {
+	wsURL := "ws" + strings.TrimPrefix(h.Server.URL, "http") + "/ws/" + roomCode + "?token=" + url.QueryEscape(roomToken)
+
+	return websocket.DefaultDialer.Dial(wsURL, nil)
+}
+
+// Send writes a client message with the given type, payload and temporary ID.
+func (c *WSClient) Send(msgType chat.MessageType, payload any, tempID string) {
+	c.t.Helper()
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		c.t.Fatalf("testkit: encode payload: %v", err)
+	}
+
+	msg := map[string]any{
+		"type":    msgType,
+		"payload": json.RawMessage(raw),
+		"tempID":  tempID,
+	}
+
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatalf("testkit: send %s: %v", msgType, err)
+	}
+}
+
+// Next reads the next server message, waiting at most timeout.
+func (c *WSClient) Next(timeout time.Duration) (chat.Message, error) {
+	var msg chat.Message
+
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return msg, err
+	}
+
+	err := c.conn.ReadJSON(&msg)
+	return msg, err
+}
+
+// Expect reads messages until one of the given type arrives, skipping any others,
+// and fails the test if none arrives within DefaultTimeout.
+func (c *WSClient) Expect(msgType chat.MessageType) chat.Message {
+	c.t.Helper()
+
+	deadline := time.Now().Add(DefaultTimeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			c.t.Fatalf("testkit: timed out waiting for %s", msgType)
+		}
+
+		msg, err := c.Next(remaining)
+		if err != nil {
+			c.t.Fatalf("testkit: waiting for %s: %v", msgType, err)
+		}
+
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+// ExpectError waits for a TypeError message and returns its payload.
+func (c *WSClient) ExpectError() chat.ErrorPayload {
+	c.t.Helper()
+
+	var payload chat.ErrorPayload
+	DecodePayload(c.t, c.Expect(chat.TypeError), &payload)
+
+	return payload
+}
+
+// Close closes the connection. It is safe to call more than once.
+func (c *WSClient) Close() {
+	_ = c.conn.Close()
+}
+
+// DecodePayload unmarshals a message payload into v.
+func DecodePayload(t testing.TB, msg chat.Message, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(msg.Payload, v); err != nil {
+		t.Fatalf("testkit: decode %s payload: %v", msg.Type, err)
+	}
+}